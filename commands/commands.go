@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var registry = map[string]command{
+	"create-hospital": {
+		usage: "create-hospital -code <code> -name-th <name> [-name-en <name>] [-hcode <5 digits>]",
+		run:   createHospital,
+	},
+	"set-hospital-status": {
+		usage: "set-hospital-status -code <code> -status active|suspended",
+		run:   setHospitalStatus,
+	},
+	"rotate-encryption-key": {
+		usage: "rotate-encryption-key [-batch 500] [-rewrap-only]",
+		run:   rotateEncryptionKey,
+	},
+	"migrate": {
+		usage: "migrate up|down [-steps 1]|status",
+		run:   migrate,
+	},
+	"create-admin": {
+		usage: "create-admin -username <name> -hospital <hospital> [-password <password>]",
+		run:   createAdmin,
+	},
+}
+
+// รันคำสั่ง CLI ตามชื่อใน args[0] เช่น `./main create-admin -username admin -hospital "Hospital A"`
+func Run(args []string) error {
+	cmd, ok := registry[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], Usage())
+	}
+	return cmd.run(args[1:])
+}
+
+// รายการคำสั่งที่รองรับ
+func Usage() string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Commands:\n")
+	for _, name := range names {
+		b.WriteString("  " + registry[name].usage + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"HIS-api/config"
+	"HIS-api/database"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+
+	"gorm.io/gorm"
+)
+
+// สร้าง admin คนแรกของโรงพยาบาลใหม่ (bootstrap)
+// ใช้ได้เฉพาะโรงพยาบาลที่ยังไม่มี admin เลย หลังจากนั้นให้ admin สร้าง Staff ผ่าน POST /staff/create
+// ถ้าไม่ส่ง -password จะอ่านรหัสผ่านจาก stdin เพื่อไม่ให้รหัสผ่านค้างอยู่ใน shell history
+//
+// -role system_admin สร้างผู้ดูแลทะเบียนโรงพยาบาลทั้งระบบ (สร้างได้ทางนี้ทางเดียว) ต้องอยู่ในโรงพยาบาลที่ไม่มี admin
+// และโรงพยาบาลที่มี system_admin จะสร้าง admin ไม่ได้ เพราะ admin รีเซ็ตรหัสผ่านหรือ MFA ของ Staff ในโรงพยาบาลตัวเองได้
+func createAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := fs.String("username", "", "username of the new admin")
+	hospital := fs.String("hospital", "", "hospital the admin belongs to")
+	password := fs.String("password", "", "password (read from stdin if omitted)")
+	role := fs.String("role", string(models.RoleAdmin), "admin or system_admin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *username == "" || *hospital == "" {
+		return errors.New("create-admin: -username and -hospital are required")
+	}
+
+	if r := models.Role(*role); r != models.RoleAdmin && r != models.RoleSystemAdmin {
+		return errors.New("create-admin: -role must be admin or system_admin")
+	}
+
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("create-admin: reading password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if *password == "" {
+		return errors.New("create-admin: password must not be empty")
+	}
+
+	config.ConnectDB()
+	if err := database.MigrateDB(); err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+
+	// โรงพยาบาลต้องลงทะเบียนไว้ก่อนด้วย create-hospital
+	*hospital = models.NormalizeHospitalCode(*hospital)
+	var registered models.Hospital
+	err := config.DB.First(&registered, "code = ?", *hospital).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("create-admin: hospital %q is not registered; run create-hospital first", *hospital)
+	}
+	if err != nil {
+		return err
+	}
+
+	// system_admin เพิ่มได้หลายคน แต่ admin มีได้คนแรกคนเดียวและห้ามอยู่ร่วมกับ system_admin
+	blocking := []models.Role{models.RoleAdmin}
+	if models.Role(*role) == models.RoleAdmin {
+		blocking = append(blocking, models.RoleSystemAdmin)
+	}
+	var existing []models.Role
+	err = config.DB.Model(&models.Staff{}).
+		Scopes(models.HospitalScope(*hospital)).
+		Where("role IN ?", blocking).
+		Distinct("role").
+		Pluck("role", &existing).Error
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(existing) == 0:
+	case models.Role(*role) == models.RoleSystemAdmin:
+		return fmt.Errorf("create-admin: hospital %q has a hospital admin; register a separate hospital for system admins", *hospital)
+	case existing[0] == models.RoleSystemAdmin || len(existing) > 1:
+		return fmt.Errorf("create-admin: hospital %q has system admins and cannot have a hospital admin", *hospital)
+	default:
+		return fmt.Errorf("create-admin: hospital %q already has an admin; use POST /staff/create instead", *hospital)
+	}
+
+	policy, err := services.LoadPasswordPolicy()
+	if err != nil {
+		return fmt.Errorf("create-admin: loading password policy: %w", err)
+	}
+	staff, err := policy.NewStaff(models.Staff{
+		Username: *username,
+		Hospital: *hospital,
+		Role:     models.Role(*role),
+	}, *password)
+	if err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+	staff, err = repository.NewPostgresStaff(config.DB).Create(context.Background(), staff)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return fmt.Errorf("create-admin: username %q already exists", *username)
+	}
+	if err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+
+	fmt.Printf("Staff %q created as %s for hospital %q (id %d)\n", staff.Username, staff.Role, staff.Hospital, staff.ID)
+	return nil
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"HIS-api/config"
+	"HIS-api/database"
+	"HIS-api/encryption"
+)
+
+// หมุนกุญแจหลักของการเข้ารหัสข้อมูลผู้ป่วย แล้วห่อกุญแจข้อมูลของทุกค่าใหม่ด้วยกุญแจใหม่ทีละ batch
+// ถ้ารันค้างกลางทาง ให้รันซ้ำด้วย -rewrap-only เพื่อทำต่อโดยไม่สร้างกุญแจใหม่อีก
+//
+// server ที่รันอยู่ยังเข้ารหัสค่าใหม่ด้วยกุญแจเก่าจนกว่าจะโหลดไฟล์ keyring ใหม่ (ทุก encryption.ReloadInterval)
+// กุญแจเก่าจึงลบออกจาก keyring ได้หลังทุก replica โหลดไฟล์ใหม่แล้ว และรัน -rewrap-only ซ้ำอีกรอบได้ผล 0 ค่าเท่านั้น
+func rotateEncryptionKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-encryption-key", flag.ContinueOnError)
+	batch := fs.Int("batch", 500, "number of patients per transaction")
+	rewrapOnly := fs.Bool("rewrap-only", false, "re-wrap with the current primary key without creating a new key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch < 1 {
+		return errors.New("rotate-encryption-key: -batch must be at least 1")
+	}
+
+	config.ConnectDB()
+	if err := database.MigrateDB(); err != nil {
+		return fmt.Errorf("rotate-encryption-key: %w", err)
+	}
+	keyring := encryption.Default()
+
+	if !*rewrapOnly {
+		kid, err := keyring.Rotate()
+		if err != nil {
+			return fmt.Errorf("rotate-encryption-key: %w", err)
+		}
+		fmt.Printf("New primary key %q written to %s\n", kid, keyring.Path)
+	}
+
+	count, err := database.RewrapPatientIdentifiers(config.DB, keyring, *batch)
+	if err != nil {
+		return fmt.Errorf("rotate-encryption-key: re-wrapped %d values before failing: %w", count, err)
+	}
+
+	fmt.Printf("Re-wrapped %d values with key %q\n", count, keyring.Primary())
+	if count > 0 || !*rewrapOnly {
+		fmt.Printf("Wait %s for every server to reload the keyring, then run again with -rewrap-only; the old key may be removed once it reports 0 values\n", encryption.ReloadInterval)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"HIS-api/config"
+	"HIS-api/database"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+)
+
+// ลงทะเบียนโรงพยาบาลใหม่ ต้องทำก่อน create-admin ของโรงพยาบาลนั้น
+func createHospital(args []string) error {
+	fs := flag.NewFlagSet("create-hospital", flag.ContinueOnError)
+	code := fs.String("code", "", "hospital code used at login and in tokens (normalized to upper case)")
+	nameTH := fs.String("name-th", "", "Thai name")
+	nameEN := fs.String("name-en", "", "English name")
+	hcode := fs.String("hcode", "", "5-digit MOPH hospital code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *code == "" || *nameTH == "" {
+		return errors.New("create-hospital: -code and -name-th are required")
+	}
+
+	config.ConnectDB()
+	if err := database.MigrateDB(); err != nil {
+		return fmt.Errorf("create-hospital: %w", err)
+	}
+
+	hospital := models.Hospital{Code: *code, NameTH: *nameTH, NameEN: *nameEN}
+	if *hcode != "" {
+		hospital.HCode = hcode
+	}
+	hospital, err := services.NewHospital(hospital)
+	if err != nil {
+		return fmt.Errorf("create-hospital: %w", err)
+	}
+	created, err := repository.NewPostgresHospitals(config.DB).Create(context.Background(), hospital)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return fmt.Errorf("create-hospital: hospital code %q or hcode already exists", hospital.Code)
+	}
+	if err != nil {
+		return fmt.Errorf("create-hospital: %w", err)
+	}
+
+	fmt.Printf("Hospital %q created with code %q\n", created.NameTH, created.Code)
+	return nil
+}
+
+// ระงับหรือเปิดใช้งานโรงพยาบาล Staff ของโรงพยาบาลที่ถูกระงับจะใช้งานระบบไม่ได้ทันที
+func setHospitalStatus(args []string) error {
+	fs := flag.NewFlagSet("set-hospital-status", flag.ContinueOnError)
+	code := fs.String("code", "", "hospital code")
+	status := fs.String("status", "", "active or suspended")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *code == "" || *status == "" {
+		return errors.New("set-hospital-status: -code and -status are required")
+	}
+
+	config.ConnectDB()
+	if err := database.MigrateDB(); err != nil {
+		return fmt.Errorf("set-hospital-status: %w", err)
+	}
+
+	s := models.HospitalStatus(*status)
+	normalized := models.NormalizeHospitalCode(*code)
+	hospital, err := repository.NewPostgresHospitals(config.DB).Update(context.Background(), normalized, services.HospitalUpdate{Status: &s}.Apply)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("set-hospital-status: hospital %q not found", normalized)
+	}
+	if err != nil {
+		return fmt.Errorf("set-hospital-status: %w", err)
+	}
+
+	fmt.Printf("Hospital %q is now %s\n", hospital.Code, hospital.Status)
+	return nil
+}
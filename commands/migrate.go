@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"HIS-api/config"
+	"HIS-api/database"
+	"HIS-api/encryption"
+)
+
+// จัดการ migration ของฐานข้อมูล
+//   - up     : รันทุกขั้นที่ยังไม่ได้รัน (เหมือนตอนเปิด server)
+//   - down   : ย้อนขั้นล่าสุดจำนวน -steps ขั้น (หยุดที่ขั้นที่ย้อนกลับไม่ได้)
+//   - status : แสดงว่าขั้นไหนรันแล้วบ้าง
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("migrate: expected up, down or status")
+	}
+
+	switch args[0] {
+	case "up":
+		config.ConnectDB()
+		return database.MigrateDB()
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "number of migrations to revert")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return errors.New("migrate down: -steps must be at least 1")
+		}
+
+		config.ConnectDB()
+		// migration แบบ Go อาจอ่าน/เขียนข้อมูลที่เข้ารหัส
+		if _, err := encryption.Init(); err != nil {
+			return fmt.Errorf("migrate down: %w", err)
+		}
+		reverted, err := database.MigrateDown(config.DB, *steps)
+		if err != nil {
+			return fmt.Errorf("migrate down: reverted %d migrations before failing: %w", len(reverted), err)
+		}
+		fmt.Printf("Reverted %d migrations\n", len(reverted))
+		return nil
+
+	case "status":
+		config.ConnectDB()
+		statuses, err := database.MigrationStatuses(config.DB)
+		if err != nil {
+			return fmt.Errorf("migrate status: %w", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if !s.Known {
+				state += " (unknown to this version)"
+			}
+			fmt.Printf("%04d  %-32s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("migrate: unknown subcommand %q, expected up, down or status", args[0])
+}
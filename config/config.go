@@ -1,41 +1,45 @@
 package config
 
 import (
+	"HIS-api/metrics"
 	"fmt"
-	"log"
-	"os"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"github.com/joho/godotenv"
+	"log"
 )
 
 var DB *gorm.DB
 
+// เชื่อมต่อฐานข้อมูลตาม Current().Database และตั้งขนาด connection pool
 func ConnectDB() {
-	// โหลดไฟล์ .env
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Warning: No .env file found, using system environment variables")
-	}
-
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-
-	if host == "" || user == "" || password == "" || dbname == "" {
+	cfg := Current().Database
+	if cfg.Host == "" || cfg.User == "" || cfg.Password == "" || cfg.Name == "" {
 		panic("Environment Variables not set properly!")
 	}
 
 	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=5432 sslmode=disable",
-		host, user, password, dbname,
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		cfg.Host, cfg.User, cfg.Password, cfg.Name, cfg.Port, cfg.SSLMode,
 	)
 
 	var dbErr error
-	DB, dbErr = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, dbErr = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if dbErr != nil {
 		log.Fatalf("Failed to connect to database: %v", dbErr)
 	}
-	fmt.Println("Database connected successfully.")
+
+	// จับเวลา query และสถิติ connection pool สำหรับ /metrics
+	if err := DB.Use(metrics.GormPlugin{DBName: cfg.Name}); err != nil {
+		log.Fatalf("Failed to register database metrics: %v", err)
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		log.Fatalf("Failed to configure connection pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	log.Println("Database connected successfully.")
 }
@@ -0,0 +1,501 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// การตั้งค่าทั้งหมดของระบบ ลำดับความสำคัญจากต่ำไปสูง:
+// ค่า default -> ไฟล์ YAML (CONFIG_FILE) -> ไฟล์ .env -> environment variable
+// ชื่อ environment variable อยู่ใน tag `env` และชื่อใน YAML อยู่ใน tag `yaml` ฟิลด์ที่มี tag `secret` จะไม่ถูกแสดงใน Redacted
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Tokens     TokenConfig      `yaml:"tokens"`
+	JWT        JWTConfig        `yaml:"jwt"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+	Audit      AuditConfig      `yaml:"audit"`
+	Log        LogConfig        `yaml:"log"`
+	Login      LoginConfig      `yaml:"login"`
+	Password   PasswordConfig   `yaml:"password"`
+	MFA        MFAConfig        `yaml:"mfa"`
+	Lists      ListConfig       `yaml:"lists"`
+}
+
+type ServerConfig struct {
+	ListenAddr     string   `yaml:"listen_addr" env:"LISTEN_ADDR"`
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"` // คั่นด้วย comma ใน env
+	MigrateOnStart bool     `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	// เวลาที่รอ request ที่ค้างอยู่ให้เสร็จหลังได้รับ SIGTERM ต้องสั้นกว่า stop_grace_period ของ docker-compose
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// เวลาที่ยังรับ request ต่อหลัง /readyz เริ่มตอบ 503 ให้ load balancer ที่ตรวจเป็นรอบๆ เลิกส่งงานมาก่อน (0 = ปิดทันที)
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"sslmode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+}
+
+// อายุของ token แต่ละชนิด
+type TokenConfig struct {
+	AccessTTL        time.Duration `yaml:"access_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTTL       time.Duration `yaml:"refresh_ttl" env:"REFRESH_TOKEN_TTL"`
+	MFAChallengeTTL  time.Duration `yaml:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL"`
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+}
+
+// กุญแจเซ็น JWT (ดู package keys) KeysDir ว่างหมายถึงใช้กุญแจชั่วคราวในหน่วยความจำ
+type JWTConfig struct {
+	KeysDir          string        `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+	SigningAlg       string        `yaml:"signing_alg" env:"JWT_SIGNING_ALG"`
+	RotationInterval time.Duration `yaml:"rotation_interval" env:"JWT_KEY_ROTATION_INTERVAL"`
+	Retention        time.Duration `yaml:"retention" env:"JWT_KEY_RETENTION"`
+}
+
+type EncryptionConfig struct {
+	Keyring string `yaml:"keyring" env:"ENCRYPTION_KEYRING"`
+}
+
+type AuditConfig struct {
+	HMACKey string `yaml:"hmac_key" env:"AUDIT_HMAC_KEY" secret:"true"`
+}
+
+// log เป็น JSON ทาง stdout (ดู package logging) Level เป็น debug, info, warn หรือ error
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+// การจำกัดการเดารหัสผ่าน (ดู services.LoginPolicy)
+type LoginConfig struct {
+	FreeFailures    int           `yaml:"free_failures" env:"LOGIN_FREE_FAILURES"`
+	MaxFailures     int           `yaml:"max_failures" env:"LOGIN_MAX_FAILURES"`
+	LockoutDuration time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION"`
+	BaseDelay       time.Duration `yaml:"base_delay" env:"LOGIN_BASE_DELAY"`
+	MaxDelay        time.Duration `yaml:"max_delay" env:"LOGIN_MAX_DELAY"`
+	IPFreeFailures  int           `yaml:"ip_free_failures" env:"LOGIN_IP_FREE_FAILURES"`
+	IPWindow        time.Duration `yaml:"ip_window" env:"LOGIN_IP_WINDOW"`
+}
+
+// นโยบายรหัสผ่าน (ดู services.PasswordPolicy) BreachedList คือไฟล์รหัสผ่านที่รั่วไหล บรรทัดละหนึ่งรหัส (ว่าง = ไม่ตรวจ)
+type PasswordConfig struct {
+	MinLength     int    `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	RequireUpper  bool   `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+	RequireLower  bool   `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+	RequireDigit  bool   `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	RequireSymbol bool   `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+	History       int    `yaml:"history" env:"PASSWORD_HISTORY"`
+	BreachedList  string `yaml:"breached_list" env:"PASSWORD_BREACHED_LIST"`
+}
+
+// RequiredRoles ตั้งเป็นค่าว่าง (MFA_REQUIRED_ROLES=) ได้ หมายถึงไม่บังคับ role ใดเลย
+type MFAConfig struct {
+	RequiredRoles []string `yaml:"required_roles" env:"MFA_REQUIRED_ROLES"`
+	Issuer        string   `yaml:"issuer" env:"MFA_ISSUER"`
+}
+
+// จำนวนรายการต่อหน้าของ endpoint ที่แบ่งหน้า (ค่า default เมื่อไม่ส่ง limit และค่าสูงสุดที่ขอได้)
+type ListConfig struct {
+	PatientSearchDefault int `yaml:"patient_search_default_limit" env:"PATIENT_SEARCH_DEFAULT_LIMIT"`
+	PatientSearchMax     int `yaml:"patient_search_max_limit" env:"PATIENT_SEARCH_MAX_LIMIT"`
+	StaffListDefault     int `yaml:"staff_list_default_limit" env:"STAFF_LIST_DEFAULT_LIMIT"`
+	StaffListMax         int `yaml:"staff_list_max_limit" env:"STAFF_LIST_MAX_LIMIT"`
+	AuditListDefault     int `yaml:"audit_list_default_limit" env:"AUDIT_LIST_DEFAULT_LIMIT"`
+	AuditListMax         int `yaml:"audit_list_max_limit" env:"AUDIT_LIST_MAX_LIMIT"`
+}
+
+// ความยาวขั้นต่ำของกุญแจ HMAC ของ audit log (ไบต์)
+const MinAuditKeyLength = 16
+
+// bcrypt ใช้แค่ 72 byte แรก รหัสผ่านขั้นต่ำจึงยาวกว่านี้ไม่ได้
+const maxPasswordLength = 72
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// ค่า default ของทุกฟิลด์ ฟิลด์ที่ต้องตั้งเอง (เช่น DB_HOST) เป็นค่าว่างและถูกตรวจใน Validate
+func Defaults() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddr:        ":8080",
+			MigrateOnStart:    true,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   25 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Tokens: TokenConfig{
+			AccessTTL:        15 * time.Minute,
+			RefreshTTL:       7 * 24 * time.Hour,
+			MFAChallengeTTL:  5 * time.Minute,
+			PasswordResetTTL: 24 * time.Hour,
+		},
+		JWT: JWTConfig{
+			SigningAlg: "ES256",
+			Retention:  24 * time.Hour,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Login: LoginConfig{
+			FreeFailures:    2,
+			MaxFailures:     5,
+			LockoutDuration: 15 * time.Minute,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+			IPFreeFailures:  10,
+			IPWindow:        15 * time.Minute,
+		},
+		Password: PasswordConfig{
+			MinLength:    12,
+			RequireUpper: true,
+			RequireLower: true,
+			RequireDigit: true,
+			History:      5,
+		},
+		MFA: MFAConfig{
+			RequiredRoles: []string{"admin", "system_admin"},
+			Issuer:        "Agnos-HIS",
+		},
+		Lists: ListConfig{
+			PatientSearchDefault: 20,
+			PatientSearchMax:     100,
+			StaffListDefault:     20,
+			StaffListMax:         100,
+			AuditListDefault:     50,
+			AuditListMax:         200,
+		},
+	}
+}
+
+var (
+	currentMu sync.RWMutex
+	current   *Config
+)
+
+// โหลดการตั้งค่าจากทุกแหล่ง ตรวจความถูกต้อง และเก็บไว้ให้ Current ใช้ เรียกครั้งเดียวตอนเริ่มระบบ
+// ถ้าค่าไม่ครบหรือไม่ถูกต้องจะคืน error ทั้งหมดรวมกัน ระบบควรหยุดทันที
+func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
+	}
+
+	currentMu.Lock()
+	current = cfg
+	currentMu.Unlock()
+	return cfg, nil
+}
+
+// เหมือน Load แต่ไม่เก็บผลไว้เป็น Current
+func Read() (*Config, error) {
+	// .env ไม่ทับ environment variable ที่ตั้งไว้แล้ว ไม่มีไฟล์ก็ได้
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: .env: %w", err)
+	}
+
+	cfg := Defaults()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadYAML(&cfg, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// การตั้งค่าที่โหลดด้วย Load
+// ถ้ายังไม่ได้เรียก Load (เช่นในเทสต์) จะอ่านค่า default และ environment variable ใหม่ทุกครั้งโดยไม่ตรวจความถูกต้อง
+func Current() *Config {
+	currentMu.RLock()
+	cfg := current
+	currentMu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	fallback := Defaults()
+	applyEnv(&fallback)
+	return &fallback
+}
+
+func loadYAML(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	// ชื่อฟิลด์ที่ไม่รู้จักถือว่าผิด เพื่อไม่ให้พิมพ์ผิดแล้วได้ค่า default โดยไม่รู้ตัว
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// ทับค่าด้วย environment variable ที่ตั้งไว้ ค่าว่างถือว่าไม่ได้ตั้ง
+// ยกเว้นรายการ (คั่นด้วย comma) ที่ตั้งเป็นค่าว่างหมายถึงไม่มีรายการเลย
+func applyEnv(cfg *Config) error {
+	var errs []error
+	eachField(cfg, func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		raw, set := os.LookupEnv(name)
+		raw = strings.TrimSpace(raw)
+		if raw == "" && !(set && value.Kind() == reflect.Slice) {
+			return
+		}
+		if err := setField(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func setField(value reflect.Value, raw string) error {
+	switch value.Interface().(type) {
+	case string:
+		value.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(d))
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// เรียก fn กับทุกฟิลด์ของทุก section ใน Config
+func eachField(cfg *Config, fn func(field reflect.StructField, value reflect.Value)) {
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			fn(section.Type().Field(j), section.Field(j))
+		}
+	}
+}
+
+// ตรวจค่าที่จำเป็นและช่วงของค่า คืน error ทุกข้อรวมกันเพื่อให้แก้ได้ในครั้งเดียว
+func (c *Config) Validate() error {
+	var errs []error
+	require := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	positive := func(name string, value time.Duration) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	require("LISTEN_ADDR", c.Server.ListenAddr)
+	positive("READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout)
+	positive("IDLE_TIMEOUT", c.Server.IdleTimeout)
+	positive("SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout)
+	if c.Server.ShutdownDrainDelay < 0 {
+		errs = append(errs, fmt.Errorf("SHUTDOWN_DRAIN_DELAY must not be negative"))
+	}
+
+	require("DB_HOST", c.Database.Host)
+	require("DB_USER", c.Database.User)
+	require("DB_PASSWORD", c.Database.Password)
+	require("DB_NAME", c.Database.Name)
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT must be between 1 and 65535"))
+	}
+	if !contains(sslModes, c.Database.SSLMode) {
+		errs = append(errs, fmt.Errorf("DB_SSLMODE must be one of %s", strings.Join(sslModes, ", ")))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS must be at least 1"))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS"))
+	}
+	positive("DB_CONN_MAX_LIFETIME", c.Database.ConnMaxLifetime)
+	positive("DB_CONN_MAX_IDLE_TIME", c.Database.ConnMaxIdleTime)
+
+	positive("ACCESS_TOKEN_TTL", c.Tokens.AccessTTL)
+	positive("REFRESH_TOKEN_TTL", c.Tokens.RefreshTTL)
+	positive("MFA_CHALLENGE_TTL", c.Tokens.MFAChallengeTTL)
+	positive("PASSWORD_RESET_TTL", c.Tokens.PasswordResetTTL)
+	if c.Tokens.AccessTTL >= c.Tokens.RefreshTTL {
+		errs = append(errs, fmt.Errorf("ACCESS_TOKEN_TTL must be shorter than REFRESH_TOKEN_TTL"))
+	}
+
+	if c.JWT.SigningAlg != "ES256" && c.JWT.SigningAlg != "RS256" {
+		errs = append(errs, fmt.Errorf("JWT_SIGNING_ALG must be ES256 or RS256"))
+	}
+	if c.JWT.RotationInterval < 0 {
+		errs = append(errs, fmt.Errorf("JWT_KEY_ROTATION_INTERVAL must not be negative"))
+	}
+	positive("JWT_KEY_RETENTION", c.JWT.Retention)
+
+	require("ENCRYPTION_KEYRING", c.Encryption.Keyring)
+
+	require("AUDIT_HMAC_KEY", c.Audit.HMACKey)
+	if key := c.Audit.HMACKey; key != "" && len(key) < MinAuditKeyLength {
+		errs = append(errs, fmt.Errorf("AUDIT_HMAC_KEY must be at least %d bytes", MinAuditKeyLength))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error"))
+	}
+
+	atLeast := func(name string, value, min int) {
+		if value < min {
+			errs = append(errs, fmt.Errorf("%s must be at least %d", name, min))
+		}
+	}
+
+	atLeast("LOGIN_FREE_FAILURES", c.Login.FreeFailures, 0)
+	atLeast("LOGIN_MAX_FAILURES", c.Login.MaxFailures, 1)
+	atLeast("LOGIN_IP_FREE_FAILURES", c.Login.IPFreeFailures, 0)
+	positive("LOGIN_LOCKOUT_DURATION", c.Login.LockoutDuration)
+	positive("LOGIN_BASE_DELAY", c.Login.BaseDelay)
+	positive("LOGIN_IP_WINDOW", c.Login.IPWindow)
+	if c.Login.MaxDelay < c.Login.BaseDelay {
+		errs = append(errs, fmt.Errorf("LOGIN_MAX_DELAY must not be shorter than LOGIN_BASE_DELAY"))
+	}
+
+	if c.Password.MinLength < 8 || c.Password.MinLength > maxPasswordLength {
+		errs = append(errs, fmt.Errorf("PASSWORD_MIN_LENGTH must be between 8 and %d", maxPasswordLength))
+	}
+	atLeast("PASSWORD_HISTORY", c.Password.History, 0)
+	if path := c.Password.BreachedList; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("PASSWORD_BREACHED_LIST: %w", err))
+		}
+	}
+
+	require("MFA_ISSUER", c.MFA.Issuer)
+	for _, role := range c.MFA.RequiredRoles {
+		if strings.TrimSpace(role) == "" {
+			errs = append(errs, fmt.Errorf("MFA_REQUIRED_ROLES must not contain empty roles"))
+		}
+	}
+
+	lists := []struct {
+		name              string
+		defaultLimit, max int
+	}{
+		{"PATIENT_SEARCH", c.Lists.PatientSearchDefault, c.Lists.PatientSearchMax},
+		{"STAFF_LIST", c.Lists.StaffListDefault, c.Lists.StaffListMax},
+		{"AUDIT_LIST", c.Lists.AuditListDefault, c.Lists.AuditListMax},
+	}
+	for _, l := range lists {
+		atLeast(l.name+"_DEFAULT_LIMIT", l.defaultLimit, 1)
+		if l.max < l.defaultLimit {
+			errs = append(errs, fmt.Errorf("%s_MAX_LIMIT must not be less than %s_DEFAULT_LIMIT", l.name, l.name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// การตั้งค่าทั้งหมดสำหรับพิมพ์ใน log ตอนเริ่มระบบ บรรทัดละค่า ค่าลับถูกแทนด้วย "[redacted]"
+func (c *Config) Redacted() string {
+	var b strings.Builder
+	c.eachRedacted(func(name, value string) {
+		fmt.Fprintf(&b, "%s=%s\n", name, value)
+	})
+	return b.String()
+}
+
+// ให้ slog แสดง Config เป็น object ของค่าที่ปิดค่าลับแล้ว (เช่น slog.Info("...", "config", cfg))
+func (c *Config) LogValue() slog.Value {
+	var attrs []slog.Attr
+	c.eachRedacted(func(name, value string) {
+		attrs = append(attrs, slog.String(name, value))
+	})
+	return slog.GroupValue(attrs...)
+}
+
+func (c *Config) eachRedacted(fn func(name, value string)) {
+	eachField(c, func(field reflect.StructField, value reflect.Value) {
+		shown := fmt.Sprint(value.Interface())
+		switch {
+		case field.Tag.Get("secret") == "true" && value.String() != "":
+			shown = "[redacted]"
+		case value.Kind() == reflect.Slice:
+			shown = strings.Join(value.Interface().([]string), ",")
+		}
+		fn(field.Tag.Get("env"), shown)
+	})
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/logging"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// บันทึกการเข้าถึงข้อมูลผู้ป่วยลง audit log ใน transaction ของ request
+// ถ้าบันทึกไม่ได้จะตอบ 500 (transaction ถูก rollback) เพราะห้ามเข้าถึงข้อมูลโดยไม่มีบันทึก
+func recordPatientAudit(c *gin.Context, audit repository.AuditLog, action models.AuditAction, patientIDs []uint, query map[string]string) bool {
+	staff, _ := c.Get("staff")
+	claims, _ := staff.(jwt.MapClaims)
+	hospital, _ := claims["hospital"].(string)
+	actorID, ok := currentStaffID(c)
+	if !ok {
+		return false
+	}
+
+	err := audit.Record(c.Request.Context(), services.AuditRecord{
+		Hospital:   hospital,
+		ActorID:    actorID,
+		ActorRole:  currentRole(c),
+		Action:     action,
+		PatientIDs: patientIDs,
+		Query:      query,
+		IP:         c.ClientIP(),
+		RequestID:  logging.RequestID(c.Request.Context()),
+	})
+	if err != nil {
+		requestLogger(c).Error("Recording audit entry failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not record access"})
+		return false
+	}
+	return true
+}
+
+// แถวของ audit log ที่แสดงให้ auditor
+type auditEntryView struct {
+	ID         uint               `json:"id"`
+	Seq        uint64             `json:"seq"`
+	ActorID    uint               `json:"actor_id"`
+	ActorRole  models.Role        `json:"actor_role"`
+	Action     models.AuditAction `json:"action"`
+	PatientIDs []uint             `json:"patient_ids"`
+	Query      map[string]string  `json:"query"`
+	IP         string             `json:"ip"`
+	RequestID  string             `json:"request_id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	PrevHash   string             `json:"prev_hash"`
+	Hash       string             `json:"hash"`
+}
+
+func newAuditEntryView(e models.AuditEntry) auditEntryView {
+	view := auditEntryView{
+		ID:        e.ID,
+		Seq:       e.Seq,
+		ActorID:   e.ActorID,
+		ActorRole: e.ActorRole,
+		Action:    e.Action,
+		IP:        e.IP,
+		RequestID: e.RequestID,
+		CreatedAt: e.CreatedAt,
+		PrevHash:  e.PrevHash,
+		Hash:      e.Hash,
+	}
+	json.Unmarshal([]byte(e.PatientIDs), &view.PatientIDs)
+	json.Unmarshal([]byte(e.Query), &view.Query)
+	return view
+}
+
+// พารามิเตอร์ค้นหา audit log
+// identifier คือค่าที่ระบุตัวบุคคล (เช่นเลขบัตรประชาชน) ระบบจะ HMAC แล้วหาใน query ที่บันทึกไว้
+type listAuditQuery struct {
+	ActorID    uint   `form:"actor_id"`
+	Action     string `form:"action"`
+	PatientID  uint   `form:"patient_id"`
+	RequestID  string `form:"request_id"`
+	Identifier string `form:"identifier"`
+	From       string `form:"from" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To         string `form:"to" binding:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+
+	Limit  int    `form:"limit" binding:"omitempty,min=1"`
+	Sort   string `form:"sort" binding:"omitempty,oneof=seq -seq"`
+	Cursor string `form:"cursor"`
+}
+
+// handler ของการค้นหาและตรวจ audit log
+type AuditHandler struct {
+	audit repository.AuditLog
+}
+
+func NewAuditHandler(audit repository.AuditLog) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// ค้นหา audit log ของโรงพยาบาล (เฉพาะ auditor) เรียงจากล่าสุดก่อนเป็นค่า default
+func (h *AuditHandler) ListAuditEntries(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var query listAuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	filter := repository.AuditFilter{
+		Hospital:  hospital,
+		ActorID:   query.ActorID,
+		Action:    models.AuditAction(query.Action),
+		PatientID: query.PatientID,
+		RequestID: query.RequestID,
+	}
+	if query.Identifier != "" {
+		hashed, err := services.HashIdentifier(query.Identifier)
+		if err != nil {
+			requestLogger(c).Error("Hashing identifier failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching audit log"})
+			return
+		}
+		filter.IdentifierHash = hashed
+	}
+	if query.From != "" {
+		from, _ := time.Parse(time.RFC3339, query.From)
+		filter.From = &from
+	}
+	if query.To != "" {
+		to, _ := time.Parse(time.RFC3339, query.To)
+		filter.To = &to
+	}
+
+	lists := config.Current().Lists
+	limit := pageLimit(query.Limit, lists.AuditListDefault, lists.AuditListMax)
+
+	sort := query.Sort
+	if sort == "" && query.Cursor != "" {
+		sort = repository.CursorSort(query.Cursor)
+	}
+	if sort == "" {
+		sort = "-seq"
+	}
+
+	result, err := h.audit.List(c.Request.Context(), filter, repository.PageRequest{Sort: sort, Limit: limit, Cursor: query.Cursor})
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("List audit entries error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching audit log"})
+		return
+	}
+
+	views := make([]auditEntryView, 0, len(result.Items))
+	for _, e := range result.Items {
+		views = append(views, newAuditEntryView(e))
+	}
+
+	response := gin.H{
+		"entries":  views,
+		"total":    result.Total,
+		"has_more": result.HasMore,
+		"limit":    limit,
+		"sort":     sort,
+	}
+	if result.HasMore {
+		response["next"] = result.Next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ตรวจ hash chain ของ audit log ทั้งหมดของโรงพยาบาล
+func (h *AuditHandler) VerifyAuditLog(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.audit.Verify(c.Request.Context(), hospital)
+	if err != nil {
+		requestLogger(c).Error("Verify audit log error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verification": result})
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"HIS-api/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// เวลาสูงสุดที่รอฐานข้อมูลตอบในการตรวจ readiness
+const readinessTimeout = 2 * time.Second
+
+// ตรวจสุขภาพของ instance สำหรับ docker-compose, nginx หรือ load balancer
+type HealthHandler struct {
+	db       *gorm.DB
+	draining atomic.Bool
+}
+
+func NewHealthHandler(db *gorm.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// หยุดรับ request ใหม่: หลังเรียกแล้ว readiness จะตอบ 503 ให้ตัวกระจายโหลดเลิกส่งงานมา
+// ส่วน request ที่กำลังทำอยู่ยังทำต่อจนเสร็จ (ดู http.Server.Shutdown ใน main)
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// liveness: process ยังทำงานอยู่ ไม่ตรวจฐานข้อมูลเพื่อไม่ให้ถูก restart เพราะฐานข้อมูลล่มชั่วคราว
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readiness: พร้อมรับ request เมื่อยังไม่ถูกสั่งหยุด ฐานข้อมูลตอบ และ migration ที่ binary นี้ต้องการรันครบแล้ว
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+	if h.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database is not configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	sqlDB, err := h.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "database is unreachable"})
+		return
+	}
+
+	version, err := database.SchemaVersion(h.db.WithContext(ctx))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "cannot read schema version"})
+		return
+	}
+	expected, err := database.LatestSchemaVersion()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "unavailable", "error": "cannot load migrations"})
+		return
+	}
+	// schema ที่ใหม่กว่าถือว่าพร้อม เพราะระหว่าง rolling deploy replica รุ่นเก่ายังต้องทำงานต่อหลังรุ่นใหม่ migrate แล้ว
+	if version < expected {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":         "unavailable",
+			"error":          "schema migrations are pending",
+			"schema_version": version,
+			"expected":       expected,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "schema_version": version})
+}
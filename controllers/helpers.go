@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"HIS-api/logging"
+	"HIS-api/tokens"
+	"HIS-api/validators"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// logger ของ request ปัจจุบัน (มี request_id, staff_id และ hospital ที่ middleware ใส่ไว้)
+func requestLogger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
+// ดึงชื่อโรงพยาบาลของ Staff จาก JWT claims ที่ AuthMiddleware ใส่ไว้ใน Context
+// ถ้าไม่พบจะตอบ 401 กลับไปให้เลย และคืนค่า ok = false
+func currentHospital(c *gin.Context) (string, bool) {
+	staff, exists := c.Get("staff")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return "", false
+	}
+
+	claims, ok := staff.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+		return "", false
+	}
+
+	hospital, ok := claims["hospital"].(string)
+	if !ok || hospital == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		return "", false
+	}
+
+	return hospital, true
+}
+
+// แปลงค่าว่างให้เป็น nil สำหรับคอลัมน์ที่เป็น unique แต่ไม่บังคับกรอก
+func nilIfEmpty(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
+
+// ตอบ 400 เมื่อ bind input ไม่ผ่าน พร้อมบอกว่าฟิลด์ไหนผิดถ้าเป็น validation error
+func respondBindError(c *gin.Context, err error) {
+	if fields := validators.FieldErrors(err); fields != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+}
+
+// ดึง ID ของ Staff ที่เรียก API จาก JWT claims
+func currentStaffID(c *gin.Context) (uint, bool) {
+	staff, _ := c.Get("staff")
+	claims, ok := staff.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+
+	id, ok := tokens.StaffID(claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		return 0, false
+	}
+	return id, true
+}
+
+// จำนวนรายการต่อหน้า: ใช้ค่า default ถ้าไม่ได้ส่ง limit มา และไม่เกินค่าสูงสุด
+func pageLimit(requested, defaultLimit, max int) int {
+	if requested == 0 {
+		requested = defaultLimit
+	}
+	if requested > max {
+		return max
+	}
+	return requested
+}
+
+// ตอบ error พร้อม header Retry-After (วินาที ปัดขึ้น)
+func respondRetryAfter(c *gin.Context, status int, message string, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(status, gin.H{"error": message, "retry_after": seconds})
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handler ของข้อมูลโรงพยาบาล
+type HospitalHandler struct {
+	hospitals repository.HospitalRepository
+}
+
+func NewHospitalHandler(hospitals repository.HospitalRepository) *HospitalHandler {
+	return &HospitalHandler{hospitals: hospitals}
+}
+
+// ข้อมูลโรงพยาบาลของ Staff ที่เรียก
+func (h *HospitalHandler) GetHospital(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	record, err := h.hospitals.Find(c.Request.Context(), hospital)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hospital not found"})
+		return
+	case err != nil:
+		requestLogger(c).Error("Load hospital error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load hospital"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hospital": record})
+}
+
+// admin แก้ชื่อหรือ HCODE ของโรงพยาบาลตัวเอง (รหัสแก้ไม่ได้ สถานะแก้ได้โดย system_admin หรือ CLI)
+func (h *HospitalHandler) UpdateHospital(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		NameTH *string `json:"name_th" binding:"omitempty,min=1"`
+		NameEN *string `json:"name_en"`
+		HCode  *string `json:"hcode"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	update := services.HospitalUpdate{
+		NameTH: input.NameTH,
+		NameEN: input.NameEN,
+		HCode:  input.HCode,
+	}
+	record, err := h.hospitals.Update(c.Request.Context(), hospital, update.Apply)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hospital not found"})
+		return
+	case errors.Is(err, services.ErrInvalidHCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hcode must be 5 digits"})
+		return
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hcode is already used by another hospital"})
+		return
+	case err != nil:
+		requestLogger(c).Error("Update hospital error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update hospital"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hospital updated successfully", "hospital": record})
+}
+
+// รูปแบบ HN พร้อมตัวอย่าง HN ถัดไปตามปีปัจจุบัน (เลขรันเป็น 1 เสมอ ไม่ได้ดึงเลขจริง)
+func hnFormatResponse(format models.HNFormat) gin.H {
+	return gin.H{
+		"hn_format": format,
+		"example":   format.Format(services.BuddhistYear(time.Now()), 1),
+	}
+}
+
+// รูปแบบ HN ของโรงพยาบาลตัวเอง (ค่า default ถ้ายังไม่เคยตั้ง)
+func (h *HospitalHandler) GetHNFormat(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	format, err := h.hospitals.HNFormat(c.Request.Context(), hospital)
+	if err != nil {
+		requestLogger(c).Error("Load HN format error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load HN format"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hnFormatResponse(format))
+}
+
+// admin ตั้งรูปแบบ HN ของโรงพยาบาลตัวเอง ต้องส่งครบทุกฟิลด์ มีผลกับผู้ป่วยที่ลงทะเบียนหลังจากนี้
+func (h *HospitalHandler) UpdateHNFormat(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Prefix       string `json:"prefix"`
+		YearDigits   *int   `json:"year_digits" binding:"required"`
+		Separator    string `json:"separator"`
+		NumberDigits *int   `json:"number_digits" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	format := models.HNFormat{
+		Hospital:     hospital,
+		Prefix:       input.Prefix,
+		YearDigits:   *input.YearDigits,
+		Separator:    input.Separator,
+		NumberDigits: *input.NumberDigits,
+	}
+	var formatErr *services.HNFormatError
+	if errors.As(services.ValidateHNFormat(format), &formatErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid HN format", "reasons": formatErr.Reasons})
+		return
+	}
+
+	format, err := h.hospitals.SaveHNFormat(c.Request.Context(), format)
+	if err != nil {
+		requestLogger(c).Error("Update HN format error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update HN format"})
+		return
+	}
+
+	response := hnFormatResponse(format)
+	response["message"] = "HN format updated successfully"
+	c.JSON(http.StatusOK, response)
+}
+
+// ตอบ error จากการลงทะเบียนหรือแก้สถานะโรงพยาบาล คืน true ถ้ามี error และตอบกลับไปแล้ว
+func respondHospitalError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hospital not found"})
+	case errors.Is(err, services.ErrInvalidHospitalCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hospital code"})
+	case errors.Is(err, services.ErrInvalidHCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hcode must be 5 digits"})
+	case errors.Is(err, services.ErrInvalidHospitalStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or suspended"})
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hospital code or hcode already exists"})
+	default:
+		requestLogger(c).Error("Hospital registry error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update hospital"})
+	}
+	return true
+}
+
+// system_admin ดูรายชื่อโรงพยาบาลทั้งหมด กรองด้วย status ได้
+func (h *HospitalHandler) ListHospitals(c *gin.Context) {
+	var query struct {
+		Status models.HospitalStatus `form:"status"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if query.Status != "" && !query.Status.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or suspended"})
+		return
+	}
+
+	hospitals, err := h.hospitals.List(c.Request.Context(), query.Status)
+	if err != nil {
+		requestLogger(c).Error("List hospitals error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching hospitals"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hospitals": hospitals, "total": len(hospitals)})
+}
+
+// system_admin ลงทะเบียนโรงพยาบาลใหม่ (เหมือนคำสั่ง CLI create-hospital) แล้วสร้าง admin คนแรกด้วย create-admin
+func (h *HospitalHandler) CreateHospital(c *gin.Context) {
+	var input struct {
+		Code   string                `json:"code" binding:"required"`
+		NameTH string                `json:"name_th" binding:"required"`
+		NameEN string                `json:"name_en"`
+		HCode  *string               `json:"hcode"`
+		Status models.HospitalStatus `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	record, err := services.NewHospital(models.Hospital{
+		Code:   input.Code,
+		NameTH: input.NameTH,
+		NameEN: input.NameEN,
+		HCode:  nilIfEmpty(input.HCode),
+		Status: input.Status,
+	})
+	if respondHospitalError(c, err) {
+		return
+	}
+	record, err = h.hospitals.Create(c.Request.Context(), record)
+	if respondHospitalError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Hospital created successfully", "hospital": record})
+}
+
+// system_admin ระงับหรือเปิดใช้งานโรงพยาบาล Staff ของโรงพยาบาลที่ถูกระงับใช้ token เดิมไม่ได้ทันที
+func (h *HospitalHandler) SetHospitalStatus(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status models.HospitalStatus `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	// ระงับโรงพยาบาลของตัวเองจะทำให้ไม่มีใครเปิดคืนได้นอกจากผ่าน CLI
+	code := models.NormalizeHospitalCode(c.Param("code"))
+	if code == hospital && input.Status != models.HospitalActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot suspend your own hospital"})
+		return
+	}
+
+	record, err := h.hospitals.Update(c.Request.Context(), code, services.HospitalUpdate{Status: &input.Status}.Apply)
+	if respondHospitalError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hospital status updated successfully", "hospital": record})
+}
@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"HIS-api/keys"
+
+	"github.com/gin-gonic/gin"
+)
+
+// เผยแพร่ public key สำหรับให้ service อื่นตรวจ JWT ที่ระบบนี้ออกให้
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(keys.JWKSMaxAge.Seconds())))
+	c.JSON(http.StatusOK, keys.Default().JWKS())
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"HIS-api/metrics"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+	"HIS-api/tokens"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ตอบกลับว่าการเข้าสู่ระบบยังไม่จบ ต้องทำขั้นตอน MFA ต่อด้วย token ชั่วคราว
+func respondMFAChallenge(c *gin.Context, staff models.Staff, typ string, message string) {
+	challenge, err := tokens.IssueChallengeToken(staff, typ)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	response := gin.H{
+		"message":    message,
+		"mfa_token":  challenge,
+		"expires_in": int(tokens.ChallengeTokenTTL().Seconds()),
+	}
+	if typ == tokens.TypeMFAEnroll {
+		response["mfa_enrollment_required"] = true
+	} else {
+		response["mfa_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ขั้นที่สองของการเข้าสู่ระบบ: ยืนยันรหัส TOTP หรือรหัสกู้คืน แล้วออก token จริง
+func (h *AuthHandler) VerifyMFALogin(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "") == (input.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and either code or recovery_code are required"})
+		return
+	}
+
+	claims, err := tokens.ParseToken(input.MFAToken, tokens.TypeMFA)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA token"})
+		return
+	}
+	jti, _ := claims["jti"].(string)
+	revoked, err := h.staff.IsRevoked(c.Request.Context(), jti)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+		return
+	}
+	staffID, ok := tokens.StaffID(claims)
+	if revoked || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA token"})
+		return
+	}
+
+	staff, err := h.staff.FindByID(c.Request.Context(), staffID)
+	if err != nil || !staff.Active() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA token"})
+		return
+	}
+	// รหัสผ่านถูกเปลี่ยนหรือรีเซ็ตหลังได้ mfa_token มา ต้อง login ใหม่ด้วยรหัสใหม่
+	if staff.PasswordChangedAt != nil && tokens.IssuedBefore(claims, *staff.PasswordChangedAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA token"})
+		return
+	}
+
+	// ใช้ตัวนับการใส่ผิดชุดเดียวกับรหัสผ่าน เพื่อกันการเดารหัส 6 หลัก
+	// จองสิทธิ์ลองก่อนตรวจรหัส request ที่ยิงพร้อมกันจึงต้องผ่านการหน่วงและการล็อกทีละครั้ง
+	// บัญชีที่ถูกล็อกหรือยังอยู่ในช่วงหน่วงได้คำตอบเดียวกับรหัสผิด เหมือนขั้นรหัสผ่าน
+	policy := services.LoginPolicyFromConfig()
+	ip := c.ClientIP()
+	now := time.Now()
+	staff, wait, err := h.beginLoginAttempt(c, policy, staff.ID, now)
+	if err != nil {
+		requestLogger(c).Error("Login throttle check failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify MFA code"})
+		return
+	}
+	if wait > 0 {
+		h.recordThrottledLogin(c, metrics.LoginStageMFA, staff.Username, staff.Hospital, ip)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA code"})
+		return
+	}
+
+	if input.RecoveryCode != "" {
+		err = h.staff.UseRecoveryCode(c.Request.Context(), staff.ID, services.HashRecoveryCode(input.RecoveryCode))
+	} else {
+		_, err = h.staff.UpdateMFA(c.Request.Context(), staff.ID, func(s *models.Staff) ([]string, error) {
+			return nil, services.VerifyMFACode(s, input.Code, now)
+		})
+	}
+	if errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrMFANotEnrolled) || errors.Is(err, repository.ErrNotFound) {
+		h.recordLoginAttempt(c, metrics.LoginStageMFA, staff.Username, staff.Hospital, ip, false)
+		h.failLoginAttempt(c, policy, staff.ID, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA code"})
+		return
+	}
+	if err != nil {
+		h.releaseLoginAttempt(c, staff)
+		requestLogger(c).Error("MFA verification error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify MFA code"})
+		return
+	}
+
+	// mfa_token ใช้ได้ครั้งเดียว
+	if err := h.staff.RevokeToken(c.Request.Context(), claims); err != nil {
+		requestLogger(c).Error("Revoke MFA token error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify MFA code"})
+		return
+	}
+
+	metrics.RecordLogin(metrics.LoginStageMFA, metrics.LoginSuccess)
+	h.completeLogin(c, staff)
+}
+
+// เริ่มลงทะเบียน MFA: คืน secret และ otpauth:// URI สำหรับสร้าง QR code
+func (h *AuthHandler) EnrollMFA(c *gin.Context) {
+	staffID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+
+	var secret, uri string
+	_, err := h.staff.UpdateMFA(c.Request.Context(), staffID, func(s *models.Staff) ([]string, error) {
+		var err error
+		secret, uri, err = services.BeginMFAEnrollment(s)
+		return nil, err
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("MFA enrollment error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start MFA enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Scan the QR code with an authenticator app, then confirm with /staff/mfa/activate",
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+// ยืนยันรหัสจากแอปเพื่อเปิดใช้ MFA และคืนรหัสกู้คืน (แสดงครั้งเดียว)
+// ถ้าเรียกด้วย token mfa_enroll จากตอน login จะออก token จริงให้ด้วย
+func (h *AuthHandler) ActivateMFA(c *gin.Context) {
+	staffID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	// รหัสกู้คืนจะคืนให้เพียงครั้งนี้ครั้งเดียว ที่เก็บไว้มีเฉพาะ hash
+	codes, hashes, err := services.NewRecoveryCodes()
+	if err == nil {
+		_, err = h.staff.UpdateMFA(c.Request.Context(), staffID, func(s *models.Staff) ([]string, error) {
+			return hashes, services.ActivateMFA(s, input.Code, time.Now())
+		})
+	}
+	switch {
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+		return
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment with /staff/mfa/enroll first"})
+		return
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid MFA code"})
+		return
+	case err != nil:
+		requestLogger(c).Error("MFA activation error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not activate MFA"})
+		return
+	}
+
+	response := gin.H{"message": "MFA enabled", "recovery_codes": codes}
+
+	if typ, _ := c.Get("token_type"); typ == tokens.TypeMFAEnroll {
+		staff, _ := c.Get("staff")
+		claims, _ := staff.(jwt.MapClaims)
+		if err := h.staff.RevokeToken(c.Request.Context(), claims); err != nil {
+			requestLogger(c).Error("Revoke MFA token error", "error", err)
+		}
+
+		stored, err := h.staff.FindByID(c.Request.Context(), staffID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		result, err := h.loginResult(c, stored)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		for k, v := range result {
+			response[k] = v
+		}
+		response["message"] = "MFA enabled"
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// admin ล้าง MFA ของ Staff ในโรงพยาบาลตัวเอง
+func (h *AuthHandler) ResetStaffMFA(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		return
+	}
+
+	_, err = h.staff.UpdateMFA(c.Request.Context(), uint(id), func(s *models.Staff) ([]string, error) {
+		if s.Hospital != hospital {
+			return nil, repository.ErrNotFound
+		}
+		services.ResetMFA(s)
+		return []string{}, nil
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Reset MFA error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reset MFA"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA reset successfully"})
+}
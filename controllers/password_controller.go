@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// โหลดนโยบายรหัสผ่าน ถ้าโหลดไม่ได้ (เช่น ไฟล์รายการรหัสผ่านรั่วไหลหาย) จะตอบ 500
+func passwordPolicy(c *gin.Context) (services.PasswordPolicy, bool) {
+	policy, err := services.LoadPasswordPolicy()
+	if err != nil {
+		requestLogger(c).Error("Loading password policy failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not load password policy"})
+		return policy, false
+	}
+	return policy, true
+}
+
+func respondPasswordPolicyError(c *gin.Context, err *services.PasswordPolicyError) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet policy", "reasons": err.Reasons})
+}
+
+// ตอบ error จากการตั้งรหัสผ่านใหม่ คืน true ถ้ามี error และตอบกลับไปแล้ว
+func respondSetPasswordError(c *gin.Context, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &policyErr):
+		respondPasswordPolicyError(c, policyErr)
+	case errors.Is(err, services.ErrPasswordReused):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password was used recently, choose a different one"})
+	default:
+		requestLogger(c).Error("Set password error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change password"})
+	}
+	return true
+}
+
+// Staff เปลี่ยนรหัสผ่านของตัวเอง session อื่นทั้งหมดจะถูก revoke และได้ token ชุดใหม่กลับไป
+// ใช้ได้ทั้ง access token และ token password_change ที่ได้ตอน login เมื่อถูกบังคับเปลี่ยนรหัสผ่าน
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	staffID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "current_password and new_password are required"})
+		return
+	}
+
+	policy, ok := passwordPolicy(c)
+	if !ok {
+		return
+	}
+
+	// ใช้ตัวนับการใส่ผิดชุดเดียวกับ login กันการเดารหัสผ่านด้วย token ที่ถูกขโมย
+	// จองสิทธิ์ลองก่อนตรวจรหัสผ่านเดิมเหมือนตอน login
+	loginPolicy := services.LoginPolicyFromConfig()
+	now := time.Now()
+	staff, wait, err := h.beginLoginAttempt(c, loginPolicy, staffID, now)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Login throttle check failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change password"})
+		return
+	}
+	if wait > 0 {
+		respondRetryAfter(c, http.StatusTooManyRequests, "Too many failed attempts, try again later", wait)
+		return
+	}
+
+	_, err = h.staff.SetPassword(c.Request.Context(), staff.ID, policy.History, func(s models.Staff, history []string) (string, error) {
+		return policy.ChangePassword(s, history, input.CurrentPassword, input.NewPassword)
+	})
+	if errors.Is(err, services.ErrWrongPassword) {
+		h.failLoginAttempt(c, loginPolicy, staff.ID, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if err != nil {
+		// รหัสผ่านเดิมถูกแต่รหัสใหม่ไม่ผ่านนโยบาย ไม่นับเป็นการใส่ผิด
+		h.releaseLoginAttempt(c, staff)
+	}
+	if respondSetPasswordError(c, err) {
+		return
+	}
+
+	// รหัสผ่านเปลี่ยนแล้ว session เดิมทุกเครื่องใช้ไม่ได้อีก
+	staffClaims, _ := c.Get("staff")
+	if claims, ok := staffClaims.(jwt.MapClaims); ok {
+		if err := h.staff.RevokeToken(c.Request.Context(), claims); err != nil {
+			requestLogger(c).Error("Revoke access token error", "error", err)
+		}
+	}
+	if err := h.staff.RevokeSessions(c.Request.Context(), staff.ID); err != nil {
+		requestLogger(c).Error("Revoke refresh tokens error", "error", err)
+	}
+
+	staff, err = h.staff.FindByID(c.Request.Context(), staff.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	h.clearLoginFailures(c, staff)
+	h.issueSession(c, staff, "", "Password changed successfully")
+}
+
+// admin รีเซ็ตรหัสผ่านของ Staff ในโรงพยาบาลตัวเอง รหัสเดิมและ session เดิมใช้ไม่ได้ทันที
+// คืน reset_token ให้ admin ส่งต่อให้ Staff ทางช่องทางอื่น (แสดงครั้งเดียว)
+func (h *AuthHandler) ResetStaffPassword(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+	actorID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		return
+	}
+
+	reset, err := services.NewPasswordReset(actorID, time.Now())
+	if err == nil {
+		err = h.staff.IssuePasswordReset(c.Request.Context(), hospital, uint(id), reset)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Password reset error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not reset password"})
+		return
+	}
+
+	if err := h.staff.RevokeSessions(c.Request.Context(), uint(id)); err != nil {
+		requestLogger(c).Error("Revoke refresh tokens error", "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Password reset, send the reset token to the staff member",
+		"reset_token": reset.Token,
+		"expires_at":  reset.Record.ExpiresAt,
+	})
+}
+
+// Staff ตั้งรหัสผ่านใหม่ด้วย reset token ที่ได้จาก admin แล้วค่อย login ด้วยรหัสใหม่
+func (h *AuthHandler) CompletePasswordReset(c *gin.Context) {
+	var input struct {
+		ResetToken  string `json:"reset_token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reset_token and new_password are required"})
+		return
+	}
+
+	policy, ok := passwordPolicy(c)
+	if !ok {
+		return
+	}
+
+	_, err := h.staff.ResetPassword(c.Request.Context(), services.HashResetToken(input.ResetToken), policy.History, func(s models.Staff, history []string) (string, error) {
+		return policy.HashNewPassword(s, history, input.NewPassword)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if respondSetPasswordError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in"})
+}
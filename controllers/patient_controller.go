@@ -1,117 +1,450 @@
 package controllers
 
 import (
-	"log"
+	"HIS-api/config"
+	"HIS-api/metrics"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"errors"
+	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"HIS-api/models"
-	"HIS-api/config"
 )
 
-func SearchPatient(c *gin.Context) {
-	// ดึงข้อมูล Staff จาก Context
-	staff, exists := c.Get("staff")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+// handler ของ API ผู้ป่วย ข้อมูลผ่าน repository ที่ส่งเข้ามา
+// (main ใช้ Postgres ส่วนการทดสอบใช้ repository.NewMemoryPatients ได้โดยไม่ต้องมีฐานข้อมูล)
+type PatientHandler struct {
+	patients repository.PatientRepository
+	audit    repository.AuditLog
+}
+
+func NewPatientHandler(patients repository.PatientRepository, audit repository.AuditLog) *PatientHandler {
+	return &PatientHandler{patients: patients, audit: audit}
+}
+
+// พารามิเตอร์ค้นหาผู้ป่วย เลขบัตรประชาชนและหนังสือเดินทางต้องผ่านการตรวจรูปแบบก่อน query
+type searchPatientQuery struct {
+	NationalID  string `form:"national_id" binding:"omitempty,thai_national_id"`
+	PassportID  string `form:"passport_id" binding:"omitempty,passport"`
+	FirstName   string `form:"first_name"`
+	MiddleName  string `form:"middle_name"`
+	LastName    string `form:"last_name"`
+	DateOfBirth string `form:"date_of_birth"`
+	PhoneNumber string `form:"phone_number"`
+	Email       string `form:"email"`
+
+	// การแบ่งหน้า: cursor คือค่า next จากหน้าก่อน ต้องใช้คู่กับ sort เดิม
+	Limit  int    `form:"limit" binding:"omitempty,min=1"`
+	Sort   string `form:"sort" binding:"omitempty,oneof=name -name dob -dob hn -hn created_at -created_at"`
+	Cursor string `form:"cursor"`
+}
+
+// พารามิเตอร์ค้นหาที่บันทึกใน audit log (ใช้ limit และ sort ที่ใช้จริง)
+func (q searchPatientQuery) auditParams(limit int, sort string) map[string]string {
+	return map[string]string{
+		"national_id":   q.NationalID,
+		"passport_id":   q.PassportID,
+		"first_name":    q.FirstName,
+		"middle_name":   q.MiddleName,
+		"last_name":     q.LastName,
+		"date_of_birth": q.DateOfBirth,
+		"phone_number":  q.PhoneNumber,
+		"email":         q.Email,
+		"cursor":        q.Cursor,
+		"limit":         strconv.Itoa(limit),
+		"sort":          sort,
 	}
+}
 
-	claims, ok := staff.(jwt.MapClaims)
+// filter ของ repository จากพารามิเตอร์ค้นหา คืน ok = false ถ้าไม่มีเงื่อนไขใดเลย
+func (q searchPatientQuery) filter(hospital string, dob *time.Time) (repository.PatientFilter, bool) {
+	filter := repository.PatientFilter{
+		Hospital:    hospital,
+		NationalID:  q.NationalID,
+		PassportID:  q.PassportID,
+		FirstName:   q.FirstName,
+		MiddleName:  q.MiddleName,
+		LastName:    q.LastName,
+		DateOfBirth: dob,
+		PhoneNumber: q.PhoneNumber,
+		Email:       q.Email,
+	}
+	ok := dob != nil || q.NationalID != "" || q.PassportID != "" || q.FirstName != "" || q.MiddleName != "" ||
+		q.LastName != "" || q.PhoneNumber != "" || q.Email != ""
+	return filter, ok
+}
+
+func (h *PatientHandler) SearchPatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
 		return
 	}
 
-	hospital, ok := claims["hospital"].(string)
+	var query searchPatientQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	// ตรวจสอบและแปลง date_of_birth
+	var dob *time.Time
+	if dobStr := query.DateOfBirth; dobStr != "" {
+		parsed, err := time.Parse("2006-01-02", dobStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date_of_birth format. Use YYYY-MM-DD"})
+			return
+		}
+		dob = &parsed
+	}
+
+	// ป้องกันการ Query ข้อมูลทั้งหมดถ้าไม่มีเงื่อนไขใดเลย
+	filter, ok := query.filter(hospital, dob)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one search criteria is required"})
+		return
+	}
+
+	// จำนวนต่อหน้าไม่เกินค่าที่ตั้งไว้ใน PATIENT_SEARCH_MAX_LIMIT
+	lists := config.Current().Lists
+	limit := pageLimit(query.Limit, lists.PatientSearchDefault, lists.PatientSearchMax)
+
+	// ถ้าส่ง cursor มาโดยไม่ระบุ sort ให้ใช้ sort ที่ติดมากับ cursor
+	sort := query.Sort
+	if sort == "" && query.Cursor != "" {
+		sort = repository.CursorSort(query.Cursor)
+	}
+	if sort == "" {
+		sort = "created_at"
+	}
+
+	result, err := h.patients.Search(c.Request.Context(), filter, repository.PageRequest{Sort: sort, Limit: limit, Cursor: query.Cursor})
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Database Query Error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching patients"})
 		return
 	}
 
-	log.Println("Searching for patients in hospital:", hospital)
+	metrics.ObservePatientSearch(len(result.Items))
 
-	// กำหนดเงื่อนไขการค้นหา
-	conditions := []string{}
-	args := []interface{}{}
+	response := gin.H{
+		"patients": patientViews(c, result.Items),
+		"total":    result.Total,
+		"has_more": result.HasMore,
+		"limit":    limit,
+		"sort":     sort,
+	}
+	if result.HasMore {
+		response["next"] = result.Next
+	}
 
-	if nationalID := c.Query("national_id"); nationalID != "" {
-		conditions = append(conditions, "national_id = ?")
-		args = append(args, nationalID)
+	// บันทึกว่าใครค้นอะไรและเห็นผู้ป่วยคนไหนบ้าง (ค่าที่ระบุตัวบุคคลถูก HMAC ก่อนบันทึก)
+	ids := make([]uint, 0, len(result.Items))
+	for _, p := range result.Items {
+		ids = append(ids, p.ID)
 	}
-	if passportID := c.Query("passport_id"); passportID != "" {
-		conditions = append(conditions, "passport_id = ?")
-		args = append(args, passportID)
+	if !recordPatientAudit(c, h.audit, models.AuditPatientSearch, ids, query.auditParams(limit, sort)) {
+		return
 	}
-	if firstName := c.Query("first_name"); firstName != "" {
-		conditions = append(conditions, "(first_name_th ILIKE ? OR first_name_en ILIKE ?)")
-		args = append(args, "%"+firstName+"%", "%"+firstName+"%")
+
+	// ตรวจสอบว่ามีผู้ป่วยที่พบหรือไม่
+	if len(result.Items) == 0 {
+		response["message"] = "Patients not found"
 	}
-	if middleName := c.Query("middle_name"); middleName != "" {
-		conditions = append(conditions, "(middle_name_th ILIKE ? OR middle_name_en ILIKE ?)")
-		args = append(args, "%"+middleName+"%", "%"+middleName+"%")
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ข้อมูลที่รับเข้ามาตอนสร้างหรือแก้ไขผู้ป่วยทั้งหมด (PUT)
+// PatientHN ไม่รับจาก client เพราะระบบออกให้เองตอนลงทะเบียน
+type patientInput struct {
+	FirstNameTH  string  `json:"first_name_th" binding:"required"`
+	MiddleNameTH string  `json:"middle_name_th"`
+	LastNameTH   string  `json:"last_name_th" binding:"required"`
+	FirstNameEN  string  `json:"first_name_en"`
+	MiddleNameEN string  `json:"middle_name_en"`
+	LastNameEN   string  `json:"last_name_en"`
+	DateOfBirth  string  `json:"date_of_birth" binding:"required,datetime=2006-01-02"`
+	NationalID   *string `json:"national_id" binding:"omitempty,thai_national_id"`
+	PassportID   *string `json:"passport_id" binding:"omitempty,passport"`
+	PhoneNumber  string  `json:"phone_number" binding:"required"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	Gender       string  `json:"gender" binding:"required,oneof=M F"`
+}
+
+// ข้อมูลที่รับเข้ามาตอนแก้ไขบางส่วน (PATCH) ฟิลด์ที่ไม่ส่งมาจะไม่ถูกแก้
+type patientPatchInput struct {
+	FirstNameTH  *string `json:"first_name_th" binding:"omitempty,min=1"`
+	MiddleNameTH *string `json:"middle_name_th"`
+	LastNameTH   *string `json:"last_name_th" binding:"omitempty,min=1"`
+	FirstNameEN  *string `json:"first_name_en"`
+	MiddleNameEN *string `json:"middle_name_en"`
+	LastNameEN   *string `json:"last_name_en"`
+	DateOfBirth  *string `json:"date_of_birth" binding:"omitempty,datetime=2006-01-02"`
+	NationalID   *string `json:"national_id" binding:"omitempty,thai_national_id"`
+	PassportID   *string `json:"passport_id" binding:"omitempty,passport"`
+	PhoneNumber  *string `json:"phone_number" binding:"omitempty,min=1"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	Gender       *string `json:"gender" binding:"omitempty,oneof=M F"`
+}
+
+func (in patientInput) apply(p *models.Patient) {
+	dob, _ := time.Parse("2006-01-02", in.DateOfBirth) // ผ่าน binding datetime มาแล้ว
+	p.FirstNameTH = in.FirstNameTH
+	p.MiddleNameTH = in.MiddleNameTH
+	p.LastNameTH = in.LastNameTH
+	p.FirstNameEN = in.FirstNameEN
+	p.MiddleNameEN = in.MiddleNameEN
+	p.LastNameEN = in.LastNameEN
+	p.DateOfBirth = dob
+	p.NationalID = nilIfEmpty(in.NationalID)
+	p.PassportID = nilIfEmpty(in.PassportID)
+	p.PhoneNumber = in.PhoneNumber
+	p.Email = nilIfEmpty(in.Email)
+	p.Gender = in.Gender
+}
+
+func (in patientPatchInput) apply(p *models.Patient) bool {
+	changed := false
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+			changed = true
+		}
 	}
-	if lastName := c.Query("last_name"); lastName != "" {
-		conditions = append(conditions, "(last_name_th ILIKE ? OR last_name_en ILIKE ?)")
-		args = append(args, "%"+lastName+"%", "%"+lastName+"%")
+	setNullable := func(dst **string, src *string) {
+		if src != nil {
+			*dst = nilIfEmpty(src)
+			changed = true
+		}
 	}
 
-	// ตรวจสอบและแปลง date_of_birth
-	if dobStr := c.Query("date_of_birth"); dobStr != "" {
-		dob, err := time.Parse("2006-01-02", dobStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date_of_birth format. Use YYYY-MM-DD"})
+	setString(&p.FirstNameTH, in.FirstNameTH)
+	setString(&p.MiddleNameTH, in.MiddleNameTH)
+	setString(&p.LastNameTH, in.LastNameTH)
+	setString(&p.FirstNameEN, in.FirstNameEN)
+	setString(&p.MiddleNameEN, in.MiddleNameEN)
+	setString(&p.LastNameEN, in.LastNameEN)
+	setString(&p.PhoneNumber, in.PhoneNumber)
+	setString(&p.Gender, in.Gender)
+	setNullable(&p.NationalID, in.NationalID)
+	setNullable(&p.PassportID, in.PassportID)
+	setNullable(&p.Email, in.Email)
+
+	if in.DateOfBirth != nil {
+		p.DateOfBirth, _ = time.Parse("2006-01-02", *in.DateOfBirth)
+		changed = true
+	}
+	return changed
+}
+
+// บันทึกผู้ป่วยหลังตรวจสอบข้อมูลซ้ำ แล้วตอบกลับตาม status ที่กำหนด
+// ผู้ป่วยใหม่ที่ยังไม่มี HN จะได้ HN ตอนบันทึก
+func (h *PatientHandler) savePatient(c *gin.Context, patient *models.Patient, status int, action models.AuditAction) {
+	ctx := c.Request.Context()
+	field, err := h.patients.DuplicateField(ctx, patient)
+	if err != nil {
+		requestLogger(c).Error("Database Query Error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving patient"})
+		return
+	}
+	if field != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + " already exists"})
+		return
+	}
+
+	if err := h.patients.Save(ctx, patient); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Patient with the same identifiers already exists"})
 			return
 		}
-		conditions = append(conditions, "date_of_birth = ?")
-		args = append(args, dob)
+		requestLogger(c).Error("Database Save Error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving patient"})
+		return
+	}
+	if !recordPatientAudit(c, h.audit, action, []uint{patient.ID}, nil) {
+		return
 	}
 
-	if phone := c.Query("phone_number"); phone != "" {
-		conditions = append(conditions, "phone_number = ?")
-		args = append(args, phone)
+	c.JSON(status, gin.H{"patient": newPatientView(*patient, currentRole(c), nil)})
+}
+
+// ดึงผู้ป่วยตาม :id โดยจำกัดเฉพาะโรงพยาบาลของ Staff
+// ถ้าไม่พบ (หรืออยู่โรงพยาบาลอื่น) จะตอบ 404 และคืนค่า ok = false
+func (h *PatientHandler) findPatient(c *gin.Context, hospital string) (*models.Patient, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid patient ID"})
+		return nil, false
+	}
+
+	patient, err := h.patients.Find(c.Request.Context(), hospital, uint(id))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return nil, false
+	}
+	if err != nil {
+		requestLogger(c).Error("Database Query Error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching patient"})
+		return nil, false
 	}
-	if email := c.Query("email"); email != "" {
-		conditions = append(conditions, "email = ?")
-		args = append(args, email)
+	return &patient, true
+}
+
+func (h *PatientHandler) CreatePatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
 	}
 
-	// ป้องกันการ Query ข้อมูลทั้งหมดถ้าไม่มีเงื่อนไขใดเลย
-	if len(conditions) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one search criteria is required"})
+	var input patientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
-	// ใช้ strings.Join() เพื่อสร้าง Query String ที่ปลอดภัย
-	queryStr := strings.Join(conditions, " AND ")
+	// ผู้ป่วยใหม่จะอยู่ในโรงพยาบาลเดียวกับ Staff เสมอ
+	patient := models.Patient{Hospital: hospital}
+	input.apply(&patient)
 
-	// Query ข้อมูลจาก DB
-	var patients []models.Patient
-	if err := config.DB.Where(queryStr, args...).Find(&patients).Error; err != nil {
-		log.Println("Database Query Error:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching patients"})
+	h.savePatient(c, &patient, http.StatusCreated, models.AuditPatientCreate)
+}
+
+func (h *PatientHandler) GetPatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
 		return
 	}
 
-	// ตรวจสอบว่ามีผู้ป่วยที่พบหรือไม่
-	if len(patients) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"message":  "Patients not found",
-			"patients": []models.Patient{},
-		})
+	patient, ok := h.findPatient(c, hospital)
+	if !ok {
+		return
+	}
+	if !recordPatientAudit(c, h.audit, models.AuditPatientView, []uint{patient.ID}, nil) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"patient": newPatientView(*patient, currentRole(c), nil)})
+}
+
+// ดูฟิลด์อ่อนไหวของผู้ป่วยแบบเต็ม ต้องระบุวัตถุประสงค์ และทุกครั้งถูกบันทึกใน audit log
+// fields ระบุฟิลด์ที่ต้องการดู ถ้าไม่ส่งมาจะเปิดทุกฟิลด์
+func (h *PatientHandler) RevealPatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
 		return
 	}
 
-	// ตรวจสอบว่า Staff กำลังค้นหาผู้ป่วยจากโรงพยาบาลตัวเอง
-	for _, patient := range patients {
-		if patient.Hospital != hospital {
-			log.Println("Unauthorized access attempt! Staff from", hospital, "tried to access patient in", patient.Hospital)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: You can only search for patients in your own hospital"})
+	var input struct {
+		Purpose models.RevealPurpose    `json:"purpose" binding:"required"`
+		Fields  []models.SensitiveField `json:"fields"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !input.Purpose.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purpose"})
+		return
+	}
+	if len(input.Fields) == 0 {
+		input.Fields = models.SensitiveFields
+	}
+	revealed := map[models.SensitiveField]bool{}
+	names := make([]string, 0, len(input.Fields))
+	for _, field := range input.Fields {
+		if !field.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field: " + string(field)})
 			return
 		}
+		if !revealed[field] {
+			revealed[field] = true
+			names = append(names, string(field))
+		}
+	}
+
+	patient, ok := h.findPatient(c, hospital)
+	if !ok {
+		return
+	}
+	query := map[string]string{"purpose": string(input.Purpose), "fields": strings.Join(names, ",")}
+	if !recordPatientAudit(c, h.audit, models.AuditPatientReveal, []uint{patient.ID}, query) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"patient": newPatientView(*patient, currentRole(c), revealed)})
+}
+
+func (h *PatientHandler) UpdatePatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	patient, ok := h.findPatient(c, hospital)
+	if !ok {
+		return
+	}
+
+	var input patientInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	input.apply(patient)
+
+	h.savePatient(c, patient, http.StatusOK, models.AuditPatientUpdate)
+}
+
+func (h *PatientHandler) PatchPatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	patient, ok := h.findPatient(c, hospital)
+	if !ok {
+		return
+	}
+
+	var input patientPatchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !input.apply(patient) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	h.savePatient(c, patient, http.StatusOK, models.AuditPatientUpdate)
+}
+
+// ลบแบบ soft delete (gorm.Model จะเซ็ต deleted_at แทนการลบแถวจริง)
+func (h *PatientHandler) DeletePatient(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	patient, ok := h.findPatient(c, hospital)
+	if !ok {
+		return
+	}
+
+	if err := h.patients.Delete(c.Request.Context(), patient); err != nil {
+		requestLogger(c).Error("Database Delete Error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting patient"})
+		return
+	}
+	if !recordPatientAudit(c, h.audit, models.AuditPatientDelete, []uint{patient.ID}, nil) {
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"patients": patients})
+	c.JSON(http.StatusOK, gin.H{"message": "Patient deleted successfully"})
 }
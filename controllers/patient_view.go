@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"time"
+
+	"HIS-api/masking"
+	"HIS-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ข้อมูลผู้ป่วยที่ส่งให้ client แยกจาก models.Patient เพื่อไม่ให้คอลัมน์ภายใน (blind index, deleted_at)
+// หลุดออกไป และปิดฟิลด์อ่อนไหวบางส่วนตามบทบาท ชื่อฟิลด์ใน JSON คงเดิมตาม API ที่มีอยู่
+// MaskedFields บอกว่าฟิลด์ไหนถูกปิดไว้ ดูค่าเต็มได้ด้วย POST /patient/:id/reveal
+type patientView struct {
+	ID           uint
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	FirstNameTH  string
+	MiddleNameTH string
+	LastNameTH   string
+	FirstNameEN  string
+	MiddleNameEN string
+	LastNameEN   string
+	DateOfBirth  time.Time
+	PatientHN    *string
+	NationalID   *string
+	PassportID   *string
+	PhoneNumber  string
+	Email        *string
+	Gender       string
+	Hospital     string
+	MaskedFields []models.SensitiveField
+}
+
+// วิธีปิดข้อมูลของแต่ละฟิลด์อ่อนไหว
+var fieldMasks = map[models.SensitiveField]func(string) string{
+	models.FieldNationalID:  masking.NationalID,
+	models.FieldPassportID:  masking.Passport,
+	models.FieldPhoneNumber: masking.Phone,
+	models.FieldEmail:       masking.Email,
+}
+
+// สร้าง view ของผู้ป่วย ฟิลด์อ่อนไหวจะถูกปิดถ้าบทบาทไม่ได้เห็นแบบเต็มและไม่ได้อยู่ใน revealed
+func newPatientView(p models.Patient, role models.Role, revealed map[models.SensitiveField]bool) patientView {
+	view := patientView{
+		ID:           p.ID,
+		CreatedAt:    p.CreatedAt,
+		UpdatedAt:    p.UpdatedAt,
+		FirstNameTH:  p.FirstNameTH,
+		MiddleNameTH: p.MiddleNameTH,
+		LastNameTH:   p.LastNameTH,
+		FirstNameEN:  p.FirstNameEN,
+		MiddleNameEN: p.MiddleNameEN,
+		LastNameEN:   p.LastNameEN,
+		DateOfBirth:  p.DateOfBirth,
+		PatientHN:    p.PatientHN,
+		NationalID:   copyString(p.NationalID),
+		PassportID:   copyString(p.PassportID),
+		PhoneNumber:  p.PhoneNumber,
+		Email:        copyString(p.Email),
+		Gender:       p.Gender,
+		Hospital:     p.Hospital,
+		MaskedFields: []models.SensitiveField{},
+	}
+
+	// ชี้ไปที่ค่าใน view (คัดลอกมาแล้ว) การปิดข้อมูลจึงไม่แก้ models.Patient ต้นทาง
+	values := map[models.SensitiveField]*string{
+		models.FieldNationalID:  view.NationalID,
+		models.FieldPassportID:  view.PassportID,
+		models.FieldPhoneNumber: &view.PhoneNumber,
+		models.FieldEmail:       view.Email,
+	}
+	for _, field := range models.SensitiveFields {
+		value := values[field]
+		if value == nil || *value == "" || role.Unmasked(field) || revealed[field] {
+			continue
+		}
+		*value = fieldMasks[field](*value)
+		view.MaskedFields = append(view.MaskedFields, field)
+	}
+	return view
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	value := *s
+	return &value
+}
+
+// บทบาทของ Staff ที่เรียก API (AuthMiddleware ใช้ค่าล่าสุดจากฐานข้อมูล)
+func currentRole(c *gin.Context) models.Role {
+	staff, _ := c.Get("staff")
+	claims, _ := staff.(jwt.MapClaims)
+	role, _ := claims["role"].(string)
+	return models.Role(role)
+}
+
+// view ของผู้ป่วยหลายคนตามบทบาทของผู้เรียก (ไม่มีการ reveal)
+func patientViews(c *gin.Context, patients []models.Patient) []patientView {
+	role := currentRole(c)
+	views := make([]patientView, 0, len(patients))
+	for _, p := range patients {
+		views = append(views, newPatientView(p, role, nil))
+	}
+	return views
+}
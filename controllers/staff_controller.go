@@ -1,66 +1,161 @@
 package controllers
 
 import (
-	"net/http"
-	"time"
+	"HIS-api/metrics"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+	"HIS-api/tokens"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	"HIS-api/models"
-	"HIS-api/config"
-	"os"
+	"io"
+	"net/http"
+	"time"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// handler ของขั้นตอนยืนยันตัวตน (login, refresh token, logout, MFA และรหัสผ่าน)
+// บัญชี Staff, ตัวนับการใส่ผิดและ session ผ่าน repository ส่วน secret ของ MFA และประวัติรหัสผ่านผ่าน services กับ db
+type AuthHandler struct {
+	staff repository.StaffRepository
+}
 
-func generateToken(username string, hospital string) (string, error) {
-	claims := jwt.MapClaims{
-		"username": username,
-		"hospital": hospital, 
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+func NewAuthHandler(staff repository.StaffRepository) *AuthHandler {
+	return &AuthHandler{staff: staff}
+}
+
+// ออก access token ให้ Staff พร้อม refresh token
+// ถ้า refreshToken ว่าง (login ใหม่) จะออก refresh token family ใหม่ให้
+func (h *AuthHandler) newSession(c *gin.Context, staff models.Staff, refreshToken string) (gin.H, error) {
+	accessToken, expiresAt, err := tokens.IssueAccessToken(staff)
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshToken == "" {
+		refreshToken, err = h.staff.IssueRefreshToken(c.Request.Context(), staff.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+
+	// ซ่อน password ก่อนส่ง response
+	staff.Password = ""
+
+	return gin.H{
+		"token":         accessToken,
+		"expires_in":    int(time.Until(expiresAt).Seconds()),
+		"refresh_token": refreshToken,
+		"staff":         staff,
+	}, nil
 }
 
-func RegisterStaff(c *gin.Context) {
-	var staff models.Staff
-	if err := c.ShouldBindJSON(&staff); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+func (h *AuthHandler) issueSession(c *gin.Context, staff models.Staff, refreshToken string, message string) {
+	response, err := h.newSession(c, staff, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
-	// ตรวจสอบค่า `username`, `password`, `hospital` ต้องไม่ว่าง
-	if staff.Username == "" || staff.Password == "" || staff.Hospital == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "All fields are required"})
-		return
+	response["message"] = message
+	c.JSON(http.StatusOK, response)
+}
+
+// ล้างตัวนับการใส่ผิด เรียกเมื่อผ่านการยืนยันตัวตนครบทุกขั้นแล้วเท่านั้น
+func (h *AuthHandler) clearLoginFailures(c *gin.Context, staff models.Staff) {
+	if staff.FailedLoginAttempts > 0 || staff.LockedUntil != nil {
+		_, err := h.staff.UpdateLoginState(c.Request.Context(), staff.ID, func(s *models.Staff) *models.LockoutEvent {
+			services.ResetLoginFailures(s)
+			return nil
+		})
+		if err != nil {
+			requestLogger(c).Error("Resetting login failures failed", "error", err)
+		}
 	}
+}
 
-	// เช็คว่า `username` ต้องไม่ซ้ำ
-	var existingStaff models.Staff
-	if err := config.DB.Where("username = ?", staff.Username).First(&existingStaff).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
-		return
+// จองสิทธิ์ลองหนึ่งครั้งก่อนตรวจรหัสผ่านหรือรหัส MFA (ดู services.LoginPolicy.BeginAttempt)
+// คืน Staff ที่นับครั้งนี้แล้ว หรือเวลาที่ต้องรอ (> 0)
+func (h *AuthHandler) beginLoginAttempt(c *gin.Context, policy services.LoginPolicy, staffID uint, now time.Time) (models.Staff, time.Duration, error) {
+	var wait time.Duration
+	staff, err := h.staff.UpdateLoginState(c.Request.Context(), staffID, func(s *models.Staff) *models.LockoutEvent {
+		var event *models.LockoutEvent
+		wait, event = policy.BeginAttempt(s, c.ClientIP(), now)
+		return event
+	})
+	return staff, wait, err
+}
+
+// การลองที่จองไว้ผิด ถ้าครบจำนวนจะล็อกบัญชี
+func (h *AuthHandler) failLoginAttempt(c *gin.Context, policy services.LoginPolicy, staffID uint, now time.Time) {
+	locked := false
+	_, err := h.staff.UpdateLoginState(c.Request.Context(), staffID, func(s *models.Staff) *models.LockoutEvent {
+		event := policy.FailAttempt(s, c.ClientIP(), now)
+		locked = event != nil
+		return event
+	})
+	if err != nil {
+		requestLogger(c).Error("Recording login failure failed", "error", err)
+	}
+	if locked {
+		requestLogger(c).Warn("Staff locked after too many failed login attempts", "staff_id", staffID)
 	}
+}
 
-	// Hash Password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(staff.Password), bcrypt.DefaultCost)
+// คืนการลองที่จองไว้ด้วย beginLoginAttempt เมื่อรหัสถูกแต่ยังไม่จบการ login
+func (h *AuthHandler) releaseLoginAttempt(c *gin.Context, staff models.Staff) {
+	_, err := h.staff.UpdateLoginState(c.Request.Context(), staff.ID, func(s *models.Staff) *models.LockoutEvent {
+		services.ReleaseAttempt(s)
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
-		return
+		requestLogger(c).Error("Releasing login attempt failed", "error", err)
 	}
-	staff.Password = string(hashedPassword)
+}
 
-	// บันทึกลงฐานข้อมูล
-	if err := config.DB.Create(&staff).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving staff to database"})
-		return
+// คำตอบเดียวกันสำหรับ username ที่ไม่มีอยู่ รหัสผ่านผิด และบัญชีที่ถูกล็อกหรือต้องรอ
+func respondInvalidCredentials(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// ผ่านการยืนยันตัวตนครบทุกขั้นแล้ว: ล้างตัวนับการใส่ผิด แล้วออก token จริง
+// หรือ token สำหรับเปลี่ยนรหัสผ่าน ถ้า Staff ถูกบังคับให้เปลี่ยนรหัสผ่านก่อน
+func (h *AuthHandler) loginResult(c *gin.Context, staff models.Staff) (gin.H, error) {
+	h.clearLoginFailures(c, staff)
+
+	if staff.MustChangePassword {
+		challenge, err := tokens.IssueChallengeToken(staff, tokens.TypePasswordChange)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"message":                  "Password change required",
+			"password_change_required": true,
+			"password_token":           challenge,
+			"expires_in":               int(tokens.ChallengeTokenTTL().Seconds()),
+		}, nil
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Staff registered successfully!"})
+	response, err := h.newSession(c, staff, "")
+	if err != nil {
+		return nil, err
+	}
+	response["message"] = "Login successful"
+	return response, nil
+}
+
+// จบการเข้าสู่ระบบ
+func (h *AuthHandler) completeLogin(c *gin.Context, staff models.Staff) {
+	response, err := h.loginResult(c, staff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func LoginStaff(c *gin.Context) {
+func (h *AuthHandler) LoginStaff(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -73,33 +168,203 @@ func LoginStaff(c *gin.Context) {
 		return
 	}
 
-	var storedStaff models.Staff
+	policy := services.LoginPolicyFromConfig()
+	ip := c.ClientIP()
+	now := time.Now()
 
-	// ตรวจสอบ username และ hospital พร้อมกัน
-	if err := config.DB.Where("username = ? AND hospital = ?", input.Username, input.Hospital).First(&storedStaff).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// IP นี้ใส่ผิดบ่อยเกินไป ต้องรอก่อน
+	failures, last, err := h.staff.IPFailures(c.Request.Context(), ip, policy.IPWindowStart(now))
+	if err != nil {
+		requestLogger(c).Error("Login throttle check failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process login"})
+		return
+	}
+	if wait := policy.IPRetryAfter(failures, last, now); wait > 0 {
+		metrics.RecordLogin(metrics.LoginStagePassword, metrics.LoginThrottled)
+		respondRetryAfter(c, http.StatusTooManyRequests, "Too many failed login attempts, try again later", wait)
+		return
+	}
+
+	// ตรวจสอบ username และ hospital พร้อมกัน (รับได้ทั้งรหัสหรือชื่อที่พิมพ์ต่างกันแค่ตัวพิมพ์/ช่องว่าง)
+	// ไม่พบบัญชี ถูกล็อก หรือต้องรอ ตอบเหมือนรหัสผ่านผิดทุกประการ และใช้เวลาใกล้เคียงกัน
+	// เพื่อไม่ให้ใช้แยกได้ว่า username ไหนมีอยู่จริง
+	input.Hospital = models.NormalizeHospitalCode(input.Hospital)
+	storedStaff, err := h.staff.FindByUsername(c.Request.Context(), input.Hospital, input.Username)
+	if errors.Is(err, repository.ErrNotFound) {
+		services.CompareDummyPassword(input.Password)
+		h.recordLoginAttempt(c, metrics.LoginStagePassword, input.Username, input.Hospital, ip, false)
+		respondInvalidCredentials(c)
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Staff lookup failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process login"})
+		return
+	}
+
+	// จองสิทธิ์ลองหนึ่งครั้งก่อนตรวจรหัสผ่าน request ที่ยิงพร้อมกันจึงต้องผ่านการหน่วงและการล็อกทีละครั้ง
+	storedStaff, wait, err := h.beginLoginAttempt(c, policy, storedStaff.ID, now)
+	if err != nil {
+		requestLogger(c).Error("Login throttle check failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process login"})
+		return
+	}
+	if wait > 0 {
+		services.CompareDummyPassword(input.Password)
+		h.recordThrottledLogin(c, metrics.LoginStagePassword, input.Username, input.Hospital, ip)
+		respondInvalidCredentials(c)
 		return
 	}
 
 	// ตรวจสอบ password
 	if err := bcrypt.CompareHashAndPassword([]byte(storedStaff.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		h.recordLoginAttempt(c, metrics.LoginStagePassword, input.Username, input.Hospital, ip, false)
+		h.failLoginAttempt(c, policy, storedStaff.ID, now)
+		respondInvalidCredentials(c)
+		return
+	}
+
+	// บัญชีถูกปิดใช้งานโดย admin ตอบเหมือนรหัสผ่านผิด เหตุผลจริงเก็บไว้ใน log ฝั่ง server เท่านั้น
+	if !storedStaff.Active() {
+		h.releaseLoginAttempt(c, storedStaff)
+		h.recordLoginAttempt(c, metrics.LoginStagePassword, input.Username, input.Hospital, ip, false)
+		requestLogger(c).Info("Login rejected: account is deactivated", "staff_id", storedStaff.ID)
+		respondInvalidCredentials(c)
+		return
+	}
+	hospitalActive, err := h.staff.HospitalActive(c.Request.Context(), storedStaff.Hospital)
+	if err != nil {
+		h.releaseLoginAttempt(c, storedStaff)
+		requestLogger(c).Error("Hospital status check failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process login"})
+		return
+	}
+	if !hospitalActive {
+		h.releaseLoginAttempt(c, storedStaff)
+		h.recordLoginAttempt(c, metrics.LoginStagePassword, input.Username, input.Hospital, ip, false)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Hospital is not active"})
+		return
+	}
+
+	h.recordLoginAttempt(c, metrics.LoginStagePassword, input.Username, input.Hospital, ip, true)
+
+	// เปิด MFA ไว้ ต้องยืนยันรหัสที่ POST /staff/login/mfa ก่อนถึงจะได้ token จริง
+	// (คืนแค่ครั้งที่จองไว้ ยังไม่ล้างตัวนับการใส่ผิด เพื่อให้การเดารหัส MFA ถูกนับรวมด้วย)
+	if storedStaff.MFAEnabled {
+		h.releaseLoginAttempt(c, storedStaff)
+		respondMFAChallenge(c, storedStaff, tokens.TypeMFA, "MFA verification required")
+		return
+	}
+
+	// role นี้บังคับ MFA แต่ยังไม่ได้ลงทะเบียน ต้องลงทะเบียนที่ /staff/mfa/enroll ก่อน
+	if services.MFARequiredForRole(storedStaff.Role) {
+		h.releaseLoginAttempt(c, storedStaff)
+		respondMFAChallenge(c, storedStaff, tokens.TypeMFAEnroll, "MFA enrollment required")
 		return
 	}
 
 	// สร้าง JWT Token
-	token, err := generateToken(storedStaff.Username, storedStaff.Hospital)
+	h.completeLogin(c, storedStaff)
+}
+
+// แลก refresh token เป็น access token ใหม่ refresh token เดิมจะใช้ไม่ได้อีก (rotation)
+func (h *AuthHandler) RefreshSession(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	staff, refreshToken, err := h.staff.RotateRefreshToken(c.Request.Context(), input.RefreshToken)
+	switch {
+	case errors.Is(err, tokens.ErrRefreshTokenInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case errors.Is(err, tokens.ErrRefreshTokenReused):
+		requestLogger(c).Warn("Refresh token reuse detected, session family revoked",
+			"staff_id", staff.ID, "hospital", staff.Hospital)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case err != nil:
+		requestLogger(c).Error("Refresh token error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+		return
+	}
+
+	h.issueSession(c, staff, refreshToken, "Token refreshed")
+}
+
+// ออกจากระบบ: revoke access token ที่ใช้อยู่ทันที และ revoke refresh token ที่ส่งมา
+// ถ้าส่ง all_sessions = true จะ revoke refresh token ทุกตัวของ Staff (ออกจากทุกเครื่อง)
+func (h *AuthHandler) LogoutStaff(c *gin.Context) {
+	staff, _ := c.Get("staff")
+	claims, ok := staff.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	staffID, ok := tokens.StaffID(claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+		AllSessions  bool   `json:"all_sessions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := h.staff.RevokeToken(c.Request.Context(), claims); err != nil {
+		requestLogger(c).Error("Revoke access token error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+
+	var err error
+	switch {
+	case input.AllSessions:
+		err = h.staff.RevokeSessions(c.Request.Context(), staffID)
+	case input.RefreshToken != "":
+		err = h.staff.RevokeRefreshFamily(c.Request.Context(), input.RefreshToken, staffID)
+	}
+	if errors.Is(err, tokens.ErrRefreshTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh token"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		requestLogger(c).Error("Revoke refresh token error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
 		return
 	}
 
-	// ซ่อน password ก่อนส่ง response
-	storedStaff.Password = ""
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
-		"staff":   storedStaff,
-	})
+// บันทึกผลการ login ลงฐานข้อมูล (สำหรับจำกัดการเดารหัส) และนับใน metric ตามขั้น (metrics.LoginStage*)
+func (h *AuthHandler) recordLoginAttempt(c *gin.Context, stage, username, hospital, ip string, success bool) {
+	result := metrics.LoginFailure
+	if success {
+		result = metrics.LoginSuccess
+	}
+	metrics.RecordLogin(stage, result)
+
+	attempt := models.LoginAttempt{Username: username, Hospital: hospital, IP: ip, Success: success}
+	if err := h.staff.RecordLoginAttempt(c.Request.Context(), attempt); err != nil {
+		requestLogger(c).Error("Recording login attempt failed", "error", err)
+	}
+}
+
+// บัญชีถูกล็อกหรือต้องรอ นับใน metric แยกจากรหัสผิด แต่ยังนับรวมในการหน่วงตาม IP
+func (h *AuthHandler) recordThrottledLogin(c *gin.Context, stage, username, hospital, ip string) {
+	metrics.RecordLogin(stage, metrics.LoginThrottled)
+	attempt := models.LoginAttempt{Username: username, Hospital: hospital, IP: ip}
+	if err := h.staff.RecordLoginAttempt(c.Request.Context(), attempt); err != nil {
+		requestLogger(c).Error("Recording login attempt failed", "error", err)
+	}
 }
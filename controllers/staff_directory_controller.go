@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ข้อมูล Staff ที่แสดงให้ admin (ไม่มี hash รหัสผ่านหรือ secret ของ MFA)
+type staffView struct {
+	ID                 uint        `json:"id"`
+	Username           string      `json:"username"`
+	Hospital           string      `json:"hospital"`
+	Role               models.Role `json:"role"`
+	Active             bool        `json:"active"`
+	MFAEnabled         bool        `json:"mfa_enabled"`
+	MustChangePassword bool        `json:"must_change_password"`
+	LockedUntil        *time.Time  `json:"locked_until,omitempty"`
+	PasswordChangedAt  *time.Time  `json:"password_changed_at,omitempty"`
+	DeactivatedAt      *time.Time  `json:"deactivated_at,omitempty"`
+	DeactivatedBy      *uint       `json:"deactivated_by,omitempty"`
+	CreatedAt          time.Time   `json:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+}
+
+func newStaffView(s models.Staff) staffView {
+	return staffView{
+		ID:                 s.ID,
+		Username:           s.Username,
+		Hospital:           s.Hospital,
+		Role:               s.Role,
+		Active:             s.Active(),
+		MFAEnabled:         s.MFAEnabled,
+		MustChangePassword: s.MustChangePassword,
+		LockedUntil:        s.LockedUntil,
+		PasswordChangedAt:  s.PasswordChangedAt,
+		DeactivatedAt:      s.DeactivatedAt,
+		DeactivatedBy:      s.DeactivatedBy,
+		CreatedAt:          s.CreatedAt,
+		UpdatedAt:          s.UpdatedAt,
+	}
+}
+
+// พารามิเตอร์ค้นหารายชื่อ Staff
+type listStaffQuery struct {
+	Username string      `form:"username"`
+	Role     models.Role `form:"role"`
+	Status   string      `form:"status" binding:"omitempty,oneof=active inactive all"`
+
+	Limit  int    `form:"limit" binding:"omitempty,min=1"`
+	Sort   string `form:"sort" binding:"omitempty,oneof=username -username created_at -created_at"`
+	Cursor string `form:"cursor"`
+}
+
+// handler ของงานจัดการบัญชี Staff โดย admin ข้อมูลผ่าน repository ที่ส่งเข้ามา
+type StaffHandler struct {
+	staff repository.StaffRepository
+}
+
+func NewStaffHandler(staff repository.StaffRepository) *StaffHandler {
+	return &StaffHandler{staff: staff}
+}
+
+// รายชื่อ Staff ในโรงพยาบาลของ admin กรองด้วย username (บางส่วน), role และ status
+// status: active (default), inactive หรือ all
+func (h *StaffHandler) ListStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var query listStaffQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if query.Role != "" && !query.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	lists := config.Current().Lists
+	limit := pageLimit(query.Limit, lists.StaffListDefault, lists.StaffListMax)
+
+	sort := query.Sort
+	if sort == "" && query.Cursor != "" {
+		sort = repository.CursorSort(query.Cursor)
+	}
+	if sort == "" {
+		sort = "username"
+	}
+
+	filter := repository.StaffFilter{Hospital: hospital, Username: query.Username, Role: query.Role, Status: query.Status}
+	result, err := h.staff.List(c.Request.Context(), filter, repository.PageRequest{Sort: sort, Limit: limit, Cursor: query.Cursor})
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("List staff error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching staff"})
+		return
+	}
+
+	views := make([]staffView, 0, len(result.Items))
+	for _, s := range result.Items {
+		views = append(views, newStaffView(s))
+	}
+
+	response := gin.H{
+		"staff":    views,
+		"total":    result.Total,
+		"has_more": result.HasMore,
+		"limit":    limit,
+		"sort":     sort,
+	}
+	if result.HasMore {
+		response["next"] = result.Next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// แปลง :id จาก path ตอบ 400 ถ้าไม่ใช่ตัวเลข
+func staffIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ตอบ error จากการแก้ไขบัญชี Staff คืน true ถ้ามี error และตอบกลับไปแล้ว
+func respondStaffError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
+	case errors.Is(err, services.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+	case errors.Is(err, services.ErrCannotModifySelf):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot deactivate or change the role of your own account"})
+	default:
+		requestLogger(c).Error("Staff update error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update staff"})
+	}
+	return true
+}
+
+// ดูข้อมูล Staff หนึ่งคนในโรงพยาบาลของ admin
+func (h *StaffHandler) GetStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+	id, ok := staffIDParam(c)
+	if !ok {
+		return
+	}
+
+	staff, err := h.staff.Find(c.Request.Context(), hospital, id)
+	if respondStaffError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"staff": newStaffView(staff)})
+}
+
+// แก้ไข username หรือ role ของ Staff (ส่งมาเฉพาะฟิลด์ที่ต้องการแก้)
+func (h *StaffHandler) UpdateStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+	actorID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+	id, ok := staffIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Username *string      `json:"username" binding:"omitempty,min=1"`
+		Role     *models.Role `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	update := services.StaffUpdate{Username: input.Username, Role: input.Role}
+	staff, err := h.staff.Update(c.Request.Context(), hospital, id, func(s *models.Staff) error {
+		return update.Apply(s, actorID)
+	})
+	if respondStaffError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff updated successfully", "staff": newStaffView(staff)})
+}
+
+// ปิดการใช้งานบัญชี Staff: token ที่ออกไปแล้วใช้ไม่ได้ทันที และ refresh token ทั้งหมดถูก revoke
+func (h *StaffHandler) DeactivateStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+	actorID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+	id, ok := staffIDParam(c)
+	if !ok {
+		return
+	}
+
+	staff, err := h.staff.Update(c.Request.Context(), hospital, id, func(s *models.Staff) error {
+		return services.DeactivateStaff(s, actorID, time.Now())
+	})
+	if respondStaffError(c, err) {
+		return
+	}
+	if err := h.staff.RevokeSessions(c.Request.Context(), staff.ID); err != nil {
+		requestLogger(c).Error("Revoke refresh tokens error", "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff deactivated successfully", "staff": newStaffView(staff)})
+}
+
+// เปิดการใช้งานบัญชี Staff ที่ถูกปิดไว้อีกครั้ง
+func (h *StaffHandler) ReactivateStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+	id, ok := staffIDParam(c)
+	if !ok {
+		return
+	}
+
+	staff, err := h.staff.Update(c.Request.Context(), hospital, id, func(s *models.Staff) error {
+		services.ReactivateStaff(s)
+		return nil
+	})
+	if respondStaffError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff reactivated successfully", "staff": newStaffView(staff)})
+}
+
+// สร้างบัญชี Staff ใหม่ในโรงพยาบาลเดียวกับ admin ที่เรียก (ต้องมีสิทธิ์ staff:manage)
+func (h *StaffHandler) RegisterStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Username string      `json:"username"`
+		Password string      `json:"password"`
+		Hospital string      `json:"hospital"`
+		Role     models.Role `json:"role"`
+		// admin เป็นคนตั้งรหัสผ่านให้ จึงบังคับเปลี่ยนตอน login ครั้งแรกเป็นค่า default
+		MustChangePassword *bool `json:"must_change_password"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	// ตรวจสอบค่า `username`, `password` ต้องไม่ว่าง
+	if input.Username == "" || input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "All fields are required"})
+		return
+	}
+
+	// admin สร้าง Staff ได้เฉพาะโรงพยาบาลของตัวเอง
+	if input.Hospital != "" && models.NormalizeHospitalCode(input.Hospital) != hospital {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only create staff in your own hospital"})
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = models.RoleRegistrationClerk
+	}
+	if !input.Role.Assignable() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	policy, ok := passwordPolicy(c)
+	if !ok {
+		return
+	}
+
+	staff, err := policy.NewStaff(models.Staff{
+		Username:           input.Username,
+		Hospital:           hospital,
+		Role:               input.Role,
+		MustChangePassword: input.MustChangePassword == nil || *input.MustChangePassword,
+	}, input.Password)
+	if err == nil {
+		_, err = h.staff.Create(c.Request.Context(), staff)
+	}
+	var policyErr *services.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		respondPasswordPolicyError(c, policyErr)
+		return
+	case errors.Is(err, services.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	case errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
+		return
+	case err != nil:
+		requestLogger(c).Error("Register staff error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving staff to database"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Staff registered successfully!"})
+}
+
+// admin ปลดล็อกบัญชี Staff ในโรงพยาบาลของตัวเอง พร้อมบันทึก LockoutEvent
+func (h *StaffHandler) UnlockStaff(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+	actorID, ok := currentStaffID(c)
+	if !ok {
+		return
+	}
+	id, ok := staffIDParam(c)
+	if !ok {
+		return
+	}
+
+	// ตรวจก่อนว่าเป็น Staff ในโรงพยาบาลของ admin
+	if _, err := h.staff.Find(c.Request.Context(), hospital, id); err != nil {
+		respondStaffError(c, err)
+		return
+	}
+	_, err := h.staff.UpdateLoginState(c.Request.Context(), id, func(s *models.Staff) *models.LockoutEvent {
+		return services.UnlockStaff(s, actorID, c.ClientIP())
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
+		return
+	}
+	if err != nil {
+		requestLogger(c).Error("Unlock staff error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unlock staff"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Staff unlocked successfully"})
+}
+
+// ประวัติการล็อก/ปลดล็อกบัญชีในโรงพยาบาล (ล่าสุดก่อน) กรองด้วย ?staff_id= ได้
+func (h *StaffHandler) ListLockoutEvents(c *gin.Context) {
+	hospital, ok := currentHospital(c)
+	if !ok {
+		return
+	}
+
+	var staffID uint
+	if raw := c.Query("staff_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+			return
+		}
+		staffID = uint(id)
+	}
+
+	events, err := h.staff.LockoutEvents(c.Request.Context(), hospital, staffID, 200)
+	if err != nil {
+		requestLogger(c).Error("Database Query Error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching lockout events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
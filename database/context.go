@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type contextKey struct{}
+
+// แนบ transaction ของ request ไว้ใน context (middlewares.TenantTransaction ใช้)
+func ContextWithDB(ctx context.Context, db *gorm.DB) context.Context {
+	return context.WithValue(ctx, contextKey{}, db)
+}
+
+// transaction ที่แนบไว้ใน ctx ถ้าไม่มีจะใช้ fallback ซึ่ง row-level security จะไม่ให้เห็นข้อมูลผู้ป่วยเลย
+func DBFromContext(ctx context.Context, fallback *gorm.DB) *gorm.DB {
+	if db, ok := ctx.Value(contextKey{}).(*gorm.DB); ok {
+		return db
+	}
+	return fallback.WithContext(ctx)
+}
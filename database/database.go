@@ -1,21 +1,202 @@
 package database
 
 import (
-	"fmt"
-	"log"
 	"HIS-api/config"
+	"HIS-api/encryption"
 	"HIS-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func MigrateDB() {
+// รัน migration ที่ยังไม่ได้รันทั้งหมด (ดู migrate.go) รันพร้อมกันจากหลาย replica ได้
+func MigrateDB() error {
 	if config.DB == nil {
-		log.Fatal("Database connection is not initialized")
+		return errors.New("database connection is not initialized")
+	}
+
+	// ข้อมูลผู้ป่วยบางคอลัมน์ถูกเข้ารหัส ต้องโหลด keyring ก่อนอ่าน/เขียนตาราง patients
+	if _, err := encryption.Init(); err != nil {
+		return fmt.Errorf("loading encryption keyring: %w", err)
 	}
 
-	err := config.DB.AutoMigrate(&models.Patient{}, &models.Staff{})
+	ran, err := MigrateUp(config.DB)
 	if err != nil {
-		log.Fatal("Migration failed:", err)
+		return err
 	}
 
-	fmt.Println("Database migrated successfully.")
+	log.Printf("Database migrated successfully (%d migrations applied).", len(ran))
+	return nil
+}
+
+// ตารางที่เก็บชื่อโรงพยาบาลไว้ในคอลัมน์ hospital
+// (login_attempts เก็บค่าที่ผู้ใช้พิมพ์มา จึงไม่ใช้สร้างโรงพยาบาลใหม่ แต่ถูกแปลงตามด้วย)
+var (
+	hospitalSourceTables = []string{"staffs", "patients"}
+	hospitalTables       = []string{"staffs", "patients", "hn_formats", "hn_sequences", "lockout_events", "login_attempts"}
+)
+
+// แปลงชื่อโรงพยาบาลแบบข้อความอิสระในข้อมูลเดิม ("Hospital A", "hospital a") เป็นรหัสมาตรฐาน
+// และสร้างแถวใน hospitals ให้ ชื่อเดิมจะถูกใช้เป็นชื่อโรงพยาบาลไปก่อน ให้ admin แก้ทีหลังได้
+// รันซ้ำได้ ถ้าข้อมูลถูกแปลงหมดแล้วจะไม่มีอะไรเปลี่ยน
+//
+// ถ้าการรวมชื่อหลายแบบเป็นรหัสเดียวทำให้ค่าใน unique index ของโรงพยาบาลชนกัน (เช่น HN หรือเลขบัตรประชาชนซ้ำ)
+// จะไม่แปลงอะไรเลยและคืน HospitalClashError ที่บอกทุกจุดที่ชน ให้แก้ข้อมูลแล้วรัน migration ใหม่
+func MigrateHospitalStrings(db *gorm.DB) error {
+	// ต้องเห็นและแก้ข้อมูลทุกโรงพยาบาล
+	return WithoutRLS(db, func(tx *gorm.DB) error {
+		names := map[string]struct{}{}
+		for _, table := range hospitalSourceTables {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+			var values []string
+			if err := tx.Table(table).Distinct("hospital").Pluck("hospital", &values).Error; err != nil {
+				return err
+			}
+			for _, v := range values {
+				names[v] = struct{}{}
+			}
+		}
+
+		groups := map[string][]string{}
+		for name := range names {
+			code := models.NormalizeHospitalCode(name)
+			if code == "" {
+				return fmt.Errorf("hospital %q cannot be converted to a code", name)
+			}
+			groups[code] = append(groups[code], name)
+		}
+		clashes, err := findHospitalClashes(tx, groups)
+		if err != nil {
+			return err
+		}
+		if len(clashes) > 0 {
+			return &HospitalClashError{Clashes: clashes}
+		}
+
+		for name := range names {
+			code := models.NormalizeHospitalCode(name)
+
+			hospital := models.Hospital{Code: code, NameTH: name, NameEN: name, Status: models.HospitalActive}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&hospital).Error; err != nil {
+				return err
+			}
+			if code == name {
+				continue
+			}
+
+			for _, table := range hospitalTables {
+				if !tx.Migrator().HasTable(table) {
+					continue
+				}
+				if err := tx.Table(table).Where("hospital = ?", name).Update("hospital", code).Error; err != nil {
+					return fmt.Errorf("converting %s.hospital %q to %q: %w", table, name, code, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ชื่อโรงพยาบาลที่รวมกันไม่ได้เพราะค่าใน unique index ชนกัน
+type HospitalClashError struct {
+	Clashes []string
+}
+
+func (e *HospitalClashError) Error() string {
+	return "hospital names cannot be merged without breaking unique indexes, fix these rows and run the migration again:\n  - " +
+		strings.Join(e.Clashes, "\n  - ")
+}
+
+// คีย์ของ unique index (hospital, ...) บน patients ที่ต้องไม่ซ้ำหลังรวมชื่อ
+// เลขประจำตัวและอีเมลเทียบด้วย blind index เหมือน index จริง (ข้อมูลเดิมที่ยังไม่เข้ารหัสจะถูกเติม index ตอน migration 6)
+var patientUniqueKeys = []struct {
+	column string
+	key    func(p models.Patient) *string
+}{
+	{"patient_hn", func(p models.Patient) *string { return p.PatientHN }},
+	{"national_id", func(p models.Patient) *string { return models.PatientIndex("national_id", p.NationalID) }},
+	{"passport_id", func(p models.Patient) *string { return models.PatientIndex("passport_id", p.PassportID) }},
+	{"email", func(p models.Patient) *string { return models.PatientIndex("email", p.Email) }},
+}
+
+// ตรวจว่าการรวมชื่อในแต่ละกลุ่ม (รหัส -> ชื่อเดิม) เป็นรหัสเดียวจะชนกับ unique index ใดบ้าง
+// รายงานเป็น id ของแถว ไม่ใส่ค่าจริงเพราะเป็นข้อมูลระบุตัวผู้ป่วย
+func findHospitalClashes(tx *gorm.DB, groups map[string][]string) ([]string, error) {
+	codes := make([]string, 0, len(groups))
+	for code, names := range groups {
+		if len(names) > 1 {
+			sort.Strings(names)
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	var clashes []string
+	for _, code := range codes {
+		names := groups[code]
+		label := fmt.Sprintf("%s (%q)", code, names)
+
+		if tx.Migrator().HasTable("patients") {
+			var patients []models.Patient
+			if err := tx.Unscoped().Where("hospital IN ?", names).Order("id").Find(&patients).Error; err != nil {
+				return nil, err
+			}
+			for _, k := range patientUniqueKeys {
+				byValue := map[string][]models.Patient{}
+				var values []string
+				for _, p := range patients {
+					v := k.key(p)
+					if v == nil {
+						continue
+					}
+					if _, seen := byValue[*v]; !seen {
+						values = append(values, *v)
+					}
+					byValue[*v] = append(byValue[*v], p)
+				}
+				for _, v := range values {
+					shared := byValue[v]
+					hospitals := map[string]struct{}{}
+					ids := make([]string, 0, len(shared))
+					for _, p := range shared {
+						hospitals[p.Hospital] = struct{}{}
+						ids = append(ids, fmt.Sprint(p.ID))
+					}
+					if len(hospitals) > 1 {
+						clashes = append(clashes, fmt.Sprintf("%s: patients %s share the same %s", label, strings.Join(ids, ", "), k.column))
+					}
+				}
+			}
+		}
+
+		if tx.Migrator().HasTable("hn_formats") {
+			var formats int64
+			if err := tx.Table("hn_formats").Where("hospital IN ?", names).Count(&formats).Error; err != nil {
+				return nil, err
+			}
+			if formats > 1 {
+				clashes = append(clashes, fmt.Sprintf("%s: hn_formats has %d rows, keep one", label, formats))
+			}
+		}
+
+		if tx.Migrator().HasTable("hn_sequences") {
+			var years []int
+			err := tx.Table("hn_sequences").Where("hospital IN ?", names).
+				Group("year").Having("COUNT(*) > 1").Order("year").Pluck("year", &years).Error
+			if err != nil {
+				return nil, err
+			}
+			for _, year := range years {
+				clashes = append(clashes, fmt.Sprintf("%s: hn_sequences has more than one row for year %d, keep the highest last_value", label, year))
+			}
+		}
+	}
+	return clashes, nil
 }
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"HIS-api/encryption"
+	"HIS-api/models"
+
+	"gorm.io/gorm"
+)
+
+// คอลัมน์ของ patients ที่เข้ารหัส
+var encryptedPatientColumns = []string{"national_id", "passport_id", "phone_number", "email"}
+
+// unique index บนค่าจริงจากก่อนเข้ารหัส (ถูกแทนด้วย index บนคอลัมน์ *_index)
+var plaintextPatientIndexes = []string{
+	"idx_patients_hospital_national_id",
+	"idx_patients_hospital_passport_id",
+	"idx_patients_hospital_email",
+}
+
+// เข้ารหัสข้อมูลผู้ป่วยเดิมที่ยังเป็นข้อความปกติ และเติม blind index ทีละ batch
+// รันซ้ำได้ แถวที่เข้ารหัสแล้วจะถูกข้าม
+func EncryptPatientIdentifiers(db *gorm.DB, batchSize int) error {
+	for _, index := range plaintextPatientIndexes {
+		if err := db.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
+	}
+
+	conditions := make([]string, 0, len(encryptedPatientColumns))
+	for _, column := range encryptedPatientColumns {
+		conditions = append(conditions, column+" NOT LIKE '"+encryption.Prefix+"%'")
+	}
+	plaintext := strings.Join(conditions, " OR ")
+
+	total := 0
+	for {
+		done := false
+		err := WithoutRLS(db, func(tx *gorm.DB) error {
+			// serializer จะคืนค่าที่ยังไม่เข้ารหัสตามเดิม แล้วเข้ารหัสตอนบันทึกกลับ
+			var patients []models.Patient
+			if err := tx.Unscoped().Where(plaintext).Order("id").Limit(batchSize).Find(&patients).Error; err != nil {
+				return err
+			}
+			if len(patients) == 0 {
+				done = true
+				return nil
+			}
+			for i := range patients {
+				p := &patients[i]
+				p.SetBlindIndexes()
+				err := tx.Unscoped().Model(p).
+					Select("national_id", "national_id_index", "passport_id", "passport_id_index", "phone_number", "phone_number_index", "email", "email_index").
+					UpdateColumns(p).Error
+				if err != nil {
+					return fmt.Errorf("patient %d: %w", p.ID, err)
+				}
+			}
+			total += len(patients)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Encrypted identifiers of %d existing patients", total)
+	}
+	return nil
+}
+
+// ห่อกุญแจข้อมูลของทุกค่าที่เข้ารหัสใหม่ด้วยกุญแจ primary ทีละ batch (ใช้หลังหมุนกุญแจ)
+// คืนจำนวนค่าที่ถูก rewrap รันซ้ำได้ ค่าที่ใช้กุญแจ primary อยู่แล้วจะไม่ถูกแก้
+func RewrapPatientIdentifiers(db *gorm.DB, keyring *encryption.Keyring, batchSize int) (int, error) {
+	type encryptedRow struct {
+		ID          uint
+		NationalID  *string
+		PassportID  *string
+		PhoneNumber *string
+		Email       *string
+	}
+
+	rewrapped := 0
+	var lastID uint
+	for {
+		var rows []encryptedRow
+		err := WithoutRLS(db, func(tx *gorm.DB) error {
+			// อ่านข้อความเข้ารหัสตรงๆ จากตาราง (ไม่ผ่าน serializer) รวมแถวที่ถูก soft delete
+			err := tx.Table("patients").
+				Select("id", "national_id", "passport_id", "phone_number", "email").
+				Where("id > ?", lastID).Order("id").Limit(batchSize).
+				Find(&rows).Error
+			if err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				updates := map[string]interface{}{}
+				values := map[string]*string{
+					"national_id":  row.NationalID,
+					"passport_id":  row.PassportID,
+					"phone_number": row.PhoneNumber,
+					"email":        row.Email,
+				}
+				for column, value := range values {
+					if value == nil || !strings.HasPrefix(*value, encryption.Prefix) {
+						continue
+					}
+					next, changed, err := keyring.Rewrap(*value)
+					if err != nil {
+						return fmt.Errorf("patient %d %s: %w", row.ID, column, err)
+					}
+					if changed {
+						updates[column] = next
+					}
+				}
+				if len(updates) == 0 {
+					continue
+				}
+				if err := tx.Table("patients").Where("id = ?", row.ID).UpdateColumns(updates).Error; err != nil {
+					return fmt.Errorf("patient %d: %w", row.ID, err)
+				}
+				rewrapped += len(updates)
+			}
+			return nil
+		})
+		if err != nil {
+			return rewrapped, err
+		}
+		if len(rows) == 0 {
+			return rewrapped, nil
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+}
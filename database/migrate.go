@@ -0,0 +1,323 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ไฟล์ migration แบบ SQL ชื่อ NNNN_name.up.sql และ NNNN_name.down.sql (ไม่มี down = ย้อนกลับไม่ได้)
+// ถูกฝังไว้ในไฟล์ binary จึงไม่ต้องส่งไฟล์ไปพร้อมกับแอป
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// migration ที่ต้องเขียนเป็น Go (งานแปลงข้อมูลที่ทำด้วย SQL อย่างเดียวไม่ได้)
+// down เป็น nil ถ้าย้อนกลับไม่ได้ เลข version ต้องไม่ซ้ำกับไฟล์ SQL
+var goMigrations = []Migration{
+	{
+		Version: 2,
+		Name:    "hospital_codes",
+		up:      MigrateHospitalStrings,
+		// รหัสโรงพยาบาลที่แปลงแล้วใช้กับโค้ดเวอร์ชันก่อนได้ ไม่ต้องแปลงกลับ
+		down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 6,
+		Name:    "encrypt_patient_identifiers",
+		up:      func(tx *gorm.DB) error { return EncryptPatientIdentifiers(tx, 500) },
+	},
+}
+
+// ล็อกระดับ session ของ Postgres กันไม่ให้หลาย replica รัน migration พร้อมกัน
+// (ค่าคงที่ใดๆ ที่ไม่ชนกับ advisory lock อื่นของแอป)
+const migrationLockKey = 7_460_221_903
+
+var ErrIrreversibleMigration = errors.New("migration cannot be reverted")
+
+// การเปลี่ยนแปลง schema หนึ่งขั้น แต่ละขั้นรันใน transaction ของตัวเองพร้อมบันทึกลง schema_migrations
+type Migration struct {
+	Version int
+	Name    string
+
+	upSQL, downSQL string
+	up, down       func(tx *gorm.DB) error
+}
+
+// ย้อนกลับได้หรือไม่
+func (m Migration) Reversible() bool {
+	return m.downSQL != "" || m.down != nil
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+func (m Migration) run(tx *gorm.DB, sql string, fn func(*gorm.DB) error) error {
+	if fn != nil {
+		return fn(tx)
+	}
+	return tx.Exec(sql).Error
+}
+
+// แถวใน schema_migrations
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// สถานะของ migration แต่ละขั้น AppliedAt เป็น nil ถ้ายังไม่ได้รัน
+// Known เป็น false ถ้าฐานข้อมูลรันขั้นนี้ไปแล้วแต่ binary นี้ไม่รู้จัก (ถูก migrate ด้วยเวอร์ชันที่ใหม่กว่า)
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Known     bool
+}
+
+// migration ทั้งหมดเรียงตาม version
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, goMigrations)
+}
+
+func loadMigrations(files fs.FS, goSteps []Migration) ([]Migration, error) {
+	byVersion := map[int]*Migration{}
+	for i := range goSteps {
+		m := goSteps[i]
+		if _, exists := byVersion[m.Version]; exists {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+		byVersion[m.Version] = &m
+	}
+
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		match := migrationFileName.FindStringSubmatch(path.Base(name))
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] || m.up != nil {
+			return nil, fmt.Errorf("duplicate migration version %d (%s)", version, name)
+		}
+		if match[3] == "up" {
+			m.upSQL = string(content)
+		} else {
+			m.downSQL = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.upSQL == "" && m.up == nil {
+			return nil, fmt.Errorf("migration %s has no up step", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// รัน fn บน connection เดียวที่ถือ advisory lock ของ migration อยู่
+// replica อื่นที่เรียกพร้อมกันจะรอจนกว่าตัวแรกจะเสร็จ แล้วพบว่าไม่มีอะไรต้องรันแล้ว
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	session := db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	session.Statement.ConnPool = conn
+	if err := session.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`).Error; err != nil {
+		return err
+	}
+	return fn(session)
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// รัน migration ที่ยังไม่ได้รันทั้งหมดตามลำดับ คืนรายการที่รันไป
+// ถ้าขั้นใดล้มเหลว ขั้นนั้นจะถูก rollback และขั้นก่อนหน้ายังคงอยู่
+func MigrateUp(db *gorm.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	err = withMigrationLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for version := range applied {
+			if version > migrations[len(migrations)-1].Version {
+				log.Printf("WARNING: database has migration %d applied which this binary does not know; it was migrated by a newer version", version)
+			}
+		}
+
+		for _, m := range migrations {
+			if _, done := applied[m.Version]; done {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.run(tx, m.upSQL, m.up); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", m, err)
+			}
+			log.Printf("Applied migration %s", m)
+			ran = append(ran, m)
+		}
+		return nil
+	})
+	return ran, err
+}
+
+// ย้อน migration ล่าสุดที่รันไปแล้วทีละขั้นจำนวน steps ขั้น คืนรายการที่ย้อนไป
+// หยุดที่ขั้นที่ย้อนกลับไม่ได้ (ErrIrreversibleMigration) โดยขั้นที่ย้อนไปแล้วยังคงถูกย้อน
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	var reverted []Migration
+	err = withMigrationLock(db, func(conn *gorm.DB) error {
+		var rows []SchemaMigration
+		if err := conn.Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			m, ok := known[row.Version]
+			if !ok {
+				return fmt.Errorf("migration %04d_%s is not known to this binary", row.Version, row.Name)
+			}
+			if !m.Reversible() {
+				return fmt.Errorf("migration %s: %w", m, ErrIrreversibleMigration)
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.run(tx, m.downSQL, m.down); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %s: %w", m, err)
+			}
+			log.Printf("Reverted migration %s", m)
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// สถานะของ migration ทั้งที่ binary รู้จักและที่ฐานข้อมูลบันทึกไว้ เรียงตาม version
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]SchemaMigration{}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		if applied, err = appliedMigrations(db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Known: true}
+		if row, done := applied[m.Version]; done {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, AppliedAt: &appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// version ล่าสุดที่รันแล้ว (0 ถ้ายังไม่เคยรัน) อ่านอย่างเดียว ไม่รอ advisory lock
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// version ล่าสุดที่ binary นี้รู้จัก
+func LatestSchemaVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
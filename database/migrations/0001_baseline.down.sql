@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS audit_entries;
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS password_histories;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS lockout_events;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS hn_sequences;
+DROP TABLE IF EXISTS hn_formats;
+DROP TABLE IF EXISTS patients;
+DROP TABLE IF EXISTS staffs;
+DROP TABLE IF EXISTS hospitals;
@@ -0,0 +1,216 @@
+-- โครงสร้างตารางตั้งต้น (ชื่อ index/constraint ตรงกับที่ gorm AutoMigrate ตั้ง)
+-- ฐานข้อมูลใหม่ได้ทุกตารางครบ ส่วนฐานข้อมูลเดิมที่สร้างด้วย AutoMigrate ของเวอร์ชันแรก
+-- (มีแค่ staffs และ patients คอลัมน์ไม่ครบ และ unique บนค่าจริงทั้งระบบ) ถูกปรับให้เป็นโครงสร้างเดียวกัน:
+--   - เพิ่มคอลัมน์ที่ขาดด้วย ADD COLUMN IF NOT EXISTS ก่อนสร้าง index ที่อ้างถึงคอลัมน์เหล่านั้น
+--   - ลบ unique constraint เดิม (uni_patients_*) เพราะเลขประจำตัวและ HN unique เฉพาะภายในโรงพยาบาลแล้ว
+--   - อีเมลว่างของแถวเดิมเปลี่ยนเป็น NULL (เดิมเก็บเป็น '' เมื่อไม่ได้กรอก)
+-- foreign key ไปยัง hospitals สร้างใน 0003 หลังแปลงชื่อโรงพยาบาลเดิมแล้ว
+-- ค่าเดิมของ national_id ฯลฯ ถูกเข้ารหัสและเติม *_index ใน 0006
+
+CREATE TABLE IF NOT EXISTS hospitals (
+	code varchar(64) PRIMARY KEY,
+	name_th text NOT NULL,
+	name_en text NOT NULL DEFAULT '',
+	h_code varchar(5),
+	status varchar(16) NOT NULL DEFAULT 'active',
+	created_at timestamptz,
+	updated_at timestamptz,
+	CONSTRAINT chk_hospitals_status CHECK (status IN ('active', 'suspended'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hospitals_h_code ON hospitals (h_code);
+
+CREATE TABLE IF NOT EXISTS staffs (
+	id bigserial PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	username text NOT NULL,
+	password text NOT NULL,
+	hospital text NOT NULL,
+	role varchar(32) NOT NULL DEFAULT 'registration_clerk',
+	must_change_password boolean NOT NULL DEFAULT false,
+	password_changed_at timestamptz,
+	failed_login_attempts bigint NOT NULL DEFAULT 0,
+	last_failed_login_at timestamptz,
+	locked_until timestamptz,
+	mfa_enabled boolean NOT NULL DEFAULT false,
+	mfa_secret text,
+	mfa_last_used_step bigint NOT NULL DEFAULT 0,
+	deactivated_at timestamptz,
+	deactivated_by bigint,
+	CONSTRAINT uni_staffs_username UNIQUE (username)
+);
+-- Staff เดิมทุกคนได้ role default ให้ admin ตั้ง role จริงภายหลัง
+ALTER TABLE staffs
+	ADD COLUMN IF NOT EXISTS role varchar(32) NOT NULL DEFAULT 'registration_clerk',
+	ADD COLUMN IF NOT EXISTS must_change_password boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS password_changed_at timestamptz,
+	ADD COLUMN IF NOT EXISTS failed_login_attempts bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS last_failed_login_at timestamptz,
+	ADD COLUMN IF NOT EXISTS locked_until timestamptz,
+	ADD COLUMN IF NOT EXISTS mfa_enabled boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS mfa_secret text,
+	ADD COLUMN IF NOT EXISTS mfa_last_used_step bigint NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS deactivated_at timestamptz,
+	ADD COLUMN IF NOT EXISTS deactivated_by bigint;
+CREATE INDEX IF NOT EXISTS idx_staffs_deleted_at ON staffs (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_staffs_hospital ON staffs (hospital);
+
+CREATE TABLE IF NOT EXISTS patients (
+	id bigserial PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	first_name_th text NOT NULL,
+	middle_name_th text,
+	last_name_th text NOT NULL,
+	first_name_en text,
+	middle_name_en text,
+	last_name_en text,
+	date_of_birth timestamptz NOT NULL,
+	patient_hn text,
+	national_id text,
+	national_id_index char(64),
+	passport_id text,
+	passport_id_index char(64),
+	phone_number text NOT NULL,
+	phone_number_index char(64),
+	email text,
+	email_index char(64),
+	gender text NOT NULL,
+	hospital text NOT NULL,
+	CONSTRAINT chk_patients_gender CHECK (gender IN ('M', 'F'))
+);
+ALTER TABLE patients
+	ADD COLUMN IF NOT EXISTS national_id_index char(64),
+	ADD COLUMN IF NOT EXISTS passport_id_index char(64),
+	ADD COLUMN IF NOT EXISTS phone_number_index char(64),
+	ADD COLUMN IF NOT EXISTS email_index char(64),
+	DROP CONSTRAINT IF EXISTS uni_patients_patient_hn,
+	DROP CONSTRAINT IF EXISTS uni_patients_national_id,
+	DROP CONSTRAINT IF EXISTS uni_patients_passport_id,
+	DROP CONSTRAINT IF EXISTS uni_patients_email;
+UPDATE patients SET email = NULL WHERE email = '';
+CREATE INDEX IF NOT EXISTS idx_patients_deleted_at ON patients (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_hospital_hn ON patients (hospital, patient_hn);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_hospital_national_id_bidx ON patients (hospital, national_id_index);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_hospital_passport_id_bidx ON patients (hospital, passport_id_index);
+CREATE INDEX IF NOT EXISTS idx_patients_hospital_phone_number_bidx ON patients (hospital, phone_number_index);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_hospital_email_bidx ON patients (hospital, email_index);
+
+CREATE TABLE IF NOT EXISTS hn_formats (
+	hospital text PRIMARY KEY,
+	prefix text NOT NULL DEFAULT '',
+	year_digits bigint NOT NULL DEFAULT 2,
+	separator text NOT NULL DEFAULT '-',
+	number_digits bigint NOT NULL DEFAULT 6,
+	created_at timestamptz,
+	updated_at timestamptz,
+	CONSTRAINT chk_hn_formats_year_digits CHECK (year_digits IN (0, 2, 4)),
+	CONSTRAINT chk_hn_formats_number_digits CHECK (number_digits BETWEEN 1 AND 12)
+);
+
+CREATE TABLE IF NOT EXISTS hn_sequences (
+	hospital text,
+	year bigint,
+	last_value bigint NOT NULL DEFAULT 0,
+	updated_at timestamptz,
+	PRIMARY KEY (hospital, year)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id bigserial PRIMARY KEY,
+	staff_id bigint NOT NULL,
+	token_hash text NOT NULL,
+	family_id text NOT NULL,
+	expires_at timestamptz NOT NULL,
+	revoked_at timestamptz,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_staff_id ON refresh_tokens (staff_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti text PRIMARY KEY,
+	staff_id bigint NOT NULL,
+	expires_at timestamptz NOT NULL,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	id bigserial PRIMARY KEY,
+	username text NOT NULL,
+	hospital text NOT NULL,
+	ip text NOT NULL,
+	success boolean NOT NULL,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts (username);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip_created_at ON login_attempts (ip, created_at);
+
+CREATE TABLE IF NOT EXISTS lockout_events (
+	id bigserial PRIMARY KEY,
+	staff_id bigint NOT NULL,
+	username text NOT NULL,
+	hospital text NOT NULL,
+	event text NOT NULL,
+	reason text NOT NULL,
+	ip text,
+	locked_until timestamptz,
+	actor_id bigint,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_lockout_events_staff_id ON lockout_events (staff_id);
+CREATE INDEX IF NOT EXISTS idx_lockout_events_hospital ON lockout_events (hospital);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+	id bigserial PRIMARY KEY,
+	staff_id bigint NOT NULL,
+	code_hash text NOT NULL,
+	used_at timestamptz,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_staff_id ON mfa_recovery_codes (staff_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mfa_recovery_codes_code_hash ON mfa_recovery_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS password_histories (
+	id bigserial PRIMARY KEY,
+	staff_id bigint NOT NULL,
+	hash text NOT NULL,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_password_histories_staff_id ON password_histories (staff_id);
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+	id bigserial PRIMARY KEY,
+	staff_id bigint NOT NULL,
+	token_hash text NOT NULL,
+	expires_at timestamptz NOT NULL,
+	used_at timestamptz,
+	created_by bigint NOT NULL,
+	created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_staff_id ON password_reset_tokens (staff_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_reset_tokens_token_hash ON password_reset_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS audit_entries (
+	id bigserial PRIMARY KEY,
+	hospital varchar(64) NOT NULL,
+	seq bigint NOT NULL,
+	actor_id bigint NOT NULL,
+	actor_role text NOT NULL,
+	action text NOT NULL,
+	patient_ids text NOT NULL,
+	query text NOT NULL,
+	ip text NOT NULL,
+	request_id text NOT NULL,
+	created_at timestamptz NOT NULL,
+	prev_hash char(64) NOT NULL,
+	hash char(64) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_audit_entries_hospital_seq ON audit_entries (hospital, seq);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_actor_id ON audit_entries (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_action ON audit_entries (action);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries (created_at);
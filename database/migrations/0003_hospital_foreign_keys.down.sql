@@ -0,0 +1,2 @@
+ALTER TABLE patients DROP CONSTRAINT IF EXISTS fk_patients_hospital_ref;
+ALTER TABLE staffs DROP CONSTRAINT IF EXISTS fk_staffs_hospital_ref;
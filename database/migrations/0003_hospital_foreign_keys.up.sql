@@ -0,0 +1,13 @@
+-- staffs/patients ต้องอ้างถึงโรงพยาบาลที่ลงทะเบียนไว้ (ข้อมูลเดิมถูกแปลงเป็นรหัสใน 0002 แล้ว)
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'staffs'::regclass AND conname = 'fk_staffs_hospital_ref') THEN
+		ALTER TABLE staffs ADD CONSTRAINT fk_staffs_hospital_ref
+			FOREIGN KEY (hospital) REFERENCES hospitals (code) ON UPDATE CASCADE ON DELETE RESTRICT;
+	END IF;
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'patients'::regclass AND conname = 'fk_patients_hospital_ref') THEN
+		ALTER TABLE patients ADD CONSTRAINT fk_patients_hospital_ref
+			FOREIGN KEY (hospital) REFERENCES hospitals (code) ON UPDATE CASCADE ON DELETE RESTRICT;
+	END IF;
+END
+$$;
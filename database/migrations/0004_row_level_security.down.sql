@@ -0,0 +1,11 @@
+DROP POLICY IF EXISTS hospital_isolation ON hn_sequences;
+ALTER TABLE hn_sequences NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE hn_sequences DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS hospital_isolation ON hn_formats;
+ALTER TABLE hn_formats NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE hn_formats DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS hospital_isolation ON patients;
+ALTER TABLE patients NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE patients DISABLE ROW LEVEL SECURITY;
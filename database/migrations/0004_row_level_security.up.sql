@@ -0,0 +1,24 @@
+-- แยกข้อมูลตามโรงพยาบาลด้วย row-level security (ตัวแปร session ดู database/rls.go)
+-- ถ้าไม่ได้ตั้ง app.current_hospital จะไม่เห็นแถวใดเลย ใช้ FORCE เพื่อให้มีผลกับ owner ของตาราง (role ของแอป) ด้วย
+-- แต่ superuser และ role ที่มี BYPASSRLS จะข้าม policy เสมอ แอปจึงต้องเชื่อมต่อด้วย role ธรรมดา
+
+ALTER TABLE patients ENABLE ROW LEVEL SECURITY;
+ALTER TABLE patients FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS hospital_isolation ON patients;
+CREATE POLICY hospital_isolation ON patients
+	USING (hospital = current_setting('app.current_hospital', true) OR current_setting('app.bypass_rls', true) = 'on')
+	WITH CHECK (hospital = current_setting('app.current_hospital', true) OR current_setting('app.bypass_rls', true) = 'on');
+
+ALTER TABLE hn_formats ENABLE ROW LEVEL SECURITY;
+ALTER TABLE hn_formats FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS hospital_isolation ON hn_formats;
+CREATE POLICY hospital_isolation ON hn_formats
+	USING (hospital = current_setting('app.current_hospital', true) OR current_setting('app.bypass_rls', true) = 'on')
+	WITH CHECK (hospital = current_setting('app.current_hospital', true) OR current_setting('app.bypass_rls', true) = 'on');
+
+ALTER TABLE hn_sequences ENABLE ROW LEVEL SECURITY;
+ALTER TABLE hn_sequences FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS hospital_isolation ON hn_sequences;
+CREATE POLICY hospital_isolation ON hn_sequences
+	USING (hospital = current_setting('app.current_hospital', true) OR current_setting('app.bypass_rls', true) = 'on')
+	WITH CHECK (hospital = current_setting('app.current_hospital', true) OR current_setting('app.bypass_rls', true) = 'on');
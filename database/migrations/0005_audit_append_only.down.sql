@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries;
+DROP TRIGGER IF EXISTS audit_entries_no_modify ON audit_entries;
+DROP FUNCTION IF EXISTS audit_entries_append_only();
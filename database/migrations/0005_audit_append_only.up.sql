@@ -0,0 +1,17 @@
+-- ห้ามแก้ไขหรือลบแถวใน audit_entries (รวมถึง TRUNCATE) ด้วย trigger ระดับฐานข้อมูล
+-- role ของแอปเป็นเจ้าของตารางจึง REVOKE สิทธิ์ของตัวเองไม่ได้ trigger จึงเป็นด่านแรก
+-- ส่วนการแก้ที่ข้าม trigger (เช่นปิด trigger ด้วยสิทธิ์ owner) จะถูกตรวจพบด้วย hash chain
+
+CREATE OR REPLACE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_entries_no_modify ON audit_entries;
+CREATE TRIGGER audit_entries_no_modify BEFORE UPDATE OR DELETE ON audit_entries
+	FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only();
+
+DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries;
+CREATE TRIGGER audit_entries_no_truncate BEFORE TRUNCATE ON audit_entries
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only();
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// ตัวแปร session ที่ policy ของ row-level security อ่าน (policy อยู่ใน migrations/0004_row_level_security.up.sql)
+//   - app.current_hospital : รหัสโรงพยาบาลของ request ปัจจุบัน (middlewares.TenantTransaction ตั้งให้)
+//   - app.bypass_rls       : "on" สำหรับงานบำรุงรักษาที่ต้องเห็นข้อมูลทุกโรงพยาบาล (ดู WithoutRLS)
+//
+// ทั้งสองค่าตั้งด้วย set_config(..., true) จึงมีผลแค่ใน transaction นั้น ไม่ค้างไปกับ connection ใน pool
+// ค่า bypass ไม่ใช่กลไกป้องกันผู้ที่สั่ง SQL ได้เอง แต่กันไม่ให้โค้ดที่ลืมกรองโรงพยาบาลเห็นข้อมูลข้ามโรงพยาบาล
+const (
+	CurrentHospitalSetting = "app.current_hospital"
+	BypassRLSSetting       = "app.bypass_rls"
+)
+
+// ตั้งโรงพยาบาลปัจจุบันให้ transaction ที่ใช้อยู่
+func SetCurrentHospital(tx *gorm.DB, hospital string) error {
+	return tx.Exec("SELECT set_config(?, ?, true)", CurrentHospitalSetting, hospital).Error
+}
+
+// รัน fn ใน transaction ที่ข้าม policy ของ row-level security
+// ใช้เฉพาะงานบำรุงรักษา (migration, คำสั่ง CLI) ห้ามใช้ใน request ของผู้ใช้
+func WithoutRLS(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT set_config(?, 'on', true)", BypassRLSSetting).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// เตือนถ้า role ที่เชื่อมต่ออยู่ข้าม row-level security ได้ (superuser หรือ BYPASSRLS)
+// ซึ่งทำให้ policy ไม่มีผล
+func WarnIfRLSBypassed(db *gorm.DB) {
+	var bypass bool
+	err := db.Raw("SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user").Scan(&bypass).Error
+	if err != nil {
+		log.Println("Could not check database role:", err)
+		return
+	}
+	if bypass {
+		log.Println("WARNING: database role is a superuser or has BYPASSRLS; row-level security is not enforced. Connect with a dedicated application role.")
+	}
+}
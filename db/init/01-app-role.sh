@@ -0,0 +1,10 @@
+#!/bin/bash
+# สร้าง role ของแอปตอน init ฐานข้อมูลครั้งแรก
+# ต้องไม่เป็น superuser และไม่มี BYPASSRLS ไม่งั้น row-level security จะไม่มีผล
+set -e
+
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" <<-EOSQL
+	CREATE ROLE "${APP_DB_USER}" LOGIN PASSWORD '${APP_DB_PASSWORD}' NOSUPERUSER NOBYPASSRLS NOCREATEDB NOCREATEROLE;
+	GRANT CONNECT, TEMPORARY ON DATABASE "${POSTGRES_DB}" TO "${APP_DB_USER}";
+	GRANT USAGE, CREATE ON SCHEMA public TO "${APP_DB_USER}";
+EOSQL
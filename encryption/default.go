@@ -0,0 +1,48 @@
+package encryption
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"HIS-api/config"
+)
+
+var (
+	defaultOnce    sync.Once
+	defaultKeyring *Keyring
+	defaultErr     error
+)
+
+// โหลด keyring หลักของระบบจาก ENCRYPTION_KEYRING (config.Current().Encryption.Keyring path ของไฟล์ keyring) ทำครั้งเดียว
+// ถ้ายังไม่มีไฟล์จะสร้างให้ ไฟล์นี้ต้องสำรองไว้เสมอ ถ้าหายจะถอดรหัสข้อมูลผู้ป่วยไม่ได้อีก
+func Init() (*Keyring, error) {
+	defaultOnce.Do(func() {
+		path := config.Current().Encryption.Keyring
+		if path == "" {
+			defaultErr = errors.New("ENCRYPTION_KEYRING is not set")
+			return
+		}
+
+		var created bool
+		defaultKeyring, created, defaultErr = LoadOrCreate(path)
+		if created {
+			log.Println("Warning: created a new encryption keyring at", path, "- back it up, encrypted patient data cannot be recovered without it")
+		}
+	})
+	return defaultKeyring, defaultErr
+}
+
+// keyring หลักของระบบ ต้องเรียก Init ให้ผ่านตอนเริ่มระบบก่อน
+func Default() *Keyring {
+	k, err := Init()
+	if err != nil {
+		panic("encryption: keyring is not available: " + err.Error())
+	}
+	return k
+}
+
+// blind index ด้วย keyring หลัก
+func BlindIndex(column, value string) string {
+	return Default().BlindIndex(column, value)
+}
@@ -0,0 +1,368 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ข้อความเข้ารหัสทุกค่าขึ้นต้นด้วย prefix นี้ ค่าที่ไม่มี prefix ถือว่าเป็นข้อมูลเดิมที่ยังไม่ได้เข้ารหัส
+const Prefix = "enc:v1:"
+
+// รอบที่ server ตรวจว่าไฟล์ keyring เปลี่ยนหรือไม่ (ดู Watch)
+const ReloadInterval = time.Minute
+
+var (
+	ErrUnknownKey        = errors.New("unknown encryption key")
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// ไฟล์ keyring (JSON) เก็บกุญแจหลัก (KEK) หลายรุ่นและกุญแจของ blind index
+//   - Primary  : kid ของกุญแจที่ใช้เข้ารหัสค่าใหม่
+//   - Keys     : kid -> กุญแจ AES-256 (base64) กุญแจเก่ายังต้องเก็บไว้จนกว่าจะ rewrap ครบ
+//   - IndexKey : กุญแจ HMAC ของ blind index ห้ามเปลี่ยน เพราะต้องคำนวณ index ของทุกแถวใหม่
+type keyringFile struct {
+	Primary  string            `json:"primary"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// เข้ารหัสแบบ envelope: แต่ละค่ามีกุญแจข้อมูล (DEK) ของตัวเอง และ DEK ถูกห่อด้วยกุญแจหลักใน keyring
+// การหมุนกุญแจหลักจึงแค่ห่อ DEK ใหม่ (Rewrap) โดยไม่ต้องถอดรหัสตัวข้อมูล
+//
+// รูปแบบที่เก็บ: enc:v1:<kid>:<DEK ที่ห่อแล้ว>:<ข้อมูลที่เข้ารหัส> (base64 ทั้งสองส่วน)
+// ข้อมูลเข้ารหัสด้วย AES-256-GCM โดยใช้ชื่อคอลัมน์เป็น associated data
+// จึงย้ายค่าไปวางในคอลัมน์อื่นแล้วถอดรหัสได้ไม่ได้
+type Keyring struct {
+	Path string
+
+	mu       sync.RWMutex
+	primary  string
+	keys     map[string][]byte
+	indexKey []byte
+	modTime  time.Time // mtime ของไฟล์ตอนโหลดล่าสุด
+}
+
+// โหลด keyring จากไฟล์ ถ้ายังไม่มีไฟล์จะสร้างให้พร้อมกุญแจชุดแรก
+func LoadOrCreate(path string) (*Keyring, bool, error) {
+	k := &Keyring{Path: path}
+	err := k.Reload()
+	if errors.Is(err, os.ErrNotExist) {
+		if err := k.create(); err != nil {
+			return nil, false, err
+		}
+		return k, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return k, false, nil
+}
+
+// โหลดไฟล์ keyring ใหม่ (เช่นหลัง replica อื่นหมุนกุญแจ)
+func (k *Keyring) Reload() error {
+	info, err := os.Stat(k.Path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(k.Path)
+	if err != nil {
+		return err
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("keyring %s: %w", k.Path, err)
+	}
+
+	keys := map[string][]byte{}
+	for kid, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("keyring %s: key %q must be 32 bytes of base64", k.Path, kid)
+		}
+		keys[kid] = key
+	}
+	if _, ok := keys[file.Primary]; !ok {
+		return fmt.Errorf("keyring %s: primary key %q not found", k.Path, file.Primary)
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(file.IndexKey)
+	if err != nil || len(indexKey) < 32 {
+		return fmt.Errorf("keyring %s: index_key must be at least 32 bytes of base64", k.Path)
+	}
+
+	k.mu.Lock()
+	k.primary, k.keys, k.indexKey, k.modTime = file.Primary, keys, indexKey, info.ModTime()
+	k.mu.Unlock()
+	return nil
+}
+
+// ตรวจไฟล์ keyring ทุกรอบ interval และโหลดใหม่เมื่อ mtime เปลี่ยน จนกว่าจะปิด stop
+// server ที่รันอยู่จึงเปลี่ยนไปเข้ารหัสค่าใหม่ด้วย primary ใหม่ภายในหนึ่งรอบหลังหมุนกุญแจ
+func (k *Keyring) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.reloadIfChanged(); err != nil {
+				log.Println("Reloading encryption keyring failed:", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (k *Keyring) reloadIfChanged() error {
+	info, err := os.Stat(k.Path)
+	if err != nil {
+		return err
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	previous := k.primary
+	k.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	if err := k.Reload(); err != nil {
+		return err
+	}
+	if primary := k.Primary(); primary != previous {
+		log.Printf("Encryption keyring reloaded, new values are encrypted with key %q", primary)
+	}
+	return nil
+}
+
+func (k *Keyring) create() error {
+	kid, key, err := newKey()
+	if err != nil {
+		return err
+	}
+	indexKey := make([]byte, 32)
+	if _, err := rand.Read(indexKey); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.primary, k.keys, k.indexKey = kid, map[string][]byte{kid: key}, indexKey
+	k.mu.Unlock()
+	return k.save()
+}
+
+// เขียน keyring ลงไฟล์แบบ atomic (เขียนไฟล์ชั่วคราวแล้ว rename)
+func (k *Keyring) save() error {
+	k.mu.RLock()
+	file := keyringFile{Primary: k.primary, Keys: map[string]string{}, IndexKey: base64.StdEncoding.EncodeToString(k.indexKey)}
+	for kid, key := range k.keys {
+		file.Keys[kid] = base64.StdEncoding.EncodeToString(key)
+	}
+	k.mu.RUnlock()
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0o700); err != nil {
+		return err
+	}
+	tmp := k.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.Path)
+}
+
+func newKey() (string, []byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", nil, err
+	}
+	return time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(suffix), key, nil
+}
+
+// เพิ่มกุญแจหลักใหม่และใช้เป็น primary แล้วบันทึกลงไฟล์ คืน kid ของกุญแจใหม่
+// ค่าที่เข้ารหัสไว้แล้วยังถอดได้ด้วยกุญแจเก่า ต้องเรียก Rewrap กับทุกค่าเพื่อย้ายมาใช้กุญแจใหม่
+// server อื่นยังเข้ารหัสด้วยกุญแจเก่าจนกว่าจะโหลดไฟล์ใหม่ (ดู Watch)
+func (k *Keyring) Rotate() (string, error) {
+	kid, key, err := newKey()
+	if err != nil {
+		return "", err
+	}
+	k.mu.Lock()
+	k.keys[kid] = key
+	k.primary = kid
+	k.mu.Unlock()
+	return kid, k.save()
+}
+
+// kid ของกุญแจที่ใช้เข้ารหัสค่าใหม่
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.primary
+}
+
+func (k *Keyring) key(kid string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func seal(key, plaintext, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// แยกส่วนของข้อความเข้ารหัส: kid, DEK ที่ห่อแล้ว, ข้อมูล
+func parse(ciphertext string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(ciphertext, Prefix), ":")
+	if !strings.HasPrefix(ciphertext, Prefix) || len(parts) != 3 {
+		return "", nil, nil, ErrInvalidCiphertext
+	}
+	wrapped, err1 := base64.RawStdEncoding.DecodeString(parts[1])
+	data, err2 := base64.RawStdEncoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil {
+		return "", nil, nil, ErrInvalidCiphertext
+	}
+	return parts[0], wrapped, data, nil
+}
+
+func format(kid string, wrapped, data []byte) string {
+	return Prefix + kid + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" + base64.RawStdEncoding.EncodeToString(data)
+}
+
+// เข้ารหัสค่าของคอลัมน์ column ด้วย DEK ใหม่ที่ห่อด้วยกุญแจ primary
+func (k *Keyring) Encrypt(column, plaintext string) (string, error) {
+	kid := k.Primary()
+	kek, _ := k.key(kid)
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(kek, dek, []byte(kid))
+	if err != nil {
+		return "", err
+	}
+	data, err := seal(dek, []byte(plaintext), []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return format(kid, wrapped, data), nil
+}
+
+// แกะ DEK ที่ห่อไว้ ถ้าไม่รู้จัก kid จะโหลดไฟล์ keyring ใหม่หนึ่งครั้ง (อาจมีการหมุนกุญแจจากที่อื่น)
+func (k *Keyring) unwrap(kid string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.key(kid)
+	if !ok && k.Path != "" && k.Reload() == nil {
+		kek, ok = k.key(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	return open(kek, wrapped, []byte(kid))
+}
+
+// ถอดรหัสค่าของคอลัมน์ column ค่าที่ไม่ได้ขึ้นต้นด้วย Prefix จะคืนตามเดิม (ข้อมูลก่อนเข้ารหัส)
+func (k *Keyring) Decrypt(column, ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, Prefix) {
+		return ciphertext, nil
+	}
+	kid, wrapped, data, err := parse(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	dek, err := k.unwrap(kid, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, data, []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ห่อ DEK ของค่าที่เข้ารหัสไว้ใหม่ด้วยกุญแจ primary (ไม่แตะตัวข้อมูล)
+// คืน changed = false ถ้าค่านั้นใช้กุญแจ primary อยู่แล้ว
+func (k *Keyring) Rewrap(ciphertext string) (string, bool, error) {
+	kid, wrapped, data, err := parse(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+	primary := k.Primary()
+	if kid == primary {
+		return ciphertext, false, nil
+	}
+	dek, err := k.unwrap(kid, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+	kek, _ := k.key(primary)
+	rewrapped, err := seal(kek, dek, []byte(primary))
+	if err != nil {
+		return "", false, err
+	}
+	return format(primary, rewrapped, data), true, nil
+}
+
+// blind index ของค่าในคอลัมน์ column ใช้ค้นหาแบบเท่ากันโดยไม่ต้องถอดรหัส
+// คือ HMAC-SHA256 ด้วย index key แยกตามคอลัมน์ ค่าเดียวกันในคอลัมน์ต่างกันจึงได้ index ต่างกัน
+func (k *Keyring) BlindIndex(column, value string) string {
+	k.mu.RLock()
+	mac := hmac.New(sha256.New, k.indexKey)
+	k.mu.RUnlock()
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
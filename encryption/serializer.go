@@ -0,0 +1,68 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// gorm serializer สำหรับคอลัมน์ที่เข้ารหัส ใช้กับฟิลด์ string หรือ *string
+// ด้วย tag `gorm:"serializer:encrypted"` ค่าใน struct เป็นข้อความปกติ ส่วนในฐานข้อมูลเป็นข้อความเข้ารหัส
+//
+// query ด้วยค่าจริงไม่ได้ (ข้อความเข้ารหัสสุ่มใหม่ทุกครั้ง) ต้องค้นผ่านคอลัมน์ blind index แทน
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType)
+
+	if dbValue != nil {
+		var raw string
+		switch v := dbValue.(type) {
+		case []byte:
+			raw = string(v)
+		case string:
+			raw = v
+		default:
+			return fmt.Errorf("encrypted column %s: unsupported value %T", field.DBName, dbValue)
+		}
+
+		plaintext, err := Default().Decrypt(field.DBName, raw)
+		if err != nil {
+			return fmt.Errorf("decrypting %s: %w", field.DBName, err)
+		}
+
+		switch field.FieldType.Kind() {
+		case reflect.Ptr:
+			ptr := reflect.New(field.FieldType.Elem())
+			ptr.Elem().SetString(plaintext)
+			fieldValue.Elem().Set(ptr)
+		case reflect.String:
+			fieldValue.Elem().SetString(plaintext)
+		default:
+			return fmt.Errorf("encrypted column %s: unsupported field type %s", field.DBName, field.FieldType)
+		}
+	}
+
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	switch v := fieldValue.(type) {
+	case string:
+		return Default().Encrypt(field.DBName, v)
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		return Default().Encrypt(field.DBName, *v)
+	default:
+		return nil, fmt.Errorf("encrypted column %s: unsupported field type %T", field.DBName, fieldValue)
+	}
+}
@@ -0,0 +1,53 @@
+package keys
+
+import (
+	"log"
+	"sync"
+
+	"HIS-api/config"
+)
+
+var (
+	defaultOnce    sync.Once
+	defaultManager *Manager
+	defaultErr     error
+)
+
+// สร้าง Manager หลักของระบบจาก config.Current().JWT (ทำครั้งเดียว)
+//   - JWT_KEYS_DIR              : ไดเรกทอรีเก็บกุญแจ ถ้าไม่ตั้งจะใช้กุญแจชั่วคราวในหน่วยความจำ
+//   - JWT_SIGNING_ALG           : RS256 หรือ ES256 (default ES256) ใช้ตอนสร้างกุญแจใหม่
+//   - JWT_KEY_ROTATION_INTERVAL : รอบการสร้างกุญแจใหม่อัตโนมัติ เช่น 720h (default ไม่หมุนเอง)
+//   - JWT_KEY_RETENTION         : ระยะที่เก็บกุญแจเก่าไว้ตรวจ token หลังหมุนแล้ว (default 24h)
+func Init() (*Manager, error) {
+	defaultOnce.Do(func() {
+		cfg := config.Current().JWT
+		algorithm := cfg.SigningAlg
+		if algorithm == "" {
+			algorithm = AlgES256
+		}
+
+		dir := cfg.KeysDir
+		if dir == "" {
+			log.Println("Warning: JWT_KEYS_DIR not set, using an ephemeral signing key (tokens will not survive a restart)")
+			defaultManager, defaultErr = NewEphemeral(algorithm)
+			return
+		}
+
+		defaultManager, defaultErr = NewFromDir(
+			dir,
+			algorithm,
+			cfg.RotationInterval,
+			cfg.Retention,
+		)
+	})
+	return defaultManager, defaultErr
+}
+
+// Manager หลักของระบบ ต้องเรียก Init ให้ผ่านตอนเริ่มระบบก่อน
+func Default() *Manager {
+	m, err := Init()
+	if err != nil {
+		panic("keys: signing keys are not available: " + err.Error())
+	}
+	return m
+}
@@ -0,0 +1,382 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// อัลกอริทึมที่รองรับ (ไม่รองรับ HS256 อีกต่อไป เพื่อให้ service อื่นตรวจ token ได้โดยไม่ต้องรู้ secret)
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// ทุก replica โหลดไดเรกทอรีกุญแจใหม่ทุก ReloadInterval และ service อื่น cache JWKS ไว้นาน JWKSMaxAge
+// กุญแจใหม่จึงต้องรอให้ครบทั้งสองช่วงก่อนใช้เซ็น มิฉะนั้นฝั่งตรวจจะยังไม่รู้จัก kid
+const (
+	ReloadInterval = time.Minute
+	JWKSMaxAge     = 5 * time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// คู่กุญแจสำหรับเซ็น JWT 1 ชุด ID ใช้เป็น kid ใน header ของ token และใน JWKS
+// Generated = ระบบสร้างเอง (มีไฟล์ <kid>.json คู่กัน) เฉพาะกุญแจแบบนี้ที่ระบบลบเองเมื่อเลยระยะเก็บรักษา
+type Key struct {
+	ID        string
+	Signer    crypto.Signer
+	Method    jwt.SigningMethod
+	CreatedAt time.Time
+	Generated bool
+}
+
+// ข้อมูลประกอบของกุญแจที่ระบบสร้าง เก็บในไฟล์ <kid>.json ข้างไฟล์ .pem
+// เวลาสร้างต้องไม่อิง mtime เพราะเปลี่ยนได้เมื่อคัดลอกหรือ restore ไฟล์
+type keyMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	Generated bool      `json:"generated"`
+}
+
+// ตัวจัดการกุญแจ โหลดกุญแจทั้งหมดจากไดเรกทอรี (ไฟล์ <kid>.pem) ทุกกุญแจใช้ตรวจ token ได้
+// แต่เซ็นด้วยกุญแจที่ใหม่ที่สุดซึ่งเผยแพร่มานานกว่า ActivateAfter แล้วเท่านั้น การหมุนกุญแจทำได้โดยวางไฟล์ใหม่
+// ลงในไดเรกทอรี (เวลาสร้างของไฟล์ที่วางเองใช้ mtime) หรือตั้ง RotateEvery ให้ระบบสร้างกุญแจใหม่เองตามรอบ
+type Manager struct {
+	Dir           string
+	Algorithm     string
+	RotateEvery   time.Duration // 0 = ไม่สร้างกุญแจใหม่เอง
+	RetainFor     time.Duration // ระยะที่ยังเก็บกุญแจเก่าไว้ตรวจ token หลังเลิกใช้เซ็น (ควร >= อายุ access token)
+	ActivateAfter time.Duration // ระยะที่กุญแจใหม่ต้องอยู่ใน JWKS ก่อนเริ่มใช้เซ็น
+
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active *Key
+}
+
+// สร้าง Manager ที่เก็บกุญแจไว้ในหน่วยความจำอย่างเดียว (กุญแจหายเมื่อ restart)
+// ใช้สำหรับ development และ test เท่านั้น
+func NewEphemeral(algorithm string) (*Manager, error) {
+	m := &Manager{Algorithm: algorithm, keys: map[string]*Key{}}
+	key, err := generate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	m.keys[key.ID] = key
+	m.active = key
+	return m, nil
+}
+
+// สร้าง Manager จากไดเรกทอรีกุญแจ ถ้ายังไม่มีกุญแจเลยจะสร้างให้ 1 ชุด
+func NewFromDir(dir, algorithm string, rotateEvery, retainFor time.Duration) (*Manager, error) {
+	m := &Manager{
+		Dir:           dir,
+		Algorithm:     algorithm,
+		RotateEvery:   rotateEvery,
+		RetainFor:     retainFor,
+		ActivateAfter: ReloadInterval + JWKSMaxAge,
+		keys:          map[string]*Key{},
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// โหลดกุญแจจากไดเรกทอรีใหม่ และหมุนกุญแจถ้าถึงรอบ
+func (m *Manager) Reload() error {
+	if m.Dir == "" {
+		return nil
+	}
+
+	loaded, err := loadDir(m.Dir)
+	if err != nil {
+		return err
+	}
+
+	// กุญแจใหม่ถูกเผยแพร่ใน JWKS ทันที แต่ยังไม่ใช้เซ็นจนกว่าจะครบ ActivateAfter
+	newest := newestKey(loaded)
+	if newest == nil || (m.RotateEvery > 0 && time.Since(newest.CreatedAt) >= m.RotateEvery) {
+		key, err := generate(m.Algorithm)
+		if err != nil {
+			return err
+		}
+		if err := writeKey(m.Dir, key); err != nil {
+			return err
+		}
+		log.Printf("Generated new %s signing key %s", key.Method.Alg(), key.ID)
+		loaded[key.ID] = key
+	}
+	active := m.activeKey(loaded)
+
+	// ลบเฉพาะกุญแจที่ระบบสร้างเองและเลยระยะเก็บรักษาแล้ว (token ที่เซ็นด้วยกุญแจนั้นหมดอายุไปหมดแล้ว)
+	// กุญแจถูกใช้เซ็นจนกุญแจถัดไปเริ่มใช้ คือประมาณ RotateEvery + ActivateAfter หลังสร้าง
+	if m.RotateEvery > 0 {
+		for id, key := range loaded {
+			if !key.Generated || key == active || time.Since(key.CreatedAt) <= m.RotateEvery+m.ActivateAfter+m.RetainFor {
+				continue
+			}
+			if err := os.Remove(filepath.Join(m.Dir, id+".pem")); err == nil {
+				os.Remove(filepath.Join(m.Dir, id+".json"))
+				log.Printf("Retired signing key %s", id)
+				delete(loaded, id)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = loaded
+	m.active = active
+	m.mu.Unlock()
+	return nil
+}
+
+// กุญแจที่ใหม่ที่สุดซึ่งเผยแพร่มานานพอแล้ว ถ้ายังไม่มี (เช่น เพิ่งสร้างกุญแจแรก) ใช้กุญแจที่ใหม่ที่สุด
+func (m *Manager) activeKey(keys map[string]*Key) *Key {
+	var active *Key
+	for _, key := range keys {
+		if time.Since(key.CreatedAt) < m.ActivateAfter {
+			continue
+		}
+		if active == nil || key.CreatedAt.After(active.CreatedAt) {
+			active = key
+		}
+	}
+	if active == nil {
+		return newestKey(keys)
+	}
+	return active
+}
+
+// โหลดกุญแจใหม่ตามรอบ interval จนกว่าจะปิด stop
+func (m *Manager) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Reload(); err != nil {
+				log.Println("Reloading signing keys failed:", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// เซ็น claims ด้วยกุญแจที่ active อยู่ พร้อมใส่ kid ใน header
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key := m.active
+	m.mu.RUnlock()
+	if key == nil {
+		return "", ErrUnknownKey
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Signer)
+}
+
+// ใช้เป็น jwt.Keyfunc หา public key จาก kid และตรวจว่าอัลกอริทึมตรงกับชนิดกุญแจ
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.Signer.Public(), nil
+}
+
+// อัลกอริทึมที่ยอมรับตอนตรวจ token
+func ValidMethods() []string {
+	return []string{AlgRS256, AlgES256}
+}
+
+// รายการกุญแจทั้งหมดเรียงจากใหม่ไปเก่า
+func (m *Manager) Keys() []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Key, 0, len(m.keys))
+	for _, key := range m.keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+func newestKey(keys map[string]*Key) *Key {
+	var newest *Key
+	for _, key := range keys {
+		if newest == nil || key.CreatedAt.After(newest.CreatedAt) {
+			newest = key
+		}
+	}
+	return newest
+}
+
+// kid มีส่วนสุ่มต่อท้าย เพราะหลาย replica อาจสร้างกุญแจพร้อมกันในวินาทีเดียว
+func generate(algorithm string) (*Key, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := &Key{
+		ID:        "k" + now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		CreatedAt: now,
+		Generated: true,
+	}
+	switch algorithm {
+	case AlgES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.Signer, key.Method = priv, jwt.SigningMethodES256
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key.Signer, key.Method = priv, jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	return key, nil
+}
+
+// เขียนไฟล์ข้อมูลประกอบก่อน .pem เพื่อให้ replica อื่นไม่เห็นกุญแจโดยไม่มีเวลาสร้าง
+func writeKey(dir string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Signer)
+	if err != nil {
+		return err
+	}
+	meta, err := json.Marshal(keyMeta{CreatedAt: key.CreatedAt.UTC(), Generated: key.Generated})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, key.ID+".json"), meta); err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return writeFileAtomic(filepath.Join(dir, key.ID+".pem"), data)
+}
+
+// เขียนไฟล์ชั่วคราวแล้ว rename เพื่อไม่ให้ replica อื่นอ่านได้ไฟล์ที่เขียนไม่ครบ
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadDir(dir string) (map[string]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*Key{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		key, err := loadKey(path)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v", path, err)
+			continue
+		}
+		keys[key.ID] = key
+	}
+	return keys, nil
+}
+
+func loadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var priv interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+		CreatedAt: info.ModTime(),
+	}
+	// กุญแจที่ระบบสร้างมีเวลาสร้างในไฟล์ข้อมูลประกอบ กุญแจที่วางเองใช้ mtime
+	if raw, err := os.ReadFile(strings.TrimSuffix(path, ".pem") + ".json"); err == nil {
+		var meta keyMeta
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("reading key metadata: %w", err)
+		}
+		key.CreatedAt, key.Generated = meta.CreatedAt, meta.Generated
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		key.Signer, key.Method = k, jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("EC key must use curve P-256")
+		}
+		key.Signer, key.Method = k, jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", priv)
+	}
+	return key, nil
+}
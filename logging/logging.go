@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// ตั้ง logger กลางของระบบเป็น JSON (ผ่าน Redactor) ทั้ง slog.Default และ package log มาตรฐาน
+// level เป็น debug, info, warn หรือ error
+func Setup(w io.Writer, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("logging: invalid level %q", level)
+	}
+
+	logger := slog.New(NewRedactor(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})))
+	// slog.SetDefault ทำให้ log.Println เดิมถูกส่งต่อเป็น JSON ระดับ info ด้วย
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return nil
+}
+
+// ผูก logger ไว้กับ context ของ request
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// logger ของ request (มี request_id, staff_id, hospital ตามที่ middleware ใส่ไว้) หรือ logger กลางถ้าไม่มี
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// request ID ของ request ปัจจุบัน (ค่าว่างถ้าไม่ได้ผ่าน middleware)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ตรวจว่า request ID ที่ได้จาก header ปลอดภัยพอจะเก็บลง log และ audit (ไม่ยาวเกินและไม่มีอักขระแปลก)
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.:") == ""
+}
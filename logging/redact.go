@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// ค่าที่ใช้แทนข้อมูลที่ระบุตัวบุคคลใน log
+const Redacted = "[REDACTED]"
+
+// ชื่อ attribute ที่ต้องปิดค่าทั้งหมดเสมอ (เทียบแบบไม่สนตัวพิมพ์)
+var sensitiveKeys = map[string]bool{
+	"national_id":   true,
+	"passport_id":   true,
+	"phone":         true,
+	"phone_number":  true,
+	"email":         true,
+	"password":      true,
+	"token":         true,
+	"refresh_token": true,
+	"authorization": true,
+	"code":          true,
+	"recovery_code": true,
+	"secret":        true,
+}
+
+// รูปแบบของข้อมูลที่ระบุตัวบุคคลซึ่งอาจหลุดมากับข้อความ (เช่นใน error ของฐานข้อมูล)
+var sensitivePatterns = []*regexp.Regexp{
+	// อีเมล
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	// เลขบัตรประชาชน 13 หลัก (มีหรือไม่มีขีดคั่น)
+	regexp.MustCompile(`\b\d-?\d{4}-?\d{5}-?\d{2}-?\d\b`),
+	// เบอร์โทร เช่น 0812345678, 081-234-5678, +66812345678
+	regexp.MustCompile(`\+66\d{8,9}\b|\b0\d{1,2}-?\d{3}-?\d{3,4}\b`),
+	// เลขหนังสือเดินทาง เช่น A12345678, AA1234567
+	regexp.MustCompile(`\b[A-Z]{1,2}\d{6,8}\b`),
+}
+
+// ปิดข้อมูลที่ระบุตัวบุคคลในข้อความ
+func RedactString(s string) string {
+	for _, pattern := range sensitivePatterns {
+		s = pattern.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// slog.Handler ที่ปิดเลขบัตรประชาชน หนังสือเดินทาง เบอร์โทร อีเมล และค่าลับ ก่อนส่งต่อให้ handler จริง
+// ทั้งจากชื่อ attribute (sensitiveKeys) และจากรูปแบบของค่าในข้อความ, attribute แบบ string และ error
+type Redactor struct {
+	next slog.Handler
+}
+
+func NewRedactor(next slog.Handler) *Redactor {
+	return &Redactor{next: next}
+}
+
+func (h *Redactor) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Redactor) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *Redactor) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &Redactor{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *Redactor) WithGroup(name string) slog.Handler {
+	return &Redactor{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+
+	value := a.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		// error และค่าที่มี String() ถูกแปลงเป็นข้อความก่อนปิด ค่าชนิดอื่นส่งต่อตามเดิม
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(a.Key, RedactString(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, RedactString(v.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: value}
+}
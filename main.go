@@ -1,21 +1,141 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
+	"HIS-api/commands"
 	"HIS-api/config"
-	"HIS-api/routes"
+	"HIS-api/controllers"
 	"HIS-api/database"
+	"HIS-api/encryption"
+	"HIS-api/keys"
+	"HIS-api/logging"
+	"HIS-api/middlewares"
+	"HIS-api/repository"
+	"HIS-api/routes"
+	"HIS-api/services"
+	"HIS-api/validators"
+	"context"
+	"github.com/gin-gonic/gin"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	r := gin.Default()
-	r.SetTrustedProxies(nil)
+	// โหลดการตั้งค่าทั้งหมดก่อนอย่างอื่น ถ้าค่าไม่ครบหรือไม่ถูกต้องให้หยุดทันที
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := services.CheckMFARoles(); err != nil {
+		log.Fatal(err)
+	}
+
+	// รันคำสั่ง CLI แทนการเปิด server ถ้ามี argument เช่น `./main create-admin ...`
+	if len(os.Args) > 1 {
+		if err := commands.Run(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// log ทั้งหมด (รวม log.Println เดิม) เป็น JSON และปิดข้อมูลที่ระบุตัวผู้ป่วย
+	if err := logging.Setup(os.Stdout, cfg.Log.Level); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("Configuration loaded", "config", cfg)
+	validators.Register()
+
+	// ไม่ใช้ gin.Default() เพราะ logger ของ gin เป็นข้อความธรรมดาและบันทึก query string ที่มีเลขประจำตัวผู้ป่วย
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New()
+	r.Use(middlewares.RequestID(), middlewares.RequestLogger(), middlewares.Metrics(), middlewares.Recovery())
+	// เชื่อถือ X-Forwarded-For เฉพาะจาก proxy ที่กำหนด (เช่น nginx) เพื่อให้ได้ IP จริงของผู้ใช้
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
+	config.ConnectDB()
+	// รัน migration ตอนเริ่มเป็นค่า default ถ้ารันแยกด้วย `./main migrate up` ก่อน deploy ให้ตั้ง MIGRATE_ON_START=false
+	if cfg.Server.MigrateOnStart {
+		if err := database.MigrateDB(); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+	} else if _, err := encryption.Init(); err != nil {
+		log.Fatal("Loading encryption keyring failed: ", err)
+	}
+	database.WarnIfRLSBypassed(config.DB)
+
+	// ตรวจไฟล์ keyring เป็นรอบๆ เพื่อให้เข้ารหัสด้วยกุญแจใหม่หลังหมุนกุญแจ โดยไม่ต้อง restart
+	stopWatching := make(chan struct{})
+	go encryption.Default().Watch(encryption.ReloadInterval, stopWatching)
+
+	// โหลดกุญแจสำหรับเซ็น JWT ถ้าโหลดไม่ได้ให้หยุดทันที แล้วโหลดใหม่ตามรอบเพื่อรับกุญแจที่หมุนเข้ามา
+	signingKeys, err := keys.Init()
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	go signingKeys.Watch(keys.ReloadInterval, stopWatching)
+
+	// audit log ต้องใช้กุญแจ HMAC สำหรับตัวระบุผู้ป่วย ถ้าไม่มีจะบันทึกการเข้าถึงไม่ได้
+	if err := services.CheckAuditKey(); err != nil {
+		log.Fatal(err)
+	}
+
+	health := controllers.NewHealthHandler(config.DB)
+	routes.HealthRoutes(r, health)
+	routes.MetricsRoutes(r)
+	routes.WellKnownRoutes(r)
+	staffRepo := repository.NewPostgresStaff(config.DB)
+	routes.HospitalRoutes(r, controllers.NewHospitalHandler(repository.NewPostgresHospitals(config.DB)), staffRepo, config.DB)
+	routes.StaffRoutes(r, controllers.NewStaffHandler(staffRepo), controllers.NewAuthHandler(staffRepo), staffRepo)
+	routes.PatientRoutes(r, controllers.NewPatientHandler(repository.NewPostgresPatients(config.DB), repository.NewPostgresAuditLog(config.DB)), staffRepo, config.DB)
+	routes.AuditRoutes(r, controllers.NewAuditHandler(repository.NewPostgresAuditLog(config.DB)), staffRepo)
+
+	// ไม่ตั้ง WriteTimeout เพราะการค้นหาผู้ป่วยที่ใช้เวลานานต้องไม่ถูกตัดกลางทาง
+	server := &http.Server{
+		Addr:              cfg.Server.ListenAddr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Println("Listening on", cfg.Server.ListenAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// SIGTERM (docker stop / rolling restart) หรือ Ctrl-C: ให้ readiness ตอบ 503 ก่อน
+	// แล้วปิดการรับ connection ใหม่และรอ request ที่ค้างอยู่ให้เสร็จภายใน SHUTDOWN_TIMEOUT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-serverErr:
+		log.Fatal("Server failed: ", err)
+	case <-ctx.Done():
+	}
+	stop()
 
-	config.ConnectDB()  
-	database.MigrateDB() 
+	log.Println("Shutting down, waiting for in-flight requests")
+	health.Drain()
+	close(stopWatching)
+	time.Sleep(cfg.Server.ShutdownDrainDelay)
 
-	routes.StaffRoutes(r)
-	routes.PatientRoutes(r)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Graceful shutdown timed out, closing remaining connections:", err)
+		server.Close()
+	}
 
-	r.Run(":8080") 
+	if sqlDB, err := config.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,43 @@
+package masking
+
+import "strings"
+
+// ตัวอักษรที่ใช้แทนส่วนที่ปิดไว้
+const maskChar = "x"
+
+// ปิดทุกตัวอักษรยกเว้น keepStart ตัวแรกและ keepEnd ตัวสุดท้าย (นับเป็นตัวอักษร ไม่ใช่ byte)
+// ถ้าค่าสั้นเกินกว่าจะเหลือส่วนที่ปิดได้ จะปิดทั้งหมด
+func keep(value string, keepStart, keepEnd int) string {
+	runes := []rune(value)
+	if len(runes) <= keepStart+keepEnd {
+		return strings.Repeat(maskChar, len(runes))
+	}
+	return string(runes[:keepStart]) + strings.Repeat(maskChar, len(runes)-keepStart-keepEnd) + string(runes[len(runes)-keepEnd:])
+}
+
+// เลขบัตรประชาชน 13 หลักในรูปแบบ 1-2345-xxxxx-12-3 (ปิด 5 หลักกลาง)
+func NationalID(id string) string {
+	if len(id) != 13 || strings.Trim(id, "0123456789") != "" {
+		return keep(id, 0, 2)
+	}
+	return id[0:1] + "-" + id[1:5] + "-" + strings.Repeat(maskChar, 5) + "-" + id[10:12] + "-" + id[12:13]
+}
+
+// เลขหนังสือเดินทาง เหลือตัวแรกและ 2 ตัวสุดท้าย เช่น Axxxxxx78
+func Passport(id string) string {
+	return keep(id, 1, 2)
+}
+
+// เบอร์โทร เหลือ 3 ตัวแรกและ 2 ตัวสุดท้าย เช่น 081xxxxx78
+func Phone(phone string) string {
+	return keep(phone, 3, 2)
+}
+
+// อีเมล เหลือตัวแรกของชื่อผู้ใช้และโดเมน เช่น sxxxxxx@example.com
+func Email(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return keep(email, 1, 0)
+	}
+	return keep(email[:at], 1, 0) + email[at:]
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metric ทั้งหมดของระบบ label ต้องเป็นค่าจากชุดที่จำกัด (route template, status, ชื่อตาราง)
+// ห้ามใส่ค่าที่มาจากผู้ใช้หรือข้อมูลผู้ป่วย เช่น path จริง, HN, เลขบัตรประชาชน หรือ username
+const namespace = "his"
+
+// ผลการ login
+const (
+	LoginSuccess   = "success"
+	LoginFailure   = "failure"
+	LoginThrottled = "throttled" // ถูกปฏิเสธก่อนตรวจรหัสผ่านเพราะใส่ผิดบ่อยเกินไป
+)
+
+// ขั้นของการ login
+const (
+	LoginStagePassword = "password"
+	LoginStageMFA      = "mfa"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Staff login attempts by stage and result.",
+	}, []string{"stage", "result"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of gorm operations by operation, table and outcome.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table", "outcome"})
+
+	searchResults = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "patient_search_results",
+		Help:      "Number of patients returned per search page.",
+		Buckets:   []float64{0, 1, 2, 5, 10, 20, 50, 100},
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpDuration,
+		loginAttempts,
+		queryDuration,
+		searchResults,
+	)
+}
+
+// handler ของ GET /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// route คือ template ของ gin เช่น /patient/:id (ค่าว่างถ้าไม่ตรง route ใดเลย)
+func ObserveHTTP(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+func RecordLogin(stage, result string) {
+	loginAttempts.WithLabelValues(stage, result).Inc()
+}
+
+func ObservePatientSearch(results int) {
+	searchResults.Observe(float64(results))
+}
@@ -1,17 +1,33 @@
 package middlewares
 
 import (
+	"HIS-api/logging"
+	"HIS-api/repository"
+	"HIS-api/tokens"
+	"errors"
+	"github.com/gin-gonic/gin"
 	"net/http"
 	"strings"
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"os"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// Middleware เช็ค JWT Token (การ revoke และสถานะบัญชีตรวจผ่าน staff)
+func AuthMiddleware(staff repository.StaffRepository) gin.HandlerFunc {
+	return authenticate(staff, tokens.TypeAccess)
+}
+
+// Middleware สำหรับ route ลงทะเบียน MFA รับได้ทั้ง access token ปกติ
+// และ token ที่ได้จากการ login ของ role ที่บังคับ MFA แต่ยังไม่ได้ลงทะเบียน
+func MFAEnrollmentAuth(staff repository.StaffRepository) gin.HandlerFunc {
+	return authenticate(staff, tokens.TypeAccess, tokens.TypeMFAEnroll)
+}
+
+// Middleware สำหรับ route เปลี่ยนรหัสผ่าน รับได้ทั้ง access token ปกติ
+// และ token ที่ได้จากการ login ของ Staff ที่ถูกบังคับให้เปลี่ยนรหัสผ่าน
+func PasswordChangeAuth(staff repository.StaffRepository) gin.HandlerFunc {
+	return authenticate(staff, tokens.TypeAccess, tokens.TypePasswordChange)
+}
 
-// Middleware เช็ค JWT Token
-func AuthMiddleware() gin.HandlerFunc {
+func authenticate(staff repository.StaffRepository, types ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
@@ -21,24 +37,63 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := tokens.ParseToken(tokenString, types...)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// เช็คว่า token ถูก revoke (logout) ไปแล้วหรือยัง
+		jti, _ := claims["jti"].(string)
+		revoked, err := staff.IsRevoked(c.Request.Context(), jti)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("Token revocation check failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
 			c.Abort()
 			return
 		}
 
+		// บัญชีที่ถูกปิดใช้งาน (หรือถูกลบ) หรือโรงพยาบาลที่ถูกระงับ ใช้ token ที่ออกไปแล้วไม่ได้ทันที
+		// และใช้ role ล่าสุดจากฐานข้อมูล เพื่อให้การเปลี่ยน role มีผลโดยไม่ต้องรอ token หมดอายุ
+		staffID, _ := tokens.StaffID(claims)
+		status, err := staff.Status(c.Request.Context(), staffID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logging.FromContext(c.Request.Context()).Error("Staff status check failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+			c.Abort()
+			return
+		}
+		if err != nil || status.DeactivatedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is deactivated"})
+			c.Abort()
+			return
+		}
+		if !status.Active() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Hospital is not active"})
+			c.Abort()
+			return
+		}
+		// เปลี่ยนหรือถูกรีเซ็ตรหัสผ่านแล้ว token ทุกชนิดที่ออกก่อนหน้านั้นใช้ไม่ได้ (ทุกเครื่อง)
+		if status.PasswordChangedAt != nil && tokens.IssuedBefore(claims, *status.PasswordChangedAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token was issued before the password was changed"})
+			c.Abort()
+			return
+		}
+		claims["role"] = string(status.Role)
+
+		// log ต่อจากนี้ของ request นี้มี staff และโรงพยาบาลติดไปด้วย
+		ctx := c.Request.Context()
+		logger := logging.FromContext(ctx).With("staff_id", staffID, "hospital", claims["hospital"])
+		c.Request = c.Request.WithContext(logging.WithLogger(ctx, logger))
+
 		c.Set("staff", claims)
+		c.Set("token_type", claims["typ"])
 		c.Next()
 	}
 }
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"HIS-api/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// ใช้ X-Request-ID ที่ nginx ส่งมา (หรือสร้างใหม่ถ้าไม่มีหรือรูปแบบไม่ถูกต้อง) ส่งกลับใน response
+// และผูก logger ที่มี request_id ไว้กับ context ของ request เพื่อให้ log และ audit อ้างถึง request เดียวกันได้
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		ctx := logging.WithRequestID(c.Request.Context(), id)
+		ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("request_id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// access log หนึ่งบรรทัดต่อ request แทน logger ของ gin
+// บันทึกเฉพาะ path ไม่รวม query string เพราะพารามิเตอร์ค้นหาผู้ป่วยมีเลขประจำตัว
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		// ใช้ logger จาก context หลัง c.Next() เพื่อให้ได้ staff_id และ hospital ที่ AuthMiddleware ใส่ไว้
+		logging.FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("response_size", c.Writer.Size()),
+		)
+	}
+}
+
+// แทน gin.Recovery: panic ถูกบันทึกเป็น JSON พร้อม request_id และตอบ 500
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, recovered any) {
+		logging.FromContext(c.Request.Context()).Error("panic recovered",
+			"panic", recovered,
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	})
+}
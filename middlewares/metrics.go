@@ -0,0 +1,18 @@
+package middlewares
+
+import (
+	"time"
+
+	"HIS-api/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// วัดเวลาของทุก request ตาม route template (เช่น /patient/:id) ไม่ใช้ path จริงเพื่อไม่ให้ id หลุดไปเป็น label
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		metrics.ObserveHTTP(c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+	}
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"HIS-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Middleware เช็คสิทธิ์ตาม role ใน JWT claims ต้องใช้หลัง AuthMiddleware
+// Staff ต้องมีสิทธิ์ครบทุกข้อที่ระบุ ถึงจะเข้าถึง route ได้
+func RequirePermission(perms ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff, _ := c.Get("staff")
+		claims, ok := staff.(jwt.MapClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		role, _ := claims["role"].(string)
+		for _, perm := range perms {
+			if !models.Role(role).Has(perm) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: insufficient permissions"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+
+	"HIS-api/database"
+	"HIS-api/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Middleware เปิด transaction บน db ต่อ request และตั้ง app.current_hospital เป็นโรงพยาบาลใน JWT
+// transaction ถูกแนบไว้ใน context ของ request (repository ดึงด้วย database.DBFromContext)
+// ทุก query ผ่าน transaction นี้จะถูก row-level security จำกัดให้เห็นเฉพาะโรงพยาบาลนั้น
+// ต้องใช้หลัง AuthMiddleware
+//
+// response จะถูกพักไว้จนกว่าจะ commit เสร็จ ถ้า commit ไม่ผ่านจะตอบ 500 แทน
+// (ไม่ให้ client ได้ 200 ทั้งที่ข้อมูลไม่ถูกบันทึก) และ rollback เมื่อ handler ตอบ 4xx/5xx
+func TenantTransaction(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff, _ := c.Get("staff")
+		claims, _ := staff.(jwt.MapClaims)
+		hospital, _ := claims["hospital"].(string)
+		if hospital == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+			c.Abort()
+			return
+		}
+
+		tx := db.Begin()
+		if tx.Error != nil {
+			logging.FromContext(c.Request.Context()).Error("Begin transaction failed", "error", tx.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database unavailable"})
+			c.Abort()
+			return
+		}
+		if err := database.SetCurrentHospital(tx, hospital); err != nil {
+			tx.Rollback()
+			logging.FromContext(c.Request.Context()).Error("Setting current hospital failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database unavailable"})
+			c.Abort()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		c.Request = c.Request.WithContext(database.ContextWithDB(c.Request.Context(), tx))
+
+		finished := false
+		defer func() {
+			// handler panic: rollback และคืน writer เดิมให้ Recovery ตอบ 500 ได้
+			if !finished {
+				c.Writer = writer.ResponseWriter
+				tx.Rollback()
+			}
+		}()
+
+		c.Next()
+
+		c.Writer = writer.ResponseWriter
+		finished = true
+		if writer.status >= http.StatusBadRequest || c.IsAborted() {
+			tx.Rollback()
+			writer.flush()
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			logging.FromContext(c.Request.Context()).Error("Commit failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save changes"})
+			return
+		}
+		writer.flush()
+	}
+}
+
+// ResponseWriter ที่พัก status และ body ไว้ในหน่วยความจำจนกว่าจะเรียก flush
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// การกระทำกับข้อมูลผู้ป่วยที่ถูกบันทึกใน audit log
+type AuditAction string
+
+const (
+	AuditPatientSearch AuditAction = "patient.search"
+	AuditPatientView   AuditAction = "patient.view"
+	AuditPatientCreate AuditAction = "patient.create"
+	AuditPatientUpdate AuditAction = "patient.update"
+	AuditPatientDelete AuditAction = "patient.delete"
+	AuditPatientReveal AuditAction = "patient.reveal"
+)
+
+// วัตถุประสงค์ที่ต้องระบุเมื่อขอดูข้อมูลอ่อนไหวแบบเต็ม (บันทึกใน audit log)
+type RevealPurpose string
+
+const (
+	PurposeTreatment            RevealPurpose = "treatment"
+	PurposeRegistration         RevealPurpose = "registration"
+	PurposeIdentityVerification RevealPurpose = "identity_verification"
+	PurposeBilling              RevealPurpose = "billing"
+	PurposeLegalRequest         RevealPurpose = "legal_request"
+	PurposePatientRequest       RevealPurpose = "patient_request"
+)
+
+func (p RevealPurpose) Valid() bool {
+	switch p {
+	case PurposeTreatment, PurposeRegistration, PurposeIdentityVerification,
+		PurposeBilling, PurposeLegalRequest, PurposePatientRequest:
+		return true
+	}
+	return false
+}
+
+// บันทึกการเข้าถึงข้อมูลผู้ป่วย 1 ครั้ง (เพิ่มได้อย่างเดียว แก้ไข/ลบไม่ได้ ดู database/migrations/0005_audit_append_only.up.sql)
+//
+// แต่ละโรงพยาบาลมี chain ของตัวเอง: Seq เรียงต่อกันโดยไม่ข้าม และ Hash คำนวณจาก PrevHash
+// รวมกับข้อมูลของแถว ถ้ามีการแก้หรือลบแถวใดใน chain จะตรวจพบได้ด้วย services.AuditChainCheck
+//
+// PatientIDs และ Query เก็บเป็นข้อความ JSON ตามที่ใช้คำนวณ hash (ไม่ใช้ jsonb เพราะ Postgres จะจัดรูปใหม่)
+// ค่าที่ระบุตัวบุคคลใน Query ถูกแทนด้วย HMAC แล้ว
+type AuditEntry struct {
+	ID         uint        `gorm:"primarykey"`
+	Hospital   string      `gorm:"type:varchar(64);not null;uniqueIndex:idx_audit_entries_hospital_seq,priority:1"`
+	Seq        uint64      `gorm:"not null;uniqueIndex:idx_audit_entries_hospital_seq,priority:2"`
+	ActorID    uint        `gorm:"not null;index"`
+	ActorRole  Role        `gorm:"not null"`
+	Action     AuditAction `gorm:"not null;index"`
+	PatientIDs string      `gorm:"type:text;not null"`
+	Query      string      `gorm:"type:text;not null"`
+	IP         string      `gorm:"not null"`
+	RequestID  string      `gorm:"not null"`
+	CreatedAt  time.Time   `gorm:"not null;index"`
+	PrevHash   string      `gorm:"type:char(64);not null"`
+	Hash       string      `gorm:"type:char(64);not null"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// เลขรันล่าสุดของ HN แยกตามโรงพยาบาลและปี พ.ศ.
+// Year = 0 ใช้กับโรงพยาบาลที่ไม่ใส่ปีใน HN (เลขรันต่อเนื่องไม่รีเซ็ตทุกปี)
+type HNSequence struct {
+	Hospital  string `gorm:"primaryKey"`
+	Year      int    `gorm:"primaryKey;autoIncrement:false"`
+	LastValue int64  `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
+// รูปแบบ HN ของแต่ละโรงพยาบาล เช่น Prefix "HN", YearDigits 2, Separator "-", NumberDigits 6
+// จะได้ HN เป็น "HN68-000123"
+type HNFormat struct {
+	Hospital     string    `gorm:"primaryKey" json:"hospital"`
+	Prefix       string    `gorm:"not null;default:''" json:"prefix"`
+	YearDigits   int       `gorm:"not null;default:2;check:year_digits IN (0, 2, 4)" json:"year_digits"`
+	Separator    string    `gorm:"not null;default:'-'" json:"separator"`
+	NumberDigits int       `gorm:"not null;default:6;check:number_digits BETWEEN 1 AND 12" json:"number_digits"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// รูปแบบที่ใช้เมื่อโรงพยาบาลยังไม่ได้ตั้งค่า HNFormat ไว้
+func DefaultHNFormat(hospital string) HNFormat {
+	return HNFormat{
+		Hospital:     hospital,
+		Prefix:       "HN",
+		YearDigits:   2,
+		Separator:    "-",
+		NumberDigits: 6,
+	}
+}
+
+// ปีที่ใช้เป็น key ของ HNSequence ตามรูปแบบนี้ (0 ถ้าไม่ใส่ปี)
+func (f HNFormat) SequenceYear(buddhistYear int) int {
+	if f.YearDigits == 0 {
+		return 0
+	}
+	return buddhistYear
+}
+
+// สร้าง HN จากปี พ.ศ. และเลขรัน
+func (f HNFormat) Format(buddhistYear int, number int64) string {
+	var b strings.Builder
+	b.WriteString(f.Prefix)
+	switch f.YearDigits {
+	case 2:
+		fmt.Fprintf(&b, "%02d", buddhistYear%100)
+	case 4:
+		fmt.Fprintf(&b, "%04d", buddhistYear)
+	}
+	if f.YearDigits != 0 {
+		b.WriteString(f.Separator)
+	}
+	fmt.Fprintf(&b, "%0*d", f.NumberDigits, number)
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+type HospitalStatus string
+
+const (
+	HospitalActive    HospitalStatus = "active"
+	HospitalSuspended HospitalStatus = "suspended" // Staff ของโรงพยาบาลนี้ login และใช้ token เดิมไม่ได้
+)
+
+func (s HospitalStatus) Valid() bool {
+	return s == HospitalActive || s == HospitalSuspended
+}
+
+// ทะเบียนโรงพยาบาล (tenant) Code คือ key ที่ Staff, Patient และ JWT claim "hospital" อ้างถึง
+// HCode คือรหัสสถานพยาบาล 5 หลักของกระทรวงสาธารณสุข
+type Hospital struct {
+	Code      string         `gorm:"primaryKey;type:varchar(64)" json:"code"`
+	NameTH    string         `gorm:"not null" json:"name_th"`
+	NameEN    string         `gorm:"not null;default:''" json:"name_en"`
+	HCode     *string        `gorm:"type:varchar(5);uniqueIndex" json:"hcode"`
+	Status    HospitalStatus `gorm:"type:varchar(16);not null;default:active;check:status IN ('active', 'suspended')" json:"status"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+func (h Hospital) Active() bool {
+	return h.Status == HospitalActive
+}
+
+// แปลงชื่อหรือรหัสโรงพยาบาลที่ผู้ใช้พิมพ์ให้เป็นรหัสมาตรฐาน
+// ตัวพิมพ์ใหญ่ ช่องว่างและเครื่องหมายอื่นๆ เป็น "_" เช่น " Hospital a " -> "HOSPITAL_A"
+func NormalizeHospitalCode(s string) string {
+	var b strings.Builder
+	pendingSep := false
+	for _, r := range strings.TrimSpace(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if pendingSep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pendingSep = false
+			b.WriteRune(unicode.ToUpper(r))
+			continue
+		}
+		pendingSep = true
+	}
+	return b.String()
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// บันทึกการพยายามเข้าสู่ระบบทุกครั้ง ใช้นับจำนวนครั้งที่ล้มเหลวต่อ IP
+type LoginAttempt struct {
+	ID        uint      `gorm:"primarykey"`
+	Username  string    `gorm:"not null;index"`
+	Hospital  string    `gorm:"not null"`
+	IP        string    `gorm:"not null;index:idx_login_attempts_ip_created_at,priority:1"`
+	Success   bool      `gorm:"not null"`
+	CreatedAt time.Time `gorm:"index:idx_login_attempts_ip_created_at,priority:2"`
+}
+
+const (
+	LockoutEventLocked   = "locked"
+	LockoutEventUnlocked = "unlocked"
+)
+
+// ประวัติการล็อก/ปลดล็อกบัญชี Staff
+// ActorID คือ admin ที่ปลดล็อก (nil ถ้าระบบล็อกเองจากการใส่รหัสผ่านผิด)
+type LockoutEvent struct {
+	ID          uint   `gorm:"primarykey"`
+	StaffID     uint   `gorm:"not null;index"`
+	Username    string `gorm:"not null"`
+	Hospital    string `gorm:"not null;index"`
+	Event       string `gorm:"not null"`
+	Reason      string `gorm:"not null"`
+	IP          string
+	LockedUntil *time.Time
+	ActorID     *uint
+	CreatedAt   time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// รหัสกู้คืนสำหรับเข้าสู่ระบบเมื่อไม่มีอุปกรณ์ TOTP ใช้ได้ครั้งเดียว เก็บเฉพาะ hash
+type MFARecoveryCode struct {
+	ID        uint   `gorm:"primarykey"`
+	StaffID   uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;uniqueIndex"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// hash ของรหัสผ่านที่ Staff เคยตั้ง ใช้ห้ามตั้งรหัสผ่านซ้ำกับครั้งล่าสุดๆ (ดู services.PasswordPolicy)
+type PasswordHistory struct {
+	ID        uint   `gorm:"primarykey"`
+	StaffID   uint   `gorm:"not null;index"`
+	Hash      string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// token รีเซ็ตรหัสผ่านที่ admin ออกให้ ใช้ได้ครั้งเดียว เก็บเฉพาะ hash (SHA-256) ไม่เก็บ token จริง
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primarykey"`
+	StaffID   uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedBy uint `gorm:"not null"`
+	CreatedAt time.Time
+}
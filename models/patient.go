@@ -2,23 +2,80 @@ package models
 
 import (
 	"time"
+
+	"HIS-api/encryption"
+
 	"gorm.io/gorm"
 )
 
+// ผู้ป่วยแต่ละแถวเป็นของโรงพยาบาลเดียว เลขประจำตัวต่างๆ จึง unique เฉพาะภายในโรงพยาบาล
+// ผู้ป่วยคนเดียวกันที่ไปหลายโรงพยาบาลจะมีแถวแยกกันในแต่ละโรงพยาบาล
+//
+// เลขบัตรประชาชน หนังสือเดินทาง เบอร์โทร และอีเมลถูกเข้ารหัสในฐานข้อมูล (ดู package encryption)
+// การค้นหาและตรวจค่าซ้ำต้องใช้คอลัมน์ *_index (blind index) ซึ่งคำนวณให้ใน BeforeSave
 type Patient struct {
 	gorm.Model
-	FirstNameTH  string    `gorm:"not null"`
-	MiddleNameTH string
-	LastNameTH   string    `gorm:"not null"`
-	FirstNameEN  string
-	MiddleNameEN string
-	LastNameEN   string
-	DateOfBirth  time.Time `gorm:"not null"` 
-	PatientHN    *string   `gorm:"unique"`
-	NationalID   *string    `gorm:"unique"`
-	PassportID   *string   `gorm:"unique"`
-	PhoneNumber  string    `gorm:"not null"`
-	Email        string    `gorm:"unique"`
-	Gender       string    `gorm:"not null;check:gender IN ('M', 'F')"` 
-	Hospital     string    `gorm:"not null"`
+	FirstNameTH      string    `gorm:"not null"`
+	MiddleNameTH     string
+	LastNameTH       string    `gorm:"not null"`
+	FirstNameEN      string
+	MiddleNameEN     string
+	LastNameEN       string
+	DateOfBirth      time.Time `gorm:"not null"`
+	PatientHN        *string   `gorm:"uniqueIndex:idx_patients_hospital_hn,priority:2"`
+	NationalID       *string   `gorm:"serializer:encrypted"`
+	NationalIDIndex  *string   `gorm:"type:char(64);uniqueIndex:idx_patients_hospital_national_id_bidx,priority:2" json:"-"`
+	PassportID       *string   `gorm:"serializer:encrypted"`
+	PassportIDIndex  *string   `gorm:"type:char(64);uniqueIndex:idx_patients_hospital_passport_id_bidx,priority:2" json:"-"`
+	PhoneNumber      string    `gorm:"not null;serializer:encrypted"`
+	PhoneNumberIndex string    `gorm:"type:char(64);index:idx_patients_hospital_phone_number_bidx,priority:2" json:"-"`
+	Email            *string   `gorm:"serializer:encrypted"`
+	EmailIndex       *string   `gorm:"type:char(64);uniqueIndex:idx_patients_hospital_email_bidx,priority:2" json:"-"`
+	Gender           string    `gorm:"not null;check:gender IN ('M', 'F')"`
+	Hospital         string    `gorm:"not null;uniqueIndex:idx_patients_hospital_hn,priority:1;uniqueIndex:idx_patients_hospital_national_id_bidx,priority:1;uniqueIndex:idx_patients_hospital_passport_id_bidx,priority:1;index:idx_patients_hospital_phone_number_bidx,priority:1;uniqueIndex:idx_patients_hospital_email_bidx,priority:1"`
+
+	HospitalRef *Hospital `gorm:"foreignKey:Hospital;references:Code;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-"`
+}
+
+// ฟิลด์อ่อนไหวของผู้ป่วย ถูกปิดบางส่วนในผลลัพธ์ตามบทบาท (ดู RoleUnmaskedFields) ค่าคือชื่อคอลัมน์
+type SensitiveField string
+
+const (
+	FieldNationalID  SensitiveField = "national_id"
+	FieldPassportID  SensitiveField = "passport_id"
+	FieldPhoneNumber SensitiveField = "phone_number"
+	FieldEmail       SensitiveField = "email"
+)
+
+var SensitiveFields = []SensitiveField{FieldNationalID, FieldPassportID, FieldPhoneNumber, FieldEmail}
+
+func (f SensitiveField) Valid() bool {
+	for _, field := range SensitiveFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// blind index ของค่าในคอลัมน์ที่เข้ารหัส (nil ถ้าไม่มีค่า)
+func PatientIndex(column string, value *string) *string {
+	if value == nil {
+		return nil
+	}
+	index := encryption.BlindIndex(column, *value)
+	return &index
+}
+
+// คำนวณ blind index ทุกคอลัมน์ใหม่จากค่าปัจจุบัน
+func (p *Patient) SetBlindIndexes() {
+	p.NationalIDIndex = PatientIndex("national_id", p.NationalID)
+	p.PassportIDIndex = PatientIndex("passport_id", p.PassportID)
+	p.PhoneNumberIndex = *PatientIndex("phone_number", &p.PhoneNumber)
+	p.EmailIndex = PatientIndex("email", p.Email)
+}
+
+func (p *Patient) BeforeSave(tx *gorm.DB) error {
+	p.SetBlindIndexes()
+	return nil
 }
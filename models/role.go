@@ -0,0 +1,99 @@
+package models
+
+// บทบาทของ Staff ใช้กำหนดสิทธิ์การเข้าถึง API
+type Role string
+
+const (
+	RoleAdmin             Role = "admin"
+	RoleDoctor            Role = "doctor"
+	RoleNurse             Role = "nurse"
+	RoleRegistrationClerk Role = "registration_clerk"
+	RoleAuditor           Role = "auditor"
+	RoleSystemAdmin       Role = "system_admin"
+)
+
+// สิทธิ์ที่ route แต่ละเส้นประกาศไว้ผ่าน middlewares.RequirePermission
+type Permission string
+
+const (
+	PermStaffManage    Permission = "staff:manage"
+	PermPatientRead    Permission = "patient:read"
+	PermPatientWrite   Permission = "patient:write"
+	PermPatientDelete  Permission = "patient:delete"
+	PermPatientReveal  Permission = "patient:reveal"
+	PermClinicalRead   Permission = "clinical:read"
+	PermClinicalWrite  Permission = "clinical:write"
+	PermAuditRead      Permission = "audit:read"
+	PermHospitalManage Permission = "hospital:manage"
+)
+
+// ตารางสิทธิ์ของแต่ละบทบาท
+//   - admin              : จัดการ Staff และข้อมูลทะเบียนผู้ป่วยทั้งหมด (ไม่เห็นข้อมูลทางคลินิก)
+//   - doctor, nurse      : ข้อมูลทะเบียนผู้ป่วยและข้อมูลทางคลินิก
+//   - registration_clerk : ลงทะเบียนและแก้ไขข้อมูลทะเบียนผู้ป่วย
+//   - auditor            : ดู audit log เท่านั้น
+//   - system_admin       : ลงทะเบียน ดู และระงับโรงพยาบาลทั้งหมดในระบบ (ไม่เห็นข้อมูลผู้ป่วยหรือ Staff)
+//
+// patient:reveal คือสิทธิ์ขอดูเลขประจำตัวและช่องทางติดต่อแบบเต็ม (ต้องระบุวัตถุประสงค์และถูกบันทึก audit)
+var RolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermStaffManage,
+		PermPatientRead, PermPatientWrite, PermPatientDelete, PermPatientReveal,
+	},
+	RoleDoctor: {
+		PermPatientRead, PermPatientWrite, PermPatientReveal,
+		PermClinicalRead, PermClinicalWrite,
+	},
+	RoleNurse: {
+		PermPatientRead, PermPatientWrite, PermPatientReveal,
+		PermClinicalRead, PermClinicalWrite,
+	},
+	RoleRegistrationClerk: {
+		PermPatientRead, PermPatientWrite, PermPatientReveal,
+	},
+	RoleAuditor: {
+		PermAuditRead,
+	},
+	RoleSystemAdmin: {
+		PermHospitalManage,
+	},
+}
+
+// ตรวจว่าเป็นบทบาทที่ระบบรู้จักหรือไม่
+func (r Role) Valid() bool {
+	_, ok := RolePermissions[r]
+	return ok
+}
+
+// ตรวจว่า admin ของโรงพยาบาลตั้งบทบาทนี้ให้ Staff ผ่าน API ได้หรือไม่
+// system_admin มีสิทธิ์ข้ามโรงพยาบาล จึงสร้างได้เฉพาะด้วยคำสั่ง CLI create-admin -role system_admin
+func (r Role) Assignable() bool {
+	return r.Valid() && r != RoleSystemAdmin
+}
+
+// ตรวจว่าบทบาทนี้มีสิทธิ์ที่ระบุหรือไม่
+func (r Role) Has(perm Permission) bool {
+	for _, p := range RolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ฟิลด์อ่อนไหวของผู้ป่วยที่แต่ละบทบาทเห็นแบบเต็มในผลลัพธ์ปกติ ฟิลด์อื่นจะถูกปิดบางส่วน
+// (แพทย์และพยาบาลต้องติดต่อผู้ป่วยได้ แต่เลขประจำตัวต้องขอ reveal ทุกบทบาท)
+var RoleUnmaskedFields = map[Role][]SensitiveField{
+	RoleDoctor: {FieldPhoneNumber, FieldEmail},
+	RoleNurse:  {FieldPhoneNumber, FieldEmail},
+}
+
+// ตรวจว่าบทบาทนี้เห็นฟิลด์อ่อนไหวแบบเต็มโดยไม่ต้อง reveal หรือไม่
+func (r Role) Unmasked(field SensitiveField) bool {
+	for _, f := range RoleUnmaskedFields[r] {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// จำกัดผลลัพธ์ให้อยู่ในโรงพยาบาลเดียว ใช้กับทุก query ของข้อมูลที่แยกตามโรงพยาบาล
+// เช่น config.DB.Scopes(models.HospitalScope(hospital)).Find(&patients)
+// เงื่อนไขจะอ้างคอลัมน์ hospital ของตารางหลักเสมอ แม้ query จะมีการ join
+func HospitalScope(hospital string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: "hospital"},
+			Value:  hospital,
+		})
+	}
+}
@@ -1,10 +1,45 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Staff struct {
 	gorm.Model
 	Username string `gorm:"unique;not null"`
 	Password string `gorm:"not null"`
-	Hospital string `gorm:"not null"`
+	Hospital string `gorm:"not null;index"`
+	Role     Role   `gorm:"type:varchar(32);not null;default:registration_clerk"`
+
+	// ต้องเปลี่ยนรหัสผ่านก่อนถึงจะได้ access token (เช่น บัญชีที่ admin สร้างให้)
+	MustChangePassword bool `gorm:"not null;default:false"`
+	PasswordChangedAt  *time.Time
+
+	// สถานะการล็อกบัญชีจากการใส่รหัสผ่านผิด (ดู services.LoginPolicy)
+	FailedLoginAttempts int `gorm:"not null;default:0"`
+	LastFailedLoginAt   *time.Time
+	LockedUntil         *time.Time
+
+	// TOTP (ดู services/mfa.go) MFASecret มีค่าตั้งแต่เริ่มลงทะเบียน แต่จะบังคับใช้เมื่อ MFAEnabled เท่านั้น
+	MFAEnabled      bool    `gorm:"not null;default:false"`
+	MFASecret       *string `json:"-"`
+	MFALastUsedStep int64   `gorm:"not null;default:0" json:"-"`
+
+	// บัญชีที่ถูกปิดใช้งานจะ login ไม่ได้ และ token ที่ออกไปแล้วจะถูกปฏิเสธทันที
+	DeactivatedAt *time.Time
+	DeactivatedBy *uint
+
+	HospitalRef *Hospital `gorm:"foreignKey:Hospital;references:Code;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT" json:"-"`
+}
+
+// บัญชียังใช้งานได้อยู่หรือไม่
+func (s Staff) Active() bool {
+	return s.DeactivatedAt == nil
+}
+
+// บัญชีถูกล็อกชั่วคราวอยู่หรือไม่ ณ เวลาที่ระบุ
+func (s Staff) LockedAt(now time.Time) bool {
+	return s.LockedUntil != nil && now.Before(*s.LockedUntil)
 }
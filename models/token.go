@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Refresh token ที่ออกให้ Staff เก็บเฉพาะ hash (SHA-256) ไม่เก็บ token จริง
+// token ที่ต่อกันมาจากการ rotate จะอยู่ใน FamilyID เดียวกัน ถ้ามีการใช้ token เก่าซ้ำ
+// (ส่อว่าถูกขโมย) จะ revoke ทั้ง family
+type RefreshToken struct {
+	ID        uint      `gorm:"primarykey"`
+	StaffID   uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	FamilyID  string    `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Access token ที่ถูก revoke ก่อนหมดอายุ (jti denylist) ใช้ตอน logout
+// เก็บไว้แค่จนถึงเวลาที่ token หมดอายุเองก็พอ
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	StaffID   uint      `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
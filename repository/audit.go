@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/services"
+)
+
+// เงื่อนไขค้นหา audit log ของโรงพยาบาล (ค่าว่างหรือ 0 = ไม่กรอง)
+// IdentifierHash คือ HMAC ของค่าที่ระบุตัวบุคคล (services.HashIdentifier) ที่ต้องปรากฏใน query ที่บันทึกไว้
+// From รวมเวลานั้น To ไม่รวม
+type AuditFilter struct {
+	Hospital       string
+	ActorID        uint
+	Action         models.AuditAction
+	PatientID      uint
+	RequestID      string
+	IdentifierHash string
+	From           *time.Time
+	To             *time.Time
+}
+
+// ที่บันทึกการเข้าถึงข้อมูลผู้ป่วย ต้องบันทึกใน transaction เดียวกับการเข้าถึง
+// ถ้าบันทึกไม่ได้ การเข้าถึงนั้นต้องล้มเหลวด้วย
+type AuditLog interface {
+	// ต่อท้าย hash chain ของโรงพยาบาล (services.NewAuditEntry และ services.LinkAuditEntry)
+	Record(ctx context.Context, rec services.AuditRecord) error
+	// เรียงตาม seq หรือ -seq
+	List(ctx context.Context, filter AuditFilter, page PageRequest) (Page[models.AuditEntry], error)
+	// ตรวจ chain ทั้งหมดของโรงพยาบาลด้วย services.AuditChainCheck
+	Verify(ctx context.Context, hospital string) (services.AuditVerification, error)
+}
+
+var auditSortKeys = map[string]SortKey[models.AuditEntry]{
+	"seq": {
+		Columns: []string{"seq"},
+		Values:  func(e models.AuditEntry) []interface{} { return []interface{}{e.Seq} },
+		Targets: func() []interface{} { return []interface{}{new(uint64)} },
+	},
+}
+
+func auditEntryID(e models.AuditEntry) uint { return e.ID }
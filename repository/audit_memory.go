@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/services"
+)
+
+// AuditLog ในหน่วยความจำ เก็บรายการตามลำดับที่บันทึก ให้การทดสอบตรวจได้
+// และต่อ hash chain ของแต่ละโรงพยาบาลเหมือนบน Postgres
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	records []services.AuditRecord
+	entries []models.AuditEntry
+	// ถ้าตั้งไว้ Record จะคืน error นี้ (จำลองการบันทึกล้มเหลว)
+	Err error
+}
+
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{}
+}
+
+func (l *MemoryAuditLog) Record(ctx context.Context, rec services.AuditRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Err != nil {
+		return l.Err
+	}
+
+	entry, err := services.NewAuditEntry(rec, time.Now())
+	if err != nil {
+		return err
+	}
+	var last models.AuditEntry
+	for _, e := range l.entries {
+		if e.Hospital == rec.Hospital {
+			last = e
+		}
+	}
+	entry = services.LinkAuditEntry(entry, last)
+	entry.ID = uint(len(l.entries) + 1)
+	l.entries = append(l.entries, entry)
+	l.records = append(l.records, rec)
+	return nil
+}
+
+// สำเนาของรายการที่บันทึกไว้
+func (l *MemoryAuditLog) Records() []services.AuditRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]services.AuditRecord{}, l.records...)
+}
+
+func (l *MemoryAuditLog) List(ctx context.Context, filter AuditFilter, page PageRequest) (Page[models.AuditEntry], error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	matches := []models.AuditEntry{}
+	for _, e := range l.entries {
+		if auditMatches(e, filter) {
+			matches = append(matches, e)
+		}
+	}
+	return paginateSlice(matches, auditSortKeys, auditEntryID, page)
+}
+
+func auditMatches(e models.AuditEntry, filter AuditFilter) bool {
+	switch {
+	case e.Hospital != filter.Hospital:
+		return false
+	case filter.ActorID != 0 && e.ActorID != filter.ActorID:
+		return false
+	case filter.Action != "" && e.Action != filter.Action:
+		return false
+	case filter.RequestID != "" && e.RequestID != filter.RequestID:
+		return false
+	case filter.From != nil && e.CreatedAt.Before(*filter.From):
+		return false
+	case filter.To != nil && !e.CreatedAt.Before(*filter.To):
+		return false
+	}
+	if filter.PatientID != 0 {
+		var ids []uint
+		json.Unmarshal([]byte(e.PatientIDs), &ids)
+		found := false
+		for _, id := range ids {
+			found = found || id == filter.PatientID
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.IdentifierHash != "" {
+		var query map[string]string
+		json.Unmarshal([]byte(e.Query), &query)
+		found := false
+		for _, v := range query {
+			found = found || v == filter.IdentifierHash
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *MemoryAuditLog) Verify(ctx context.Context, hospital string) (services.AuditVerification, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	check := services.NewAuditChainCheck()
+	for _, e := range l.entries {
+		if e.Hospital == hospital && !check.Check(e) {
+			break
+		}
+	}
+	return check.Result(), nil
+}
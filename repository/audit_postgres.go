@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"HIS-api/database"
+	"HIS-api/models"
+	"HIS-api/services"
+
+	"gorm.io/gorm"
+)
+
+// จำนวนแถวที่ Verify โหลดต่อครั้ง
+const auditVerifyBatch = 500
+
+// AuditLog บน Postgres (hash chain ต่อโรงพยาบาล)
+type PostgresAuditLog struct {
+	db *gorm.DB
+}
+
+func NewPostgresAuditLog(db *gorm.DB) *PostgresAuditLog {
+	return &PostgresAuditLog{db: db}
+}
+
+// ใช้ advisory lock ของโรงพยาบาลนั้นจนจบ transaction เพื่อให้ request พร้อมกันต่อ chain ทีละแถว
+func (l *PostgresAuditLog) Record(ctx context.Context, rec services.AuditRecord) error {
+	entry, err := services.NewAuditEntry(rec, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return database.DBFromContext(ctx, l.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "audit_entries:"+rec.Hospital).Error; err != nil {
+			return err
+		}
+
+		var last models.AuditEntry
+		err := tx.Where("hospital = ?", rec.Hospital).Order("seq DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		entry = services.LinkAuditEntry(entry, last)
+		return tx.Create(&entry).Error
+	})
+}
+
+func (l *PostgresAuditLog) List(ctx context.Context, filter AuditFilter, page PageRequest) (Page[models.AuditEntry], error) {
+	db := l.db.WithContext(ctx).Scopes(models.HospitalScope(filter.Hospital))
+	if filter.ActorID != 0 {
+		db = db.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if filter.PatientID != 0 {
+		ids, _ := json.Marshal([]uint{filter.PatientID})
+		db = db.Where("patient_ids::jsonb @> ?::jsonb", string(ids))
+	}
+	if filter.RequestID != "" {
+		db = db.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.IdentifierHash != "" {
+		db = db.Where("EXISTS (SELECT 1 FROM jsonb_each_text(query::jsonb) WHERE value = ?)", filter.IdentifierHash)
+	}
+	if filter.From != nil {
+		db = db.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		db = db.Where("created_at < ?", *filter.To)
+	}
+	return Paginate(db, auditSortKeys, auditEntryID, page)
+}
+
+// โหลดทีละชุดตาม seq ไม่ต้องโหลดทั้ง chain พร้อมกัน
+func (l *PostgresAuditLog) Verify(ctx context.Context, hospital string) (services.AuditVerification, error) {
+	check := services.NewAuditChainCheck()
+	for {
+		var batch []models.AuditEntry
+		err := l.db.WithContext(ctx).
+			Where("hospital = ? AND seq > ?", hospital, check.Result().HeadSeq).
+			Order("seq").Limit(auditVerifyBatch).Find(&batch).Error
+		if err != nil {
+			return check.Result(), err
+		}
+		if len(batch) == 0 {
+			return check.Result(), nil
+		}
+		for _, e := range batch {
+			if !check.Check(e) {
+				return check.Result(), nil
+			}
+		}
+	}
+}
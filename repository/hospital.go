@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+
+	"HIS-api/models"
+)
+
+// ที่เก็บทะเบียนโรงพยาบาลและรูปแบบ HN ของแต่ละแห่ง
+type HospitalRepository interface {
+	// คืน ErrNotFound ถ้าไม่พบ
+	Find(ctx context.Context, code string) (models.Hospital, error)
+	// เรียงตามรหัส status ว่าง = ทุกสถานะ
+	List(ctx context.Context, status models.HospitalStatus) ([]models.Hospital, error)
+	// บันทึกโรงพยาบาลที่ตรวจแล้ว (services.NewHospital) คืน ErrDuplicate ถ้ารหัสหรือ hcode ซ้ำ
+	Create(ctx context.Context, hospital models.Hospital) (models.Hospital, error)
+	// โหลดโรงพยาบาลพร้อมล็อกแถว ให้ fn แก้ (services.HospitalUpdate.Apply) แล้วบันทึกเฉพาะที่เปลี่ยน
+	// ถ้า fn คืน error จะไม่บันทึกอะไร คืน ErrNotFound ถ้าไม่พบ และ ErrDuplicate ถ้า hcode ซ้ำกับแห่งอื่น
+	Update(ctx context.Context, code string, fn func(*models.Hospital) error) (models.Hospital, error)
+
+	// รูปแบบ HN ของโรงพยาบาล (ค่า default ถ้ายังไม่เคยตั้ง)
+	// hn_formats อยู่ใต้ row-level security ต้องเรียกภายใน transaction ของ middlewares.TenantTransaction
+	HNFormat(ctx context.Context, hospital string) (models.HNFormat, error)
+	// บันทึกรูปแบบ HN ที่ตรวจแล้ว (services.ValidateHNFormat) แทนที่ค่าเดิมทั้งหมด
+	SaveHNFormat(ctx context.Context, format models.HNFormat) (models.HNFormat, error)
+}
+
+// คอลัมน์ที่ Update บันทึกได้ และค่าปัจจุบันของแต่ละคอลัมน์
+func hospitalUpdates(before, after models.Hospital) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if after.NameTH != before.NameTH {
+		updates["name_th"] = after.NameTH
+	}
+	if after.NameEN != before.NameEN {
+		updates["name_en"] = after.NameEN
+	}
+	if !equalString(after.HCode, before.HCode) {
+		updates["h_code"] = after.HCode
+	}
+	if after.Status != before.Status {
+		updates["status"] = after.Status
+	}
+	return updates
+}
+
+func equalString(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"HIS-api/models"
+)
+
+// HospitalRepository ในหน่วยความจำ สำหรับทดสอบ handler โดยไม่ต้องมีฐานข้อมูล
+type MemoryHospitals struct {
+	mu        sync.Mutex
+	hospitals map[string]models.Hospital
+	formats   map[string]models.HNFormat
+}
+
+func NewMemoryHospitals(hospitals ...models.Hospital) *MemoryHospitals {
+	r := &MemoryHospitals{
+		hospitals: map[string]models.Hospital{},
+		formats:   map[string]models.HNFormat{},
+	}
+	for _, h := range hospitals {
+		if h.Status == "" {
+			h.Status = models.HospitalActive
+		}
+		r.hospitals[h.Code] = h
+	}
+	return r
+}
+
+func (r *MemoryHospitals) Find(ctx context.Context, code string) (models.Hospital, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hospital, ok := r.hospitals[code]
+	if !ok {
+		return hospital, ErrNotFound
+	}
+	return hospital, nil
+}
+
+func (r *MemoryHospitals) List(ctx context.Context, status models.HospitalStatus) ([]models.Hospital, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hospitals := []models.Hospital{}
+	for _, h := range r.hospitals {
+		if status == "" || h.Status == status {
+			hospitals = append(hospitals, h)
+		}
+	}
+	sort.Slice(hospitals, func(i, j int) bool { return hospitals[i].Code < hospitals[j].Code })
+	return hospitals, nil
+}
+
+func (r *MemoryHospitals) Create(ctx context.Context, hospital models.Hospital) (models.Hospital, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hospitals[hospital.Code]; ok || r.hcodeTaken(hospital.HCode, "") {
+		return hospital, ErrDuplicate
+	}
+	hospital.CreatedAt = time.Now()
+	hospital.UpdatedAt = hospital.CreatedAt
+	r.hospitals[hospital.Code] = hospital
+	return hospital, nil
+}
+
+func (r *MemoryHospitals) Update(ctx context.Context, code string, fn func(*models.Hospital) error) (models.Hospital, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.hospitals[code]
+	if !ok {
+		return stored, ErrNotFound
+	}
+
+	hospital := stored
+	if err := fn(&hospital); err != nil {
+		return stored, err
+	}
+	if len(hospitalUpdates(stored, hospital)) == 0 {
+		return stored, nil
+	}
+	if r.hcodeTaken(hospital.HCode, code) {
+		return stored, ErrDuplicate
+	}
+	hospital.UpdatedAt = time.Now()
+	r.hospitals[code] = hospital
+	return hospital, nil
+}
+
+// hcode ถูกใช้โดยโรงพยาบาลอื่นที่ไม่ใช่ except แล้วหรือไม่ ต้องถือ r.mu อยู่แล้ว
+func (r *MemoryHospitals) hcodeTaken(hcode *string, except string) bool {
+	if hcode == nil {
+		return false
+	}
+	for code, h := range r.hospitals {
+		if code != except && h.HCode != nil && *h.HCode == *hcode {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryHospitals) HNFormat(ctx context.Context, hospital string) (models.HNFormat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if format, ok := r.formats[hospital]; ok {
+		return format, nil
+	}
+	return models.DefaultHNFormat(hospital), nil
+}
+
+func (r *MemoryHospitals) SaveHNFormat(ctx context.Context, format models.HNFormat) (models.HNFormat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if existing, ok := r.formats[format.Hospital]; ok {
+		format.CreatedAt = existing.CreatedAt
+	} else {
+		format.CreatedAt = now
+	}
+	format.UpdatedAt = now
+	r.formats[format.Hospital] = format
+	return format, nil
+}
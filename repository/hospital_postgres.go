@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"HIS-api/database"
+	"HIS-api/models"
+	"HIS-api/services"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HospitalRepository บน Postgres (ตาราง hospitals ไม่ได้อยู่ใต้ row-level security แต่ hn_formats อยู่)
+type PostgresHospitals struct {
+	db *gorm.DB
+}
+
+func NewPostgresHospitals(db *gorm.DB) *PostgresHospitals {
+	return &PostgresHospitals{db: db}
+}
+
+func (r *PostgresHospitals) Find(ctx context.Context, code string) (models.Hospital, error) {
+	var hospital models.Hospital
+	err := r.db.WithContext(ctx).First(&hospital, "code = ?", code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return hospital, ErrNotFound
+	}
+	return hospital, err
+}
+
+func (r *PostgresHospitals) List(ctx context.Context, status models.HospitalStatus) ([]models.Hospital, error) {
+	db := r.db.WithContext(ctx).Order("code")
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	hospitals := []models.Hospital{}
+	err := db.Find(&hospitals).Error
+	return hospitals, err
+}
+
+func (r *PostgresHospitals) Create(ctx context.Context, hospital models.Hospital) (models.Hospital, error) {
+	err := r.db.WithContext(ctx).Create(&hospital).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return hospital, ErrDuplicate
+	}
+	return hospital, err
+}
+
+func (r *PostgresHospitals) Update(ctx context.Context, code string, fn func(*models.Hospital) error) (models.Hospital, error) {
+	var hospital models.Hospital
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&hospital, "code = ?", code).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		before := hospital
+		if err := fn(&hospital); err != nil {
+			return err
+		}
+		updates := hospitalUpdates(before, hospital)
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&hospital).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&hospital, "code = ?", code).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return hospital, ErrDuplicate
+	}
+	return hospital, err
+}
+
+func (r *PostgresHospitals) HNFormat(ctx context.Context, hospital string) (models.HNFormat, error) {
+	return services.HNFormatFor(database.DBFromContext(ctx, r.db), hospital)
+}
+
+// HN ที่ออกไปแล้วไม่เปลี่ยน รูปแบบใหม่มีผลกับผู้ป่วยที่ลงทะเบียนหลังจากนี้เท่านั้น
+func (r *PostgresHospitals) SaveHNFormat(ctx context.Context, format models.HNFormat) (models.HNFormat, error) {
+	db := database.DBFromContext(ctx, r.db)
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hospital"}},
+		DoUpdates: clause.AssignmentColumns([]string{"prefix", "year_digits", "separator", "number_digits", "updated_at"}),
+	}).Create(&format).Error
+	if err != nil {
+		return format, err
+	}
+	return services.HNFormatFor(db, format.Hospital)
+}
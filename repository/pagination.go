@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"HIS-api/encryption"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// คีย์สำหรับเรียงลำดับแบบ keyset pagination
+//   - Columns : คอลัมน์ (หรือ expression) ที่ใช้ ORDER BY ตามลำดับ ระบบจะต่อ id ท้ายสุดให้เองเพื่อให้ลำดับไม่ซ้ำ
+//   - Values  : ดึงค่าของคอลัมน์เหล่านั้นจากแถว เพื่อเก็บลง cursor (และใช้เรียงใน repository แบบ in-memory)
+//   - Targets : pointer ที่มี type ตรงกับ Values ใช้ตอนถอด cursor กลับมา
+type SortKey[T any] struct {
+	Columns []string
+	Values  func(T) []interface{}
+	Targets func() []interface{}
+}
+
+// การขอข้อมูลหนึ่งหน้า Sort ขึ้นต้นด้วย "-" หมายถึงเรียงจากมากไปน้อย
+// Cursor คือค่า Next จากหน้าก่อน ต้องใช้คู่กับ Sort เดิม
+type PageRequest struct {
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+type Page[T any] struct {
+	Items   []T
+	Total   int64
+	HasMore bool
+	Next    string
+}
+
+// ข้อมูลใน cursor มีค่าของคีย์เรียงลำดับของแถวสุดท้าย (เช่น ชื่อผู้ป่วย) จึงต้องเข้ารหัสก่อนส่งให้ client
+type pageCursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+	ID     uint              `json:"id"`
+}
+
+// ชื่อที่ใช้เป็น associated data ตอนเข้ารหัส cursor ค่าที่เข้ารหัสไว้ของคอลัมน์อื่นจึงใช้เป็น cursor ไม่ได้
+const cursorColumn = "page_cursor"
+
+// cursor ถูกเข้ารหัสด้วย keyring หลัก (AES-256-GCM) client อ่านหรือแก้ค่าข้างในไม่ได้
+// และ cursor ที่ออกด้วยกุญแจเก่ายังใช้ได้หลังหมุนกุญแจ
+func encodeCursor(sort string, values []interface{}, id uint) (string, error) {
+	cur := pageCursor{Sort: sort, ID: id}
+	for _, v := range values {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		cur.Values = append(cur.Values, raw)
+	}
+
+	data, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := encryption.Default().Encrypt(cursorColumn, string(data))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(sealed)), nil
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var cur pageCursor
+	sealed, err := base64.RawURLEncoding.DecodeString(s)
+	// Decrypt คืนค่าที่ไม่มี prefix ตามเดิม จึงต้องตรวจเองว่าเป็นค่าที่เข้ารหัสแล้ว
+	if err != nil || !strings.HasPrefix(string(sealed), encryption.Prefix) {
+		return cur, ErrInvalidCursor
+	}
+	data, err := encryption.Default().Decrypt(cursorColumn, string(sealed))
+	if err != nil {
+		return cur, ErrInvalidCursor
+	}
+	if err := json.Unmarshal([]byte(data), &cur); err != nil {
+		return cur, ErrInvalidCursor
+	}
+	return cur, nil
+}
+
+// sort ที่ติดมากับ cursor (ค่าว่างถ้าถอดไม่ได้) ใช้เมื่อ client ส่ง cursor มาโดยไม่ระบุ sort
+func CursorSort(cursor string) string {
+	cur, err := decodeCursor(cursor)
+	if err != nil {
+		return ""
+	}
+	return cur.Sort
+}
+
+// ถอด cursor เป็นค่าของคีย์เรียงลำดับและ id ของแถวสุดท้ายในหน้าก่อน
+func cursorValues[T any](key SortKey[T], sort, after string) ([]interface{}, uint, error) {
+	cur, err := decodeCursor(after)
+	if err != nil {
+		return nil, 0, err
+	}
+	targets := key.Targets()
+	if cur.Sort != sort || len(cur.Values) != len(targets) {
+		return nil, 0, ErrInvalidCursor
+	}
+	for i, raw := range cur.Values {
+		if err := json.Unmarshal(raw, targets[i]); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+	}
+	return targets, cur.ID, nil
+}
+
+func sortKeyFor[T any](keys map[string]SortKey[T], sort string) (SortKey[T], bool, error) {
+	key, ok := keys[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return key, false, errors.New("unknown sort key: " + sort)
+	}
+	return key, strings.HasPrefix(sort, "-"), nil
+}
+
+// ตัดผลลัพธ์ที่ดึงมาเกินหนึ่งแถวให้เหลือ limit และสร้าง cursor ของหน้าถัดไป
+func finishPage[T any](result *Page[T], key SortKey[T], id func(T) uint, sort string, limit int) error {
+	if len(result.Items) <= limit {
+		return nil
+	}
+	result.HasMore = true
+	result.Items = result.Items[:limit]
+
+	last := result.Items[len(result.Items)-1]
+	next, err := encodeCursor(sort, key.Values(last), id(last))
+	if err != nil {
+		return err
+	}
+	result.Next = next
+	return nil
+}
+
+// ดึงข้อมูลทีละหน้าแบบ keyset (WHERE (sort columns, id) > cursor) แทน OFFSET
+// เพื่อให้หน้าถัดไปเร็วเท่ากันทุกหน้าและไม่ข้าม/ซ้ำแถวเมื่อมีข้อมูลเพิ่มระหว่างเลื่อนหน้า
+//
+// page.Sort ต้องเป็นคีย์ที่มีอยู่ใน keys
+// คืน ErrInvalidCursor ถ้า cursor ถอดไม่ได้หรือสร้างมาจาก sort อื่น
+func Paginate[T any](db *gorm.DB, keys map[string]SortKey[T], id func(T) uint, page PageRequest) (Page[T], error) {
+	var result Page[T]
+
+	key, desc, err := sortKeyFor(keys, page.Sort)
+	if err != nil {
+		return result, err
+	}
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	base := db.Model(new(T)).Session(&gorm.Session{})
+	if err := base.Count(&result.Total).Error; err != nil {
+		return result, err
+	}
+
+	query := base
+	if page.Cursor != "" {
+		values, lastID, err := cursorValues(key, page.Sort, page.Cursor)
+		if err != nil {
+			return result, err
+		}
+		columns := strings.Join(append(append([]string{}, key.Columns...), "id"), ", ")
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)+1), ", ")
+		query = query.Where("("+columns+") "+comparison+" ("+placeholders+")", append(values, lastID)...)
+	}
+
+	for _, column := range key.Columns {
+		query = query.Order(column + " " + direction)
+	}
+	query = query.Order("id " + direction)
+
+	if err := query.Limit(page.Limit + 1).Find(&result.Items).Error; err != nil {
+		return result, err
+	}
+	return result, finishPage(&result, key, id, page.Sort, page.Limit)
+}
+
+// แบ่งหน้าข้อมูลในหน่วยความจำด้วยกติกาเดียวกับ Paginate (ใช้ใน repository แบบ in-memory)
+func paginateSlice[T any](items []T, keys map[string]SortKey[T], id func(T) uint, page PageRequest) (Page[T], error) {
+	result := Page[T]{Total: int64(len(items))}
+
+	key, desc, err := sortKeyFor(keys, page.Sort)
+	if err != nil {
+		return result, err
+	}
+	order := func(a, b T) int {
+		if c := compareValues(key.Values(a), key.Values(b)); c != 0 {
+			return c
+		}
+		return compareValues([]interface{}{id(a)}, []interface{}{id(b)})
+	}
+	if desc {
+		asc := order
+		order = func(a, b T) int { return -asc(a, b) }
+	}
+
+	sorted := append([]T{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return order(sorted[i], sorted[j]) < 0 })
+
+	if page.Cursor != "" {
+		values, lastID, err := cursorValues(key, page.Sort, page.Cursor)
+		if err != nil {
+			return result, err
+		}
+		after := append(values, lastID)
+		start := len(sorted)
+		for i, item := range sorted {
+			c := compareValues(append(key.Values(item), id(item)), after)
+			if desc {
+				c = -c
+			}
+			if c > 0 {
+				start = i
+				break
+			}
+		}
+		sorted = sorted[start:]
+	}
+
+	if len(sorted) > page.Limit+1 {
+		sorted = sorted[:page.Limit+1]
+	}
+	result.Items = sorted
+	return result, finishPage(&result, key, id, page.Sort, page.Limit)
+}
+
+// เทียบค่าคีย์เรียงลำดับทีละตัว รองรับ string, time.Time และตัวเลข (รวมถึง pointer ของค่าเหล่านั้น)
+func compareValues(a, b []interface{}) int {
+	for i := range a {
+		x := reflect.Indirect(reflect.ValueOf(a[i])).Interface()
+		y := reflect.Indirect(reflect.ValueOf(b[i])).Interface()
+
+		var c int
+		switch x := x.(type) {
+		case string:
+			c = strings.Compare(x, y.(string))
+		case time.Time:
+			c = x.Compare(y.(time.Time))
+		default:
+			xv, yv := toFloat(x), toFloat(y)
+			switch {
+			case xv < yv:
+				c = -1
+			case xv > yv:
+				c = 1
+			}
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return 0
+}
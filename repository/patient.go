@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"HIS-api/models"
+)
+
+// เงื่อนไขค้นหาผู้ป่วย (ค่าว่าง = ไม่กรอง) ทุกเงื่อนไขต้องตรงพร้อมกัน
+// เลขประจำตัว เบอร์โทร และอีเมลต้องตรงทั้งค่า ชื่อค้นแบบบางส่วนทั้งภาษาไทยและอังกฤษ
+type PatientFilter struct {
+	Hospital    string
+	NationalID  string
+	PassportID  string
+	FirstName   string
+	MiddleName  string
+	LastName    string
+	DateOfBirth *time.Time
+	PhoneNumber string
+	Email       string
+}
+
+// ที่เก็บข้อมูลผู้ป่วย ทุก method จำกัดเฉพาะโรงพยาบาลที่ระบุ และไม่นับแถวที่ถูก soft delete
+// ยกเว้น DuplicateField ที่นับด้วยเพราะ unique index ยังนับแถวเหล่านั้นอยู่
+type PatientRepository interface {
+	Search(ctx context.Context, filter PatientFilter, page PageRequest) (Page[models.Patient], error)
+	// คืน ErrNotFound ถ้าไม่พบหรืออยู่โรงพยาบาลอื่น
+	Find(ctx context.Context, hospital string, id uint) (models.Patient, error)
+	// ชื่อคอลัมน์แรกที่ซ้ำกับผู้ป่วยคนอื่นในโรงพยาบาลเดียวกัน (ค่าว่างถ้าไม่ซ้ำ)
+	DuplicateField(ctx context.Context, p *models.Patient) (string, error)
+	// สร้างหรือแก้ไขผู้ป่วย ผู้ป่วยใหม่ที่ยังไม่มี HN จะได้ HN ให้ คืน ErrDuplicate ถ้าชน unique index
+	Save(ctx context.Context, p *models.Patient) error
+	// ลบแบบ soft delete
+	Delete(ctx context.Context, p *models.Patient) error
+}
+
+// คีย์เรียงลำดับผลค้นหาผู้ป่วย (ใส่ "-" นำหน้าเพื่อเรียงจากมากไปน้อย)
+var patientSortKeys = map[string]SortKey[models.Patient]{
+	"name": {
+		Columns: []string{"last_name_th", "first_name_th"},
+		Values:  func(p models.Patient) []interface{} { return []interface{}{p.LastNameTH, p.FirstNameTH} },
+		Targets: func() []interface{} { return []interface{}{new(string), new(string)} },
+	},
+	"dob": {
+		Columns: []string{"date_of_birth"},
+		Values:  func(p models.Patient) []interface{} { return []interface{}{p.DateOfBirth} },
+		Targets: func() []interface{} { return []interface{}{new(time.Time)} },
+	},
+	"hn": {
+		// ผู้ป่วยเก่าที่ยังไม่มี HN ให้นับเป็นค่าว่าง จะได้เทียบค่าใน cursor ได้
+		Columns: []string{"COALESCE(patient_hn, '')"},
+		Values: func(p models.Patient) []interface{} {
+			hn := ""
+			if p.PatientHN != nil {
+				hn = *p.PatientHN
+			}
+			return []interface{}{hn}
+		},
+		Targets: func() []interface{} { return []interface{}{new(string)} },
+	},
+	"created_at": {
+		Columns: []string{"created_at"},
+		Values:  func(p models.Patient) []interface{} { return []interface{}{p.CreatedAt} },
+		Targets: func() []interface{} { return []interface{}{new(time.Time)} },
+	},
+}
+
+func patientID(p models.Patient) uint { return p.ID }
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/services"
+
+	"gorm.io/gorm"
+)
+
+// PatientRepository ในหน่วยความจำ สำหรับทดสอบ handler โดยไม่ต้องมีฐานข้อมูล
+// ใช้พร้อมกันหลาย goroutine ได้ ข้อมูลถูกคัดลอกทั้งขาเข้าและขาออกเหมือนอ่านจากฐานข้อมูล
+type MemoryPatients struct {
+	mu       sync.Mutex
+	patients map[uint]models.Patient
+	nextID   uint
+	// เลขรัน HN ล่าสุดตามโรงพยาบาลและปี (ใช้รูปแบบ default เสมอ)
+	sequences map[string]int64
+}
+
+func NewMemoryPatients(patients ...models.Patient) *MemoryPatients {
+	r := &MemoryPatients{patients: map[uint]models.Patient{}, sequences: map[string]int64{}}
+	for _, p := range patients {
+		r.Save(context.Background(), &p)
+	}
+	return r
+}
+
+func (r *MemoryPatients) Search(ctx context.Context, filter PatientFilter, page PageRequest) (Page[models.Patient], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	contains := func(value, sub string) bool {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(sub))
+	}
+	name := func(th, en, sub string) bool {
+		return sub == "" || contains(th, sub) || contains(en, sub)
+	}
+	equal := func(value *string, want string) bool {
+		return want == "" || (value != nil && *value == want)
+	}
+
+	matches := []models.Patient{}
+	for _, p := range r.patients {
+		if p.DeletedAt.Valid || p.Hospital != filter.Hospital {
+			continue
+		}
+		if !equal(p.NationalID, filter.NationalID) || !equal(p.PassportID, filter.PassportID) ||
+			!equal(&p.PhoneNumber, filter.PhoneNumber) || !equal(p.Email, filter.Email) {
+			continue
+		}
+		if !name(p.FirstNameTH, p.FirstNameEN, filter.FirstName) ||
+			!name(p.MiddleNameTH, p.MiddleNameEN, filter.MiddleName) ||
+			!name(p.LastNameTH, p.LastNameEN, filter.LastName) {
+			continue
+		}
+		if filter.DateOfBirth != nil && !p.DateOfBirth.Equal(*filter.DateOfBirth) {
+			continue
+		}
+		matches = append(matches, clonePatient(p))
+	}
+	return paginateSlice(matches, patientSortKeys, patientID, page)
+}
+
+func (r *MemoryPatients) Find(ctx context.Context, hospital string, id uint) (models.Patient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.patients[id]
+	if !ok || p.DeletedAt.Valid || p.Hospital != hospital {
+		return models.Patient{}, ErrNotFound
+	}
+	return clonePatient(p), nil
+}
+
+func (r *MemoryPatients) DuplicateField(ctx context.Context, p *models.Patient) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.duplicateField(p), nil
+}
+
+func (r *MemoryPatients) duplicateField(p *models.Patient) string {
+	for _, f := range uniquePatientFields(p) {
+		for _, other := range r.patients {
+			if other.ID == p.ID || other.Hospital != p.Hospital {
+				continue
+			}
+			values := map[string]*string{"national_id": other.NationalID, "passport_id": other.PassportID, "email": other.Email}
+			if v := values[f.column]; v != nil && *v == *f.value {
+				return f.column
+			}
+		}
+	}
+	return ""
+}
+
+func (r *MemoryPatients) Save(ctx context.Context, p *models.Patient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.duplicateField(p) != "" {
+		return ErrDuplicate
+	}
+
+	now := time.Now()
+	if p.ID == 0 {
+		r.nextID++
+		p.ID = r.nextID
+		p.CreatedAt = now
+		if p.PatientHN == nil {
+			format := models.DefaultHNFormat(p.Hospital)
+			year := services.BuddhistYear(now)
+			key := fmt.Sprintf("%s/%d", p.Hospital, format.SequenceYear(year))
+			r.sequences[key]++
+			hn := format.Format(year, r.sequences[key])
+			p.PatientHN = &hn
+		}
+	}
+	p.UpdatedAt = now
+	r.patients[p.ID] = clonePatient(*p)
+	return nil
+}
+
+func (r *MemoryPatients) Delete(ctx context.Context, p *models.Patient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.patients[p.ID]
+	if !ok {
+		return nil
+	}
+	stored.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.patients[p.ID] = stored
+	return nil
+}
+
+// คัดลอกผู้ป่วยรวมค่าที่ pointer ชี้อยู่ การแก้สำเนาจะไม่กระทบข้อมูลที่เก็บไว้
+func clonePatient(p models.Patient) models.Patient {
+	for _, field := range []**string{&p.PatientHN, &p.NationalID, &p.PassportID, &p.Email} {
+		if *field != nil {
+			value := **field
+			*field = &value
+		}
+	}
+	return p
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"HIS-api/database"
+	"HIS-api/encryption"
+	"HIS-api/models"
+	"HIS-api/services"
+
+	"gorm.io/gorm"
+)
+
+// PatientRepository บน Postgres ใช้ transaction ของ request ที่แนบไว้ใน ctx
+// (middlewares.TenantTransaction) เพื่อให้ row-level security มีผล
+type PostgresPatients struct {
+	db *gorm.DB
+}
+
+func NewPostgresPatients(db *gorm.DB) *PostgresPatients {
+	return &PostgresPatients{db: db}
+}
+
+func (r *PostgresPatients) Search(ctx context.Context, filter PatientFilter, page PageRequest) (Page[models.Patient], error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	// คอลัมน์ที่เข้ารหัสค้นด้วย blind index แทนค่าจริง
+	if filter.NationalID != "" {
+		conditions = append(conditions, "national_id_index = ?")
+		args = append(args, encryption.BlindIndex("national_id", filter.NationalID))
+	}
+	if filter.PassportID != "" {
+		conditions = append(conditions, "passport_id_index = ?")
+		args = append(args, encryption.BlindIndex("passport_id", filter.PassportID))
+	}
+	if filter.FirstName != "" {
+		conditions = append(conditions, `(first_name_th ILIKE ? ESCAPE '\' OR first_name_en ILIKE ? ESCAPE '\')`)
+		args = append(args, containsPattern(filter.FirstName), containsPattern(filter.FirstName))
+	}
+	if filter.MiddleName != "" {
+		conditions = append(conditions, `(middle_name_th ILIKE ? ESCAPE '\' OR middle_name_en ILIKE ? ESCAPE '\')`)
+		args = append(args, containsPattern(filter.MiddleName), containsPattern(filter.MiddleName))
+	}
+	if filter.LastName != "" {
+		conditions = append(conditions, `(last_name_th ILIKE ? ESCAPE '\' OR last_name_en ILIKE ? ESCAPE '\')`)
+		args = append(args, containsPattern(filter.LastName), containsPattern(filter.LastName))
+	}
+	if filter.DateOfBirth != nil {
+		conditions = append(conditions, "date_of_birth = ?")
+		args = append(args, *filter.DateOfBirth)
+	}
+	if filter.PhoneNumber != "" {
+		conditions = append(conditions, "phone_number_index = ?")
+		args = append(args, encryption.BlindIndex("phone_number", filter.PhoneNumber))
+	}
+	if filter.Email != "" {
+		conditions = append(conditions, "email_index = ?")
+		args = append(args, encryption.BlindIndex("email", filter.Email))
+	}
+
+	// จำกัดเฉพาะโรงพยาบาลของ Staff ตั้งแต่ใน query ผู้ป่วยของโรงพยาบาลอื่นจะไม่ถูกโหลดขึ้นมาเลย
+	db := database.DBFromContext(ctx, r.db).Scopes(models.HospitalScope(filter.Hospital))
+	if len(conditions) > 0 {
+		db = db.Where(strings.Join(conditions, " AND "), args...)
+	}
+	return Paginate(db, patientSortKeys, patientID, page)
+}
+
+// แปลงคำค้นเป็น pattern "มีคำนี้อยู่" ของ ILIKE โดยให้ % _ และ \ ในคำค้นเป็นตัวอักษรธรรมดา
+// ไม่อย่างนั้นค้น "%" ก็จะได้ผู้ป่วยทั้งโรงพยาบาล
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func containsPattern(term string) string {
+	return "%" + likeEscaper.Replace(term) + "%"
+}
+
+func (r *PostgresPatients) Find(ctx context.Context, hospital string, id uint) (models.Patient, error) {
+	var patient models.Patient
+	err := database.DBFromContext(ctx, r.db).Scopes(models.HospitalScope(hospital)).Where("id = ?", id).First(&patient).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return patient, ErrNotFound
+	}
+	return patient, err
+}
+
+// เทียบด้วย blind index เพราะค่าจริงถูกเข้ารหัส
+func (r *PostgresPatients) DuplicateField(ctx context.Context, p *models.Patient) (string, error) {
+	db := database.DBFromContext(ctx, r.db)
+	for _, f := range uniquePatientFields(p) {
+		var count int64
+		err := db.Unscoped().Model(&models.Patient{}).
+			Scopes(models.HospitalScope(p.Hospital)).
+			Where(f.column+"_index = ? AND id <> ?", *models.PatientIndex(f.column, f.value), p.ID).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return f.column, nil
+		}
+	}
+	return "", nil
+}
+
+// HN ของผู้ป่วยใหม่ถูกออกใน transaction เดียวกับการบันทึก
+func (r *PostgresPatients) Save(ctx context.Context, p *models.Patient) error {
+	err := database.DBFromContext(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if p.ID == 0 && p.PatientHN == nil {
+			hn, err := services.NextPatientHN(tx, p.Hospital, time.Now())
+			if err != nil {
+				return err
+			}
+			p.PatientHN = &hn
+		}
+		return tx.Save(p).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *PostgresPatients) Delete(ctx context.Context, p *models.Patient) error {
+	return database.DBFromContext(ctx, r.db).Delete(p).Error
+}
+
+type patientField struct {
+	column string
+	value  *string
+}
+
+// ฟิลด์ของผู้ป่วยที่ต้องไม่ซ้ำในโรงพยาบาลเดียวกัน (เฉพาะที่มีค่า)
+func uniquePatientFields(p *models.Patient) []patientField {
+	fields := []patientField{}
+	for _, f := range []patientField{
+		{"national_id", p.NationalID},
+		{"passport_id", p.PassportID},
+		{"email", p.Email},
+	} {
+		if f.value != nil {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
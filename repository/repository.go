@@ -0,0 +1,9 @@
+package repository
+
+import "errors"
+
+// ข้อผิดพลาดที่ทุก implementation ต้องคืนเหมือนกัน handler จะได้ตอบได้โดยไม่ต้องรู้ว่าเก็บข้อมูลที่ไหน
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("record already exists")
+)
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/services"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// เงื่อนไขค้นหารายชื่อ Staff ในโรงพยาบาล
+// Username ค้นแบบบางส่วน (ไม่สนตัวพิมพ์) Status เป็น active (default), inactive หรือ all
+type StaffFilter struct {
+	Hospital string
+	Username string
+	Role     models.Role
+	Status   string
+}
+
+// ที่เก็บบัญชี Staff กลุ่มแรกเป็นงานจัดการของ admin จำกัดเฉพาะโรงพยาบาลที่ระบุ
+// กลุ่มหลังเป็นขั้นตอนยืนยันตัวตน (login, MFA, รหัสผ่าน, session) ซึ่งผู้เรียกยังไม่ได้ login หรือรู้ ID จาก token แล้ว
+type StaffRepository interface {
+	List(ctx context.Context, filter StaffFilter, page PageRequest) (Page[models.Staff], error)
+	// คืน ErrNotFound ถ้าไม่พบหรืออยู่โรงพยาบาลอื่น
+	Find(ctx context.Context, hospital string, id uint) (models.Staff, error)
+	// โหลด Staff พร้อมล็อกแถว ให้ fn แก้ username, role หรือสถานะการใช้งาน แล้วบันทึกเฉพาะที่เปลี่ยน
+	// ถ้า fn คืน error จะไม่บันทึกอะไร คืน ErrDuplicate ถ้า username ซ้ำกับบัญชีอื่น
+	Update(ctx context.Context, hospital string, id uint, fn func(*models.Staff) error) (models.Staff, error)
+	// revoke refresh token ทั้งหมดของ Staff (ใช้หลังปิดบัญชีหรือเปลี่ยนรหัสผ่าน)
+	RevokeSessions(ctx context.Context, staffID uint) error
+	// ประวัติการล็อก/ปลดล็อกบัญชีในโรงพยาบาล ล่าสุดก่อน (staffID เป็น 0 = ทุกบัญชี)
+	LockoutEvents(ctx context.Context, hospital string, staffID uint, limit int) ([]models.LockoutEvent, error)
+
+	// บันทึกบัญชีใหม่ที่ hash รหัสผ่านแล้ว (services.PasswordPolicy.NewStaff) พร้อมเก็บรหัสผ่านแรกในประวัติ
+	// คืน ErrDuplicate ถ้า username ซ้ำ
+	Create(ctx context.Context, staff models.Staff) (models.Staff, error)
+	// คืน ErrNotFound ถ้าไม่พบ
+	FindByUsername(ctx context.Context, hospital, username string) (models.Staff, error)
+	FindByID(ctx context.Context, id uint) (models.Staff, error)
+	// โรงพยาบาลนี้มีอยู่และเปิดใช้งานอยู่หรือไม่
+	HospitalActive(ctx context.Context, hospital string) (bool, error)
+	// role ล่าสุด สถานะบัญชี เวลาเปลี่ยนรหัสผ่านล่าสุด และสถานะโรงพยาบาล ที่ AuthMiddleware ตรวจทุก request
+	// คืน ErrNotFound ถ้าไม่พบ (เช่น ถูกลบไปแล้ว)
+	Status(ctx context.Context, id uint) (services.StaffStatus, error)
+	// โหลด Staff พร้อมล็อกแถว ให้ fn แก้ตัวนับการใส่ผิดและเวลาล็อก (ดู services.LoginPolicy) แล้วบันทึกเฉพาะคอลัมน์เหล่านั้น
+	// LockoutEvent ที่ fn คืนมา (ถ้ามี) ถูกบันทึกในทรานแซกชันเดียวกัน คืน ErrNotFound ถ้าไม่พบ
+	UpdateLoginState(ctx context.Context, id uint, fn func(*models.Staff) *models.LockoutEvent) (models.Staff, error)
+	RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	// จำนวนครั้งที่ IP ใส่ผิดตั้งแต่ since และเวลาที่ผิดครั้งล่าสุด (nil ถ้าไม่มี)
+	IPFailures(ctx context.Context, ip string, since time.Time) (int, *time.Time, error)
+
+	// โหลด Staff พร้อมล็อกแถวและ hash ของรหัสผ่าน keep ครั้งล่าสุด (ใหม่สุดก่อน) ให้ fn คืน hash ของรหัสผ่านใหม่
+	// (services.PasswordPolicy.ChangePassword) แล้วบันทึกโดยไม่ต้องเปลี่ยนรหัสอีก เก็บลงประวัติ และเหลือประวัติไว้ไม่เกิน keep ครั้ง
+	// ถ้า fn คืน error จะไม่บันทึกอะไร คืน ErrNotFound ถ้าไม่พบ
+	SetPassword(ctx context.Context, id uint, keep int, fn func(staff models.Staff, history []string) (string, error)) (models.Staff, error)
+	// เหมือน SetPassword แต่หา Staff จาก hash ของ token รีเซ็ต (services.HashResetToken) ที่ยังไม่ใช้และยังไม่หมดอายุ
+	// สำเร็จแล้ว token ถูกใช้แล้ว และบัญชีถูกปลดล็อก คืน ErrNotFound ถ้า token ใช้ไม่ได้
+	ResetPassword(ctx context.Context, tokenHash string, keep int, fn func(staff models.Staff, history []string) (string, error)) (models.Staff, error)
+	// ยกเลิก token รีเซ็ตเดิมที่ยังไม่ได้ใช้ บันทึก reset.Record และแทนรหัสผ่านด้วย reset.UnusableHash (ต้องเปลี่ยนรหัสผ่าน)
+	// คืน ErrNotFound ถ้าไม่พบหรืออยู่โรงพยาบาลอื่น
+	IssuePasswordReset(ctx context.Context, hospital string, id uint, reset services.PasswordReset) error
+	// โหลด Staff พร้อมล็อกแถว ให้ fn แก้สถานะ MFA (ดู services/mfa.go) แล้วบันทึก fn คืน hash ของรหัสกู้คืนชุดใหม่
+	// ที่แทนชุดเดิม (nil = ไม่เปลี่ยน, slice ว่าง = ลบทั้งหมด) ถ้า fn คืน error จะไม่บันทึกอะไร คืน ErrNotFound ถ้าไม่พบ
+	UpdateMFA(ctx context.Context, id uint, fn func(*models.Staff) ([]string, error)) (models.Staff, error)
+	// ใช้รหัสกู้คืน (services.HashRecoveryCode) ใช้แล้วใช้ซ้ำไม่ได้
+	// คืน ErrNotFound ถ้าไม่มีรหัสที่ยังไม่ใช้ตรงกัน หรือ Staff ไม่ได้เปิดใช้ MFA
+	UseRecoveryCode(ctx context.Context, id uint, codeHash string) error
+
+	// refresh token ดู package tokens ข้อผิดพลาดเป็น tokens.ErrRefreshTokenInvalid หรือ tokens.ErrRefreshTokenReused
+	IssueRefreshToken(ctx context.Context, staffID uint) (string, error)
+	RotateRefreshToken(ctx context.Context, token string) (models.Staff, string, error)
+	RevokeRefreshFamily(ctx context.Context, token string, staffID uint) error
+	// denylist ของ access token และ token ชั่วคราว (jti)
+	RevokeToken(ctx context.Context, claims jwt.MapClaims) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+var staffSortKeys = map[string]SortKey[models.Staff]{
+	"username": {
+		Columns: []string{"username"},
+		Values:  func(s models.Staff) []interface{} { return []interface{}{s.Username} },
+		Targets: func() []interface{} { return []interface{}{new(string)} },
+	},
+	"created_at": {
+		Columns: []string{"created_at"},
+		Values:  func(s models.Staff) []interface{} { return []interface{}{s.CreatedAt} },
+		Targets: func() []interface{} { return []interface{}{new(time.Time)} },
+	},
+}
+
+func staffID(s models.Staff) uint { return s.ID }
+
+// ประวัติรหัสผ่านเก็บอย่างน้อยรหัสปัจจุบัน
+func keptHistory(keep int) int {
+	return max(keep, 1)
+}
+
+// คอลัมน์ที่ UpdateMFA บันทึก
+func mfaUpdates(s models.Staff) map[string]interface{} {
+	return map[string]interface{}{
+		"mfa_enabled":        s.MFAEnabled,
+		"mfa_secret":         s.MFASecret,
+		"mfa_last_used_step": s.MFALastUsedStep,
+	}
+}
+
+// คอลัมน์ที่ UpdateLoginState บันทึก
+func loginStateUpdates(s models.Staff) map[string]interface{} {
+	return map[string]interface{}{
+		"failed_login_attempts": s.FailedLoginAttempts,
+		"last_failed_login_at":  s.LastFailedLoginAt,
+		"locked_until":          s.LockedUntil,
+	}
+}
+
+// คอลัมน์ที่ Update บันทึกได้ และค่าปัจจุบันของแต่ละคอลัมน์
+func staffUpdates(before, after models.Staff) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if after.Username != before.Username {
+		updates["username"] = after.Username
+	}
+	if after.Role != before.Role {
+		updates["role"] = after.Role
+	}
+	if !equalTime(after.DeactivatedAt, before.DeactivatedAt) || !equalUint(after.DeactivatedBy, before.DeactivatedBy) {
+		updates["deactivated_at"] = after.DeactivatedAt
+		updates["deactivated_by"] = after.DeactivatedBy
+	}
+	return updates
+}
+
+func equalTime(a, b *time.Time) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+}
+
+func equalUint(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
@@ -0,0 +1,531 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/services"
+	"HIS-api/tokens"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StaffRepository ในหน่วยความจำ สำหรับทดสอบ handler โดยไม่ต้องมีฐานข้อมูล
+// โรงพยาบาลทุกแห่งถือว่าเปิดใช้งานอยู่ จนกว่าจะเรียก SuspendHospital
+type MemoryStaff struct {
+	mu        sync.Mutex
+	staff     map[uint]models.Staff
+	nextID    uint
+	revoked   map[uint]int
+	suspended map[string]bool
+	events    []models.LockoutEvent
+	attempts  []models.LoginAttempt
+	refresh   map[string]*memoryRefreshToken
+	denylist  map[string]time.Time
+	// hash ของรหัสผ่านที่เคยตั้ง เก่าสุดก่อน
+	history  map[uint][]string
+	resets   map[string]*models.PasswordResetToken
+	recovery map[uint][]*models.MFARecoveryCode
+}
+
+type memoryRefreshToken struct {
+	staffID   uint
+	familyID  string
+	expiresAt time.Time
+	revoked   bool
+}
+
+// สร้างจากบัญชีที่ให้มา บัญชีที่ ID เป็น 0 จะได้ ID ใหม่ตามลำดับ
+func NewMemoryStaff(staff ...models.Staff) *MemoryStaff {
+	r := &MemoryStaff{
+		staff:     map[uint]models.Staff{},
+		revoked:   map[uint]int{},
+		suspended: map[string]bool{},
+		refresh:   map[string]*memoryRefreshToken{},
+		denylist:  map[string]time.Time{},
+		history:   map[uint][]string{},
+		resets:    map[string]*models.PasswordResetToken{},
+		recovery:  map[uint][]*models.MFARecoveryCode{},
+	}
+	for _, s := range staff {
+		r.Add(s)
+	}
+	return r
+}
+
+// เพิ่มบัญชี คืนบัญชีที่บันทึกแล้ว (มี ID)
+func (r *MemoryStaff) Add(s models.Staff) models.Staff {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.add(s)
+}
+
+// ต้องถือ r.mu อยู่แล้ว
+func (r *MemoryStaff) add(s models.Staff) models.Staff {
+	if s.ID == 0 {
+		r.nextID++
+		s.ID = r.nextID
+	} else if s.ID > r.nextID {
+		r.nextID = s.ID
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	s.UpdatedAt = s.CreatedAt
+	r.staff[s.ID] = s
+	if s.Password != "" {
+		r.history[s.ID] = []string{s.Password}
+	}
+	return s
+}
+
+func (r *MemoryStaff) List(ctx context.Context, filter StaffFilter, page PageRequest) (Page[models.Staff], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matches := []models.Staff{}
+	for _, s := range r.staff {
+		if s.DeletedAt.Valid || s.Hospital != filter.Hospital {
+			continue
+		}
+		if filter.Username != "" && !strings.Contains(strings.ToLower(s.Username), strings.ToLower(filter.Username)) {
+			continue
+		}
+		if filter.Role != "" && s.Role != filter.Role {
+			continue
+		}
+		switch filter.Status {
+		case "", "active":
+			if !s.Active() {
+				continue
+			}
+		case "inactive":
+			if s.Active() {
+				continue
+			}
+		}
+		matches = append(matches, s)
+	}
+	return paginateSlice(matches, staffSortKeys, staffID, page)
+}
+
+func (r *MemoryStaff) Find(ctx context.Context, hospital string, id uint) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.staff[id]
+	if !ok || s.DeletedAt.Valid || s.Hospital != hospital {
+		return models.Staff{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (r *MemoryStaff) Update(ctx context.Context, hospital string, id uint, fn func(*models.Staff) error) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.staff[id]
+	if !ok || before.DeletedAt.Valid || before.Hospital != hospital {
+		return models.Staff{}, ErrNotFound
+	}
+	staff := before
+	if err := fn(&staff); err != nil {
+		return before, err
+	}
+	if len(staffUpdates(before, staff)) == 0 {
+		return before, nil
+	}
+	for _, other := range r.staff {
+		if other.ID != id && other.Username == staff.Username {
+			return before, ErrDuplicate
+		}
+	}
+	staff.UpdatedAt = time.Now()
+	r.staff[id] = staff
+	return staff, nil
+}
+
+func (r *MemoryStaff) RevokeSessions(ctx context.Context, staffID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[staffID]++
+	for _, record := range r.refresh {
+		if record.staffID == staffID {
+			record.revoked = true
+		}
+	}
+	return nil
+}
+
+// จำนวนครั้งที่ revoke session ของ Staff
+func (r *MemoryStaff) RevokedSessions(staffID uint) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.revoked[staffID]
+}
+
+// ระงับการใช้งานโรงพยาบาล (HospitalActive คืน false)
+func (r *MemoryStaff) SuspendHospital(hospital string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.suspended[hospital] = true
+}
+
+// การพยายามเข้าสู่ระบบที่บันทึกไว้ทั้งหมด
+func (r *MemoryStaff) LoginAttempts() []models.LoginAttempt {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.LoginAttempt(nil), r.attempts...)
+}
+
+func (r *MemoryStaff) LockoutEvents(ctx context.Context, hospital string, staffID uint, limit int) ([]models.LockoutEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []models.LockoutEvent{}
+	for i := len(r.events) - 1; i >= 0 && len(events) < limit; i-- {
+		e := r.events[i]
+		if e.Hospital == hospital && (staffID == 0 || e.StaffID == staffID) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *MemoryStaff) Create(ctx context.Context, staff models.Staff) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.staff {
+		if other.Username == staff.Username {
+			return staff, ErrDuplicate
+		}
+	}
+	staff.ID = 0
+	return r.add(staff), nil
+}
+
+func (r *MemoryStaff) FindByUsername(ctx context.Context, hospital, username string) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.staff {
+		if !s.DeletedAt.Valid && s.Hospital == hospital && s.Username == username {
+			return s, nil
+		}
+	}
+	return models.Staff{}, ErrNotFound
+}
+
+func (r *MemoryStaff) FindByID(ctx context.Context, id uint) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.staff[id]
+	if !ok || s.DeletedAt.Valid {
+		return models.Staff{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (r *MemoryStaff) HospitalActive(ctx context.Context, hospital string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.suspended[hospital], nil
+}
+
+func (r *MemoryStaff) Status(ctx context.Context, id uint) (services.StaffStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.staff[id]
+	if !ok || s.DeletedAt.Valid {
+		return services.StaffStatus{}, ErrNotFound
+	}
+	status := services.StaffStatus{
+		Role:              s.Role,
+		DeactivatedAt:     s.DeactivatedAt,
+		PasswordChangedAt: s.PasswordChangedAt,
+		HospitalStatus:    models.HospitalActive,
+	}
+	if r.suspended[s.Hospital] {
+		status.HospitalStatus = models.HospitalSuspended
+	}
+	return status, nil
+}
+
+func (r *MemoryStaff) UpdateLoginState(ctx context.Context, id uint, fn func(*models.Staff) *models.LockoutEvent) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	staff, ok := r.staff[id]
+	if !ok || staff.DeletedAt.Valid {
+		return models.Staff{}, ErrNotFound
+	}
+	if event := fn(&staff); event != nil {
+		event.ID = uint(len(r.events) + 1)
+		event.CreatedAt = time.Now()
+		r.events = append(r.events, *event)
+	}
+	// บันทึกเฉพาะคอลัมน์ของสถานะการ login เหมือน Postgres
+	stored := r.staff[id]
+	stored.FailedLoginAttempts, stored.LastFailedLoginAt, stored.LockedUntil = staff.FailedLoginAttempts, staff.LastFailedLoginAt, staff.LockedUntil
+	r.staff[id] = stored
+	return stored, nil
+}
+
+func (r *MemoryStaff) RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt.ID = uint(len(r.attempts) + 1)
+	if attempt.CreatedAt.IsZero() {
+		attempt.CreatedAt = time.Now()
+	}
+	r.attempts = append(r.attempts, attempt)
+	return nil
+}
+
+func (r *MemoryStaff) IPFailures(ctx context.Context, ip string, since time.Time) (int, *time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failures := 0
+	var last *time.Time
+	for _, a := range r.attempts {
+		if a.IP != ip || a.Success || !a.CreatedAt.After(since) {
+			continue
+		}
+		failures++
+		if last == nil || a.CreatedAt.After(*last) {
+			created := a.CreatedAt
+			last = &created
+		}
+	}
+	return failures, last, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ต้องถือ r.mu อยู่แล้ว
+func (r *MemoryStaff) issueRefreshToken(staffID uint, familyID string) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	if familyID == "" {
+		if familyID, err = randomHex(16); err != nil {
+			return "", err
+		}
+	}
+	r.refresh[token] = &memoryRefreshToken{staffID: staffID, familyID: familyID, expiresAt: time.Now().Add(tokens.RefreshTokenTTL())}
+	return token, nil
+}
+
+// ต้องถือ r.mu อยู่แล้ว
+func (r *MemoryStaff) revokeFamily(familyID string) {
+	for _, record := range r.refresh {
+		if record.familyID == familyID {
+			record.revoked = true
+		}
+	}
+}
+
+func (r *MemoryStaff) IssueRefreshToken(ctx context.Context, staffID uint) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.issueRefreshToken(staffID, "")
+}
+
+func (r *MemoryStaff) RotateRefreshToken(ctx context.Context, token string) (models.Staff, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.refresh[token]
+	if !ok {
+		return models.Staff{}, "", tokens.ErrRefreshTokenInvalid
+	}
+	staff, found := r.staff[record.staffID]
+	if record.revoked {
+		if !found {
+			staff = models.Staff{}
+			staff.ID = record.staffID
+		}
+		r.revokeFamily(record.familyID)
+		return staff, "", tokens.ErrRefreshTokenReused
+	}
+	if !found || staff.DeletedAt.Valid || time.Now().After(record.expiresAt) {
+		return models.Staff{}, "", tokens.ErrRefreshTokenInvalid
+	}
+
+	record.revoked = true
+	next, err := r.issueRefreshToken(staff.ID, record.familyID)
+	return staff, next, err
+}
+
+func (r *MemoryStaff) RevokeRefreshFamily(ctx context.Context, token string, staffID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.refresh[token]
+	if !ok || record.staffID != staffID {
+		return tokens.ErrRefreshTokenInvalid
+	}
+	r.revokeFamily(record.familyID)
+	return nil
+}
+
+func (r *MemoryStaff) RevokeToken(ctx context.Context, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return tokens.ErrInvalidToken
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.denylist[jti] = exp.Time
+	return nil
+}
+
+func (r *MemoryStaff) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.denylist[jti]
+	return ok, nil
+}
+
+func (r *MemoryStaff) SetPassword(ctx context.Context, id uint, keep int, fn func(models.Staff, []string) (string, error)) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	staff, ok := r.staff[id]
+	if !ok || staff.DeletedAt.Valid {
+		return models.Staff{}, ErrNotFound
+	}
+	return r.setPassword(staff, keep, fn)
+}
+
+func (r *MemoryStaff) ResetPassword(ctx context.Context, tokenHash string, keep int, fn func(models.Staff, []string) (string, error)) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.resets[tokenHash]
+	if !ok || record.UsedAt != nil || !time.Now().Before(record.ExpiresAt) {
+		return models.Staff{}, ErrNotFound
+	}
+	staff, ok := r.staff[record.StaffID]
+	if !ok || staff.DeletedAt.Valid {
+		return models.Staff{}, ErrNotFound
+	}
+	staff, err := r.setPassword(staff, keep, fn)
+	if err != nil {
+		return staff, err
+	}
+	staff.FailedLoginAttempts, staff.LastFailedLoginAt, staff.LockedUntil = 0, nil, nil
+	r.staff[staff.ID] = staff
+	now := time.Now()
+	record.UsedAt = &now
+	return staff, nil
+}
+
+// ต้องถือ r.mu อยู่แล้ว
+func (r *MemoryStaff) setPassword(staff models.Staff, keep int, fn func(models.Staff, []string) (string, error)) (models.Staff, error) {
+	var history []string
+	stored := r.history[staff.ID]
+	for i := len(stored) - 1; i >= 0 && len(history) < keep; i-- {
+		history = append(history, stored[i])
+	}
+	hash, err := fn(staff, history)
+	if err != nil {
+		return staff, err
+	}
+
+	now := time.Now()
+	staff.Password, staff.PasswordChangedAt, staff.MustChangePassword = hash, &now, false
+	staff.UpdatedAt = now
+	r.staff[staff.ID] = staff
+	stored = append(stored, hash)
+	if len(stored) > keptHistory(keep) {
+		stored = stored[len(stored)-keptHistory(keep):]
+	}
+	r.history[staff.ID] = stored
+	return staff, nil
+}
+
+func (r *MemoryStaff) IssuePasswordReset(ctx context.Context, hospital string, id uint, reset services.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	staff, ok := r.staff[id]
+	if !ok || staff.DeletedAt.Valid || staff.Hospital != hospital {
+		return ErrNotFound
+	}
+	now := time.Now()
+	for _, record := range r.resets {
+		if record.StaffID == id && record.UsedAt == nil {
+			record.UsedAt = &now
+		}
+	}
+	record := reset.Record
+	record.StaffID, record.CreatedAt = id, now
+	r.resets[record.TokenHash] = &record
+
+	staff.Password, staff.PasswordChangedAt, staff.MustChangePassword = reset.UnusableHash, &now, true
+	r.staff[id] = staff
+	return nil
+}
+
+func (r *MemoryStaff) UpdateMFA(ctx context.Context, id uint, fn func(*models.Staff) ([]string, error)) (models.Staff, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	staff, ok := r.staff[id]
+	if !ok || staff.DeletedAt.Valid {
+		return models.Staff{}, ErrNotFound
+	}
+	recoveryCodes, err := fn(&staff)
+	if err != nil {
+		return r.staff[id], err
+	}
+	// บันทึกเฉพาะคอลัมน์ของ MFA เหมือน Postgres
+	stored := r.staff[id]
+	stored.MFAEnabled, stored.MFASecret, stored.MFALastUsedStep = staff.MFAEnabled, staff.MFASecret, staff.MFALastUsedStep
+	r.staff[id] = stored
+	if recoveryCodes != nil {
+		codes := make([]*models.MFARecoveryCode, 0, len(recoveryCodes))
+		for _, hash := range recoveryCodes {
+			codes = append(codes, &models.MFARecoveryCode{StaffID: id, CodeHash: hash, CreatedAt: time.Now()})
+		}
+		r.recovery[id] = codes
+	}
+	return stored, nil
+}
+
+func (r *MemoryStaff) UseRecoveryCode(ctx context.Context, id uint, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.staff[id].MFAEnabled {
+		return ErrNotFound
+	}
+	for _, code := range r.recovery[id] {
+		if code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"HIS-api/models"
+	"HIS-api/services"
+	"HIS-api/tokens"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StaffRepository บน Postgres (ตาราง staffs ไม่ได้อยู่ใต้ row-level security จึงใช้ db ตรงๆ)
+type PostgresStaff struct {
+	db *gorm.DB
+}
+
+func NewPostgresStaff(db *gorm.DB) *PostgresStaff {
+	return &PostgresStaff{db: db}
+}
+
+func (r *PostgresStaff) List(ctx context.Context, filter StaffFilter, page PageRequest) (Page[models.Staff], error) {
+	db := r.db.WithContext(ctx).Scopes(models.HospitalScope(filter.Hospital))
+	if filter.Username != "" {
+		// escape wildcard ของ LIKE เพื่อให้ค้นหาตามตัวอักษรจริง
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.Username)
+		db = db.Where("username ILIKE ?", "%"+escaped+"%")
+	}
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	switch filter.Status {
+	case "", "active":
+		db = db.Where("deactivated_at IS NULL")
+	case "inactive":
+		db = db.Where("deactivated_at IS NOT NULL")
+	}
+	return Paginate(db, staffSortKeys, staffID, page)
+}
+
+func (r *PostgresStaff) Find(ctx context.Context, hospital string, id uint) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Scopes(models.HospitalScope(hospital)).First(&staff, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return staff, ErrNotFound
+	}
+	return staff, err
+}
+
+func (r *PostgresStaff) Update(ctx context.Context, hospital string, id uint, fn func(*models.Staff) error) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(models.HospitalScope(hospital)).First(&staff, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		before := staff
+		if err := fn(&staff); err != nil {
+			return err
+		}
+		updates := staffUpdates(before, staff)
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&staff).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&staff, staff.ID).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return staff, ErrDuplicate
+	}
+	return staff, err
+}
+
+func (r *PostgresStaff) RevokeSessions(ctx context.Context, staffID uint) error {
+	return tokens.RevokeAllForStaff(r.db.WithContext(ctx), staffID)
+}
+
+func (r *PostgresStaff) LockoutEvents(ctx context.Context, hospital string, staffID uint, limit int) ([]models.LockoutEvent, error) {
+	query := r.db.WithContext(ctx).Scopes(models.HospitalScope(hospital)).Order("created_at DESC").Limit(limit)
+	if staffID != 0 {
+		query = query.Where("staff_id = ?", staffID)
+	}
+	events := []models.LockoutEvent{}
+	err := query.Find(&events).Error
+	return events, err
+}
+
+func (r *PostgresStaff) Create(ctx context.Context, staff models.Staff) (models.Staff, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&staff).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordHistory{StaffID: staff.ID, Hash: staff.Password}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return staff, ErrDuplicate
+	}
+	return staff, err
+}
+
+func (r *PostgresStaff) FindByUsername(ctx context.Context, hospital, username string) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Where("username = ? AND hospital = ?", username, hospital).First(&staff).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return staff, ErrNotFound
+	}
+	return staff, err
+}
+
+func (r *PostgresStaff) FindByID(ctx context.Context, id uint) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).First(&staff, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return staff, ErrNotFound
+	}
+	return staff, err
+}
+
+func (r *PostgresStaff) HospitalActive(ctx context.Context, hospital string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Hospital{}).
+		Where("code = ? AND status = ?", hospital, models.HospitalActive).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// โหลดในคำสั่งเดียวด้วยการ join กับ hospitals
+func (r *PostgresStaff) Status(ctx context.Context, id uint) (services.StaffStatus, error) {
+	var status services.StaffStatus
+	result := r.db.WithContext(ctx).Model(&models.Staff{}).
+		Select("staffs.role, staffs.deactivated_at, staffs.password_changed_at, hospitals.status AS hospital_status").
+		Joins("JOIN hospitals ON hospitals.code = staffs.hospital").
+		Where("staffs.id = ?", id).
+		Scan(&status)
+	if result.Error != nil {
+		return status, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return status, ErrNotFound
+	}
+	return status, nil
+}
+
+func (r *PostgresStaff) UpdateLoginState(ctx context.Context, id uint, fn func(*models.Staff) *models.LockoutEvent) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&staff, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		event := fn(&staff)
+		if err := tx.Model(&staff).Updates(loginStateUpdates(staff)).Error; err != nil {
+			return err
+		}
+		if event == nil {
+			return nil
+		}
+		return tx.Create(event).Error
+	})
+	return staff, err
+}
+
+func (r *PostgresStaff) RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	return r.db.WithContext(ctx).Create(&attempt).Error
+}
+
+func (r *PostgresStaff) IPFailures(ctx context.Context, ip string, since time.Time) (int, *time.Time, error) {
+	var result struct {
+		Failures int
+		Last     *time.Time
+	}
+	err := r.db.WithContext(ctx).Model(&models.LoginAttempt{}).
+		Select("COUNT(*) AS failures, MAX(created_at) AS last").
+		Where("ip = ? AND success = ? AND created_at > ?", ip, false, since).
+		Scan(&result).Error
+	return result.Failures, result.Last, err
+}
+
+func (r *PostgresStaff) IssueRefreshToken(ctx context.Context, staffID uint) (string, error) {
+	return tokens.IssueRefreshToken(r.db.WithContext(ctx), staffID, "")
+}
+
+func (r *PostgresStaff) RotateRefreshToken(ctx context.Context, token string) (models.Staff, string, error) {
+	return tokens.RotateRefreshToken(r.db.WithContext(ctx), token)
+}
+
+func (r *PostgresStaff) RevokeRefreshFamily(ctx context.Context, token string, staffID uint) error {
+	return tokens.RevokeFamily(r.db.WithContext(ctx), token, staffID)
+}
+
+func (r *PostgresStaff) RevokeToken(ctx context.Context, claims jwt.MapClaims) error {
+	return tokens.RevokeToken(r.db.WithContext(ctx), claims)
+}
+
+func (r *PostgresStaff) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return tokens.IsRevoked(r.db.WithContext(ctx), jti)
+}
+
+func (r *PostgresStaff) SetPassword(ctx context.Context, id uint, keep int, fn func(models.Staff, []string) (string, error)) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&staff, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return setPassword(tx, &staff, keep, fn)
+	})
+	return staff, err
+}
+
+func (r *PostgresStaff) ResetPassword(ctx context.Context, tokenHash string, keep int, fn func(models.Staff, []string) (string, error)) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record models.PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&staff, record.StaffID).Error; err != nil {
+			return err
+		}
+		if err := setPassword(tx, &staff, keep, fn); err != nil {
+			return err
+		}
+		// รหัสผ่านใหม่ถูกตั้งโดยเจ้าของบัญชีแล้ว ปลดล็อกและล้างตัวนับการใส่ผิด
+		staff.FailedLoginAttempts, staff.LastFailedLoginAt, staff.LockedUntil = 0, nil, nil
+		if err := tx.Model(&staff).Updates(loginStateUpdates(staff)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&record).Update("used_at", time.Now()).Error
+	})
+	return staff, err
+}
+
+// ตั้งรหัสผ่านใหม่ให้ staff ที่ล็อกแถวไว้แล้ว บันทึกลงประวัติ และลบประวัติที่เก่ากว่า keep ครั้งล่าสุด
+func setPassword(tx *gorm.DB, staff *models.Staff, keep int, fn func(models.Staff, []string) (string, error)) error {
+	var history []string
+	if keep > 0 {
+		err := tx.Model(&models.PasswordHistory{}).Where("staff_id = ?", staff.ID).
+			Order("id DESC").Limit(keep).Pluck("hash", &history).Error
+		if err != nil {
+			return err
+		}
+	}
+	hash, err := fn(*staff, history)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = tx.Model(staff).Updates(map[string]interface{}{
+		"password":             hash,
+		"password_changed_at":  now,
+		"must_change_password": false,
+	}).Error
+	if err != nil {
+		return err
+	}
+	staff.Password, staff.PasswordChangedAt, staff.MustChangePassword = hash, &now, false
+	if err := tx.Create(&models.PasswordHistory{StaffID: staff.ID, Hash: hash}).Error; err != nil {
+		return err
+	}
+	return tx.Where("staff_id = ? AND id NOT IN (?)", staff.ID,
+		tx.Model(&models.PasswordHistory{}).Select("id").Where("staff_id = ?", staff.ID).Order("id DESC").Limit(keptHistory(keep)),
+	).Delete(&models.PasswordHistory{}).Error
+}
+
+func (r *PostgresStaff) IssuePasswordReset(ctx context.Context, hospital string, id uint, reset services.PasswordReset) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var staff models.Staff
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(models.HospitalScope(hospital)).First(&staff, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = tx.Model(&models.PasswordResetToken{}).
+			Where("staff_id = ? AND used_at IS NULL", staff.ID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		record := reset.Record
+		record.StaffID = staff.ID
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+
+		// password_changed_at ทำให้ token ทุกชนิดที่ออกไปก่อนหน้านี้ใช้ไม่ได้ (ดู AuthMiddleware)
+		return tx.Model(&staff).Updates(map[string]interface{}{
+			"password":             reset.UnusableHash,
+			"password_changed_at":  now,
+			"must_change_password": true,
+		}).Error
+	})
+}
+
+func (r *PostgresStaff) UpdateMFA(ctx context.Context, id uint, fn func(*models.Staff) ([]string, error)) (models.Staff, error) {
+	var staff models.Staff
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&staff, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		recoveryCodes, err := fn(&staff)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&staff).Updates(mfaUpdates(staff)).Error; err != nil {
+			return err
+		}
+		if recoveryCodes == nil {
+			return nil
+		}
+		if err := tx.Where("staff_id = ?", staff.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(recoveryCodes) == 0 {
+			return nil
+		}
+		records := make([]models.MFARecoveryCode, 0, len(recoveryCodes))
+		for _, hash := range recoveryCodes {
+			records = append(records, models.MFARecoveryCode{StaffID: staff.ID, CodeHash: hash})
+		}
+		return tx.Create(&records).Error
+	})
+	return staff, err
+}
+
+func (r *PostgresStaff) UseRecoveryCode(ctx context.Context, id uint, codeHash string) error {
+	result := r.db.WithContext(ctx).Model(&models.MFARecoveryCode{}).
+		Where("staff_id = ? AND code_hash = ? AND used_at IS NULL", id, codeHash).
+		Where("EXISTS (SELECT 1 FROM staffs WHERE staffs.id = ? AND staffs.mfa_enabled)", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
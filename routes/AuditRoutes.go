@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"HIS-api/controllers"
+	"HIS-api/middlewares"
+	"HIS-api/models"
+	"HIS-api/repository"
+)
+
+// audit log การเข้าถึงข้อมูลผู้ป่วย ดูได้เฉพาะ auditor ของโรงพยาบาล
+func AuditRoutes(r *gin.Engine, h *controllers.AuditHandler, staff repository.StaffRepository) {
+	audit := r.Group("/audit")
+	audit.Use(middlewares.AuthMiddleware(staff), middlewares.RequirePermission(models.PermAuditRead))
+	{
+		audit.GET("", h.ListAuditEntries)
+		audit.GET("/verify", h.VerifyAuditLog)
+	}
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"HIS-api/controllers"
+)
+
+// ตรวจสุขภาพของ instance ไม่ต้อง login (ไม่เปิดเผยข้อมูลภายในนอกจากสถานะและ schema version)
+func HealthRoutes(r *gin.Engine, h *controllers.HealthHandler) {
+	r.GET("/healthz", h.Liveness)
+	r.GET("/readyz", h.Readiness)
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"HIS-api/controllers"
+	"HIS-api/middlewares"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"gorm.io/gorm"
+)
+
+// ข้อมูลโรงพยาบาลของ Staff ที่ login อยู่ และทะเบียนโรงพยาบาลทั้งระบบสำหรับ system_admin
+func HospitalRoutes(r *gin.Engine, h *controllers.HospitalHandler, staff repository.StaffRepository, db *gorm.DB) {
+	hospital := r.Group("/hospital")
+	hospital.Use(middlewares.AuthMiddleware(staff))
+	{
+		hospital.GET("", h.GetHospital)
+		hospital.PATCH("", middlewares.RequirePermission(models.PermStaffManage), h.UpdateHospital)
+		// hn_formats อยู่ใต้ row-level security ต้องอ่านเขียนผ่าน transaction ที่ตั้งโรงพยาบาลไว้
+		hospital.GET("/hn-format", middlewares.RequirePermission(models.PermStaffManage), middlewares.TenantTransaction(db), h.GetHNFormat)
+		hospital.PUT("/hn-format", middlewares.RequirePermission(models.PermStaffManage), middlewares.TenantTransaction(db), h.UpdateHNFormat)
+	}
+
+	// ลงทะเบียน ดู และระงับโรงพยาบาล (ใช้แทนคำสั่ง CLI create-hospital และ set-hospital-status ได้)
+	registry := r.Group("/hospitals")
+	registry.Use(middlewares.AuthMiddleware(staff), middlewares.RequirePermission(models.PermHospitalManage))
+	{
+		registry.GET("", h.ListHospitals)
+		registry.POST("", h.CreateHospital)
+		registry.PATCH("/:code/status", h.SetHospitalStatus)
+	}
+}
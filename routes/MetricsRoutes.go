@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"HIS-api/metrics"
+)
+
+// metric สำหรับ Prometheus (nginx ไม่เปิดให้เข้าจากภายนอก ให้ Prometheus ดึงจาก app:8080 โดยตรง)
+func MetricsRoutes(r *gin.Engine) {
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+}
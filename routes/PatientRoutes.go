@@ -4,12 +4,21 @@ import (
 	"github.com/gin-gonic/gin"
 	"HIS-api/controllers"
 	"HIS-api/middlewares"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"gorm.io/gorm"
 )
 
-func PatientRoutes(r *gin.Engine) {
+func PatientRoutes(r *gin.Engine, h *controllers.PatientHandler, staff repository.StaffRepository, db *gorm.DB) {
 	patient := r.Group("/patient")
-	patient.Use(middlewares.AuthMiddleware()) 
+	patient.Use(middlewares.AuthMiddleware(staff), middlewares.TenantTransaction(db))
 	{
-		patient.GET("/search", controllers.SearchPatient)
+		patient.POST("/create", middlewares.RequirePermission(models.PermPatientWrite), h.CreatePatient)
+		patient.GET("/search", middlewares.RequirePermission(models.PermPatientRead), h.SearchPatient)
+		patient.GET("/:id", middlewares.RequirePermission(models.PermPatientRead), h.GetPatient)
+		patient.POST("/:id/reveal", middlewares.RequirePermission(models.PermPatientRead, models.PermPatientReveal), h.RevealPatient)
+		patient.PUT("/:id", middlewares.RequirePermission(models.PermPatientWrite), h.UpdatePatient)
+		patient.PATCH("/:id", middlewares.RequirePermission(models.PermPatientWrite), h.PatchPatient)
+		patient.DELETE("/:id", middlewares.RequirePermission(models.PermPatientDelete), h.DeletePatient)
 	}
 }
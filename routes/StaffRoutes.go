@@ -3,12 +3,54 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"HIS-api/controllers"
+	"HIS-api/middlewares"
+	"HIS-api/models"
+	"HIS-api/repository"
 )
 
-func StaffRoutes(r *gin.Engine) {
-	staff := r.Group("/staff")
+func StaffRoutes(r *gin.Engine, h *controllers.StaffHandler, auth *controllers.AuthHandler, staff repository.StaffRepository) {
+	public := r.Group("/staff")
 	{
-		staff.POST("/create", controllers.RegisterStaff)
-		staff.POST("/login", controllers.LoginStaff)
+		public.POST("/login", auth.LoginStaff)
+		public.POST("/login/mfa", auth.VerifyMFALogin)
+		public.POST("/refresh", auth.RefreshSession)
+		public.POST("/password/reset", auth.CompletePasswordReset)
+	}
+
+	// เปลี่ยนรหัสผ่านใช้ได้ทั้ง access token และ token password_change ที่ได้ตอน login
+	password := r.Group("/staff")
+	password.Use(middlewares.PasswordChangeAuth(staff))
+	{
+		password.POST("/password", auth.ChangePassword)
+	}
+
+	// ลงทะเบียน MFA ใช้ได้ทั้ง access token และ token mfa_enroll ที่ได้ตอน login
+	mfa := r.Group("/staff/mfa")
+	mfa.Use(middlewares.MFAEnrollmentAuth(staff))
+	{
+		mfa.POST("/enroll", auth.EnrollMFA)
+		mfa.POST("/activate", auth.ActivateMFA)
+	}
+
+	session := r.Group("/staff")
+	session.Use(middlewares.AuthMiddleware(staff))
+	{
+		session.POST("/logout", auth.LogoutStaff)
+	}
+
+	// จัดการ Staff ต้องเป็น admin ของโรงพยาบาลเท่านั้น
+	admin := r.Group("/staff")
+	admin.Use(middlewares.AuthMiddleware(staff), middlewares.RequirePermission(models.PermStaffManage))
+	{
+		admin.POST("/create", h.RegisterStaff)
+		admin.GET("", h.ListStaff)
+		admin.GET("/:id", h.GetStaff)
+		admin.PATCH("/:id", h.UpdateStaff)
+		admin.POST("/:id/deactivate", h.DeactivateStaff)
+		admin.POST("/:id/reactivate", h.ReactivateStaff)
+		admin.POST("/:id/unlock", h.UnlockStaff)
+		admin.POST("/:id/mfa/reset", auth.ResetStaffMFA)
+		admin.POST("/:id/password/reset", auth.ResetStaffPassword)
+		admin.GET("/lockout-events", h.ListLockoutEvents)
 	}
 }
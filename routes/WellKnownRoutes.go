@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"HIS-api/controllers"
+)
+
+func WellKnownRoutes(r *gin.Engine) {
+	wellKnown := r.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", controllers.JWKS)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/models"
+)
+
+var ErrAuditKeyMissing = errors.New("AUDIT_HMAC_KEY is not set")
+
+// PrevHash ของแถวแรกใน chain
+var AuditGenesisHash = strings.Repeat("0", 64)
+
+// พารามิเตอร์ที่ไม่ระบุตัวบุคคล เก็บค่าจริงได้ ค่าอื่นทั้งหมดจะถูกแทนด้วย HMAC
+// (purpose และ fields มาจากการขอดูข้อมูลอ่อนไหวแบบเต็ม)
+var auditPlainParams = map[string]bool{"limit": true, "sort": true, "purpose": true, "fields": true}
+
+// ข้อมูลของการเข้าถึงที่จะบันทึก
+type AuditRecord struct {
+	Hospital   string
+	ActorID    uint
+	ActorRole  models.Role
+	Action     models.AuditAction
+	PatientIDs []uint
+	Query      map[string]string
+	IP         string
+	RequestID  string
+}
+
+// ตรวจว่าตั้ง AUDIT_HMAC_KEY ไว้แล้ว ใช้ตอนเริ่มระบบ
+func CheckAuditKey() error {
+	_, err := auditKey()
+	return err
+}
+
+func auditKey() ([]byte, error) {
+	key := config.Current().Audit.HMACKey
+	if key == "" {
+		return nil, ErrAuditKeyMissing
+	}
+	return []byte(key), nil
+}
+
+// HMAC-SHA256 ของค่าที่ระบุตัวบุคคล (เช่นเลขบัตรประชาชน) เพื่อเก็บใน audit log แทนค่าจริง
+// ค่าเดียวกันได้ผลเดียวกันเสมอ auditor จึงค้นหาได้ว่าใครค้นเลขนี้ แต่ถอดกลับจาก log ไม่ได้
+func HashIdentifier(value string) (string, error) {
+	key, err := auditKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// แปลงพารามิเตอร์ค้นหาเป็น JSON (เรียงคีย์) โดยแทนค่าที่ระบุตัวบุคคลด้วย HMAC
+func auditQueryJSON(query map[string]string) (string, error) {
+	hashed := map[string]string{}
+	for k, v := range query {
+		if v == "" {
+			continue
+		}
+		if !auditPlainParams[k] {
+			h, err := HashIdentifier(v)
+			if err != nil {
+				return "", err
+			}
+			v = h
+		}
+		hashed[k] = v
+	}
+	data, err := json.Marshal(hashed)
+	return string(data), err
+}
+
+func auditPatientIDsJSON(ids []uint) (string, error) {
+	sorted := append([]uint{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	data, err := json.Marshal(sorted)
+	return string(data), err
+}
+
+// hash ของแถวใน chain คำนวณจากทุกฟิลด์ยกเว้น ID และ Hash เอง
+func auditHash(e models.AuditEntry) string {
+	fields := []string{
+		e.PrevHash,
+		e.Hospital,
+		fmt.Sprint(e.Seq),
+		fmt.Sprint(e.ActorID),
+		string(e.ActorRole),
+		string(e.Action),
+		e.PatientIDs,
+		e.Query,
+		e.IP,
+		e.RequestID,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	// ต่อด้วย JSON array เพื่อไม่ให้ค่าที่มีตัวคั่นปนกันแล้วได้ hash ซ้ำ
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// สร้างแถวของ audit log จากการเข้าถึง (ยังไม่ได้ต่อ chain ดู LinkAuditEntry)
+func NewAuditEntry(rec AuditRecord, now time.Time) (models.AuditEntry, error) {
+	patientIDs, err := auditPatientIDsJSON(rec.PatientIDs)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+	query, err := auditQueryJSON(rec.Query)
+	if err != nil {
+		return models.AuditEntry{}, err
+	}
+
+	return models.AuditEntry{
+		Hospital:   rec.Hospital,
+		ActorID:    rec.ActorID,
+		ActorRole:  rec.ActorRole,
+		Action:     rec.Action,
+		PatientIDs: patientIDs,
+		Query:      query,
+		IP:         rec.IP,
+		RequestID:  rec.RequestID,
+		// Postgres เก็บเวลาละเอียดถึงไมโครวินาที ต้องตัดก่อนคำนวณ hash
+		CreatedAt: now.UTC().Truncate(time.Microsecond),
+	}, nil
+}
+
+// ต่อ entry ท้าย chain ของโรงพยาบาล ถัดจาก last (Seq เป็น 0 ถ้ายังไม่มีแถวใด)
+//
+// ผู้เรียกต้องกันไม่ให้มีการต่อ chain ของโรงพยาบาลเดียวกันพร้อมกัน ระหว่างอ่าน last จนบันทึก entry เสร็จ
+func LinkAuditEntry(entry, last models.AuditEntry) models.AuditEntry {
+	entry.Seq = last.Seq + 1
+	entry.PrevHash = AuditGenesisHash
+	if last.Seq != 0 {
+		entry.PrevHash = last.Hash
+	}
+	entry.Hash = auditHash(entry)
+	return entry
+}
+
+// ผลการตรวจ chain ของโรงพยาบาล
+//   - BrokenAt : Seq แรกที่ตรวจไม่ผ่าน (nil ถ้าผ่านทั้งหมด)
+//   - HeadSeq, HeadHash : แถวล่าสุด ควรเก็บไว้นอกระบบเป็นระยะ เพื่อตรวจการลบแถวท้าย chain ได้
+type AuditVerification struct {
+	Valid    bool    `json:"valid"`
+	Checked  int64   `json:"checked"`
+	BrokenAt *uint64 `json:"broken_at,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+	HeadSeq  uint64  `json:"head_seq"`
+	HeadHash string  `json:"head_hash,omitempty"`
+}
+
+// ตรวจ chain ของ audit log ว่าไม่มีแถวถูกแก้ ลบ หรือแทรก โดยส่งแถวให้ Check ทีละแถวเรียงตาม Seq
+// ไม่ต้องโหลดทั้ง chain พร้อมกัน (ใช้ Result().HeadSeq เป็นจุดเริ่มของชุดถัดไป)
+type AuditChainCheck struct {
+	result AuditVerification
+}
+
+func NewAuditChainCheck() *AuditChainCheck {
+	return &AuditChainCheck{result: AuditVerification{Valid: true}}
+}
+
+// ตรวจแถวถัดไป คืน false เมื่อพบแถวที่ตรวจไม่ผ่าน (ไม่ต้องตรวจต่อ)
+func (c *AuditChainCheck) Check(e models.AuditEntry) bool {
+	if !c.result.Valid {
+		return false
+	}
+
+	prevHash := c.result.HeadHash
+	if c.result.HeadSeq == 0 {
+		prevHash = AuditGenesisHash
+	}
+	reason := ""
+	switch {
+	case e.Seq != c.result.HeadSeq+1:
+		reason = fmt.Sprintf("expected seq %d", c.result.HeadSeq+1)
+	case e.PrevHash != prevHash:
+		reason = "prev_hash does not match previous entry"
+	case e.Hash != auditHash(e):
+		reason = "entry content does not match its hash"
+	}
+	if reason != "" {
+		seq := e.Seq
+		c.result.Valid, c.result.BrokenAt, c.result.Reason = false, &seq, reason
+		return false
+	}
+	c.result.Checked++
+	c.result.HeadSeq, c.result.HeadHash = e.Seq, e.Hash
+	return true
+}
+
+func (c *AuditChainCheck) Result() AuditVerification {
+	return c.result
+}
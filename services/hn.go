@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"HIS-api/models"
+
+	"gorm.io/gorm"
+)
+
+// เวลาประเทศไทย (UTC+7) ใช้ตัดสินว่าเป็นปี พ.ศ. ไหน
+var bangkok = time.FixedZone("ICT", 7*60*60)
+
+// แปลงเวลาเป็นปีพุทธศักราชตามเวลาประเทศไทย
+func BuddhistYear(t time.Time) int {
+	return t.In(bangkok).Year() + 543
+}
+
+// โหลดรูปแบบ HN ของโรงพยาบาล ถ้ายังไม่ได้ตั้งค่าจะใช้ค่า default
+func HNFormatFor(db *gorm.DB, hospital string) (models.HNFormat, error) {
+	var format models.HNFormat
+	err := db.Scopes(models.HospitalScope(hospital)).First(&format).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultHNFormat(hospital), nil
+	}
+	return format, err
+}
+
+// ความยาวสูงสุดของ prefix ของ HN
+const maxHNPrefixLength = 8
+
+// ตัวคั่นระหว่างปีกับเลขรันที่อนุญาต
+var hnSeparators = []string{"-", "/"}
+
+// รูปแบบ HN ไม่ผ่านการตรวจ พร้อมเหตุผลทุกข้อ
+type HNFormatError struct {
+	Reasons []string
+}
+
+func (e *HNFormatError) Error() string {
+	return "invalid hn format: " + strings.Join(e.Reasons, "; ")
+}
+
+// ตรวจรูปแบบ HN ก่อนบันทึก
+//
+// prefix เป็นตัวอักษรภาษาอังกฤษเท่านั้นและต้องมีตัวคั่นเมื่อใส่ปี เพื่อให้ HN ที่ออกด้วยรูปแบบต่างกัน
+// ไม่มีทางซ้ำกัน (เช่น prefix "HN68" ไม่ใส่ปี กับ prefix "HN" ใส่ปี 68 ไม่มีตัวคั่น จะได้ HN เดียวกัน)
+// เลขรันไม่ได้เริ่มใหม่เมื่อเปลี่ยนรูปแบบ จึงเปลี่ยนรูปแบบกลับไปกลับมาได้โดย HN ไม่ชนกัน
+func ValidateHNFormat(format models.HNFormat) error {
+	var reasons []string
+	if len(format.Prefix) > maxHNPrefixLength {
+		reasons = append(reasons, fmt.Sprintf("prefix must be at most %d characters", maxHNPrefixLength))
+	}
+	for _, r := range format.Prefix {
+		if r < 'A' || r > 'Z' {
+			reasons = append(reasons, "prefix must contain only uppercase letters A-Z")
+			break
+		}
+	}
+	switch format.YearDigits {
+	case 0:
+		if format.Separator != "" {
+			reasons = append(reasons, "separator must be empty when year_digits is 0")
+		}
+	case 2, 4:
+		valid := false
+		for _, sep := range hnSeparators {
+			valid = valid || format.Separator == sep
+		}
+		if !valid {
+			reasons = append(reasons, "separator must be one of "+strings.Join(hnSeparators, " ")+" when the year is included")
+		}
+	default:
+		reasons = append(reasons, "year_digits must be 0, 2 or 4")
+	}
+	if format.NumberDigits < 1 || format.NumberDigits > 12 {
+		reasons = append(reasons, "number_digits must be between 1 and 12")
+	}
+
+	if len(reasons) > 0 {
+		return &HNFormatError{Reasons: reasons}
+	}
+	return nil
+}
+
+// ออก HN ใหม่ให้ผู้ป่วยของโรงพยาบาล
+//
+// ต้องเรียกภายใน transaction เดียวกับการบันทึกผู้ป่วย การ upsert จะล็อกแถวของ
+// hn_sequences ไว้จน transaction จบ ทำให้การลงทะเบียนพร้อมกันได้เลขไม่ซ้ำกัน
+// และถ้า transaction ถูก rollback เลขที่ออกไปก็จะถูกคืนด้วย
+func NextPatientHN(tx *gorm.DB, hospital string, now time.Time) (string, error) {
+	format, err := HNFormatFor(tx, hospital)
+	if err != nil {
+		return "", err
+	}
+
+	year := BuddhistYear(now)
+	var next int64
+	err = tx.Raw(`
+		INSERT INTO hn_sequences (hospital, year, last_value, updated_at)
+		VALUES (?, ?, 1, NOW())
+		ON CONFLICT (hospital, year)
+		DO UPDATE SET last_value = hn_sequences.last_value + 1, updated_at = NOW()
+		RETURNING last_value`,
+		hospital, format.SequenceYear(year),
+	).Scan(&next).Error
+	if err != nil {
+		return "", err
+	}
+
+	return format.Format(year, next), nil
+}
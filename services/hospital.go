@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"HIS-api/models"
+)
+
+var (
+	ErrInvalidHospitalCode   = errors.New("invalid hospital code")
+	ErrInvalidHCode          = errors.New("hcode must be 5 digits")
+	ErrInvalidHospitalStatus = errors.New("invalid hospital status")
+)
+
+// รหัสสถานพยาบาลของกระทรวงสาธารณสุขเป็นตัวเลข 5 หลัก
+func validHCode(hcode *string) bool {
+	if hcode == nil {
+		return true
+	}
+	if len(*hcode) != 5 {
+		return false
+	}
+	for _, r := range *hcode {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ตรวจโรงพยาบาลใหม่ก่อนบันทึกด้วย repository.HospitalRepository.Create (ใช้จาก POST /hospitals และคำสั่ง CLI create-hospital)
+// รหัสจะถูกแปลงเป็นรูปแบบมาตรฐาน และสถานะว่างเป็น active
+func NewHospital(hospital models.Hospital) (models.Hospital, error) {
+	hospital.Code = models.NormalizeHospitalCode(hospital.Code)
+	if hospital.Code == "" {
+		return hospital, ErrInvalidHospitalCode
+	}
+	if hospital.NameTH == "" {
+		return hospital, errors.New("name_th is required")
+	}
+	if !validHCode(hospital.HCode) {
+		return hospital, ErrInvalidHCode
+	}
+	if hospital.Status == "" {
+		hospital.Status = models.HospitalActive
+	}
+	if !hospital.Status.Valid() {
+		return hospital, ErrInvalidHospitalStatus
+	}
+	return hospital, nil
+}
+
+// การแก้ไขข้อมูลโรงพยาบาล (nil = ไม่แก้)
+type HospitalUpdate struct {
+	NameTH *string
+	NameEN *string
+	HCode  *string
+	Status *models.HospitalStatus
+}
+
+// แก้ hospital ตามที่ระบุ (ใช้เป็น fn ของ repository.HospitalRepository.Update)
+// รหัส (Code) แก้ไม่ได้เพราะถูกอ้างอิงใน token ที่ออกไปแล้ว ถ้าคืน error จะไม่มีอะไรถูกบันทึก
+func (u HospitalUpdate) Apply(hospital *models.Hospital) error {
+	if u.NameTH != nil {
+		if *u.NameTH == "" {
+			return errors.New("name_th must not be empty")
+		}
+		hospital.NameTH = *u.NameTH
+	}
+	if u.NameEN != nil {
+		hospital.NameEN = *u.NameEN
+	}
+	if u.HCode != nil {
+		hcode := u.HCode
+		if *hcode == "" {
+			hcode = nil
+		}
+		if !validHCode(hcode) {
+			return ErrInvalidHCode
+		}
+		hospital.HCode = hcode
+	}
+	if u.Status != nil {
+		if !u.Status.Valid() {
+			return ErrInvalidHospitalStatus
+		}
+		hospital.Status = *u.Status
+	}
+	return nil
+}
+
+// สถานะที่ AuthMiddleware ตรวจทุก request (โหลดด้วย repository.StaffRepository.Status)
+type StaffStatus struct {
+	Role              models.Role
+	DeactivatedAt     *time.Time
+	PasswordChangedAt *time.Time
+	HospitalStatus    models.HospitalStatus
+}
+
+// บัญชีใช้งานได้ และโรงพยาบาลยังไม่ถูกระงับ
+func (s StaffStatus) Active() bool {
+	return s.DeactivatedAt == nil && s.HospitalStatus == models.HospitalActive
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// นโยบายจำกัดการเดารหัสผ่าน
+//   - หลังใส่ผิดเกิน FreeFailures ครั้ง ต้องรอนานขึ้นเป็นเท่าตัวก่อนลองใหม่ (BaseDelay, 2x, 4x, ... ไม่เกิน MaxDelay)
+//   - ใส่ผิดครบ MaxFailures ครั้งติดกัน บัญชีจะถูกล็อกเป็นเวลา LockoutDuration
+//   - IP เดียวกันใส่ผิดเกิน IPFreeFailures ครั้งภายใน IPWindow จะถูกหน่วงแบบเดียวกัน
+type LoginPolicy struct {
+	FreeFailures    int
+	MaxFailures     int
+	LockoutDuration time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	IPFreeFailures  int
+	IPWindow        time.Duration
+}
+
+// นโยบายจากการตั้งค่า (LOGIN_* หรือ login: ใน YAML)
+func LoginPolicyFromConfig() LoginPolicy {
+	cfg := config.Current().Login
+	return LoginPolicy{
+		FreeFailures:    cfg.FreeFailures,
+		MaxFailures:     cfg.MaxFailures,
+		LockoutDuration: cfg.LockoutDuration,
+		BaseDelay:       cfg.BaseDelay,
+		MaxDelay:        cfg.MaxDelay,
+		IPFreeFailures:  cfg.IPFreeFailures,
+		IPWindow:        cfg.IPWindow,
+	}
+}
+
+// เวลาที่ต้องรอหลังใส่ผิด failures ครั้ง
+func (p LoginPolicy) delay(failures, free int) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := free + 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// ระยะเวลาที่ IP นี้ต้องรอก่อนลองเข้าสู่ระบบอีกครั้ง (0 = ลองได้เลย)
+// failures คือจำนวนครั้งที่ IP นี้ใส่ผิดตั้งแต่ IPWindowStart และ last คือเวลาที่ผิดครั้งล่าสุด
+func (p LoginPolicy) IPRetryAfter(failures int, last *time.Time, now time.Time) time.Duration {
+	if last == nil {
+		return 0
+	}
+	return remaining(*last, p.delay(failures, p.IPFreeFailures), now)
+}
+
+// เวลาเริ่มของช่วงที่นับการใส่ผิดของ IP
+func (p LoginPolicy) IPWindowStart(now time.Time) time.Time {
+	return now.Add(-p.IPWindow)
+}
+
+// ระยะเวลาที่บัญชีนี้ต้องรอก่อนลองเข้าสู่ระบบอีกครั้ง (รวมกรณีถูกล็อก)
+func (p LoginPolicy) StaffRetryAfter(staff models.Staff, now time.Time) time.Duration {
+	if staff.LockedAt(now) {
+		return staff.LockedUntil.Sub(now)
+	}
+	if staff.LastFailedLoginAt == nil {
+		return 0
+	}
+	return remaining(*staff.LastFailedLoginAt, p.delay(staff.FailedLoginAttempts, p.FreeFailures), now)
+}
+
+func remaining(last time.Time, delay time.Duration, now time.Time) time.Duration {
+	if wait := last.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// hash ของรหัสผ่านที่ไม่มีใครรู้ (สร้างครั้งแรกที่ใช้)
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("no-staff-has-this-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// ตรวจรหัสผ่านกับ hash ที่ไม่มีวันตรง ใช้กับ username ที่ไม่มีอยู่หรือบัญชีที่ต้องรอ
+// เพื่อให้ใช้เวลาตอบใกล้เคียงกับการตรวจรหัสผ่านจริง และแยกจากเวลาไม่ได้ว่าบัญชีไหนมีอยู่
+func CompareDummyPassword(password string) {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+}
+
+// จองสิทธิ์ลองยืนยันตัวตนหนึ่งครั้ง ต้องเรียกก่อนตรวจรหัสผ่านหรือรหัส MFA ทุกครั้ง
+// ใช้ใน repository.StaffRepository.UpdateLoginState ซึ่งล็อกแถวของ Staff ไว้ (SELECT ... FOR UPDATE) และบันทึกผลในทรานแซกชันเดียวกัน
+// request ที่ยิงพร้อมกันจึงต้องผ่านการหน่วงและการล็อกทีละครั้ง ไม่ใช่ผ่านการตรวจพร้อมกันทั้งหมด
+// ถ้าต้องรอจะคืนเวลาที่ต้องรอ (> 0) และไม่นับครั้งนี้ ถ้าไม่ต้องรอจะนับครั้งนี้เป็นการใส่ผิดไว้ก่อน
+// คืน LockoutEvent ถ้าการจองครั้งนี้ทำให้บัญชีถูกล็อก
+// หลังตรวจแล้วต้องเรียก FailAttempt (ผิด), ReleaseAttempt (ถูกแต่ยังไม่จบการ login) หรือ ResetLoginFailures (สำเร็จ)
+func (p LoginPolicy) BeginAttempt(staff *models.Staff, ip string, now time.Time) (time.Duration, *models.LockoutEvent) {
+	if wait := p.StaffRetryAfter(*staff, now); wait > 0 {
+		return wait, nil
+	}
+
+	// ล็อกครั้งก่อนหมดเวลาแล้ว เริ่มนับใหม่
+	failures := staff.FailedLoginAttempts
+	if staff.LockedUntil != nil {
+		failures = 0
+	}
+	// ครบจำนวนแล้วแต่ยังไม่ถูกล็อก (ครั้งก่อนหน้ายังตรวจไม่เสร็จหรือ process หยุดไปก่อน) ถือว่าผิดทั้งหมด
+	if failures >= p.MaxFailures {
+		event := p.lock(staff, ip, now)
+		return staff.LockedUntil.Sub(now), event
+	}
+
+	staff.FailedLoginAttempts, staff.LastFailedLoginAt, staff.LockedUntil = failures+1, &now, nil
+	return 0, nil
+}
+
+// การลองที่จองไว้ด้วย BeginAttempt ผิด ถ้าครบ MaxFailures จะล็อกบัญชีและคืน LockoutEvent
+func (p LoginPolicy) FailAttempt(staff *models.Staff, ip string, now time.Time) *models.LockoutEvent {
+	if staff.FailedLoginAttempts < p.MaxFailures || staff.LockedAt(now) {
+		return nil
+	}
+	return p.lock(staff, ip, now)
+}
+
+// คืนการลองที่จองไว้ เมื่อสิ่งที่ตรวจถูกต้องแต่การ login ยังไม่จบ (เช่น รหัสผ่านถูกแต่ต้องยืนยัน MFA ต่อ)
+// ตัวนับที่เหลือยังใช้นับรวมกับการเดารหัส MFA
+func ReleaseAttempt(staff *models.Staff) {
+	if staff.FailedLoginAttempts > 0 {
+		staff.FailedLoginAttempts--
+	}
+}
+
+// ล็อกบัญชีเป็นเวลา LockoutDuration
+func (p LoginPolicy) lock(staff *models.Staff, ip string, now time.Time) *models.LockoutEvent {
+	lockedUntil := now.Add(p.LockoutDuration)
+	staff.LockedUntil = &lockedUntil
+	return &models.LockoutEvent{
+		StaffID:     staff.ID,
+		Username:    staff.Username,
+		Hospital:    staff.Hospital,
+		Event:       models.LockoutEventLocked,
+		Reason:      "too many failed login attempts",
+		IP:          ip,
+		LockedUntil: &lockedUntil,
+	}
+}
+
+// ล้างตัวนับการใส่ผิดเมื่อเข้าสู่ระบบสำเร็จ
+func ResetLoginFailures(staff *models.Staff) {
+	staff.FailedLoginAttempts, staff.LastFailedLoginAt, staff.LockedUntil = 0, nil, nil
+}
+
+// admin ปลดล็อกบัญชี คืน LockoutEvent ที่ต้องบันทึกคู่กัน
+func UnlockStaff(staff *models.Staff, actorID uint, ip string) *models.LockoutEvent {
+	ResetLoginFailures(staff)
+	return &models.LockoutEvent{
+		StaffID:  staff.ID,
+		Username: staff.Username,
+		Hospital: staff.Hospital,
+		Event:    models.LockoutEventUnlocked,
+		Reason:   "unlocked by admin",
+		IP:       ip,
+		ActorID:  &actorID,
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/models"
+)
+
+const (
+	recoveryCodeCount = 10
+	// ตัดตัวอักษรที่สับสนง่าย (i, l, o, 0, 1) ออก
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrMFANotEnrolled    = errors.New("mfa enrollment has not been started")
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+)
+
+// ตรวจว่า role นี้ถูกบังคับให้ใช้ MFA หรือไม่ (MFA_REQUIRED_ROLES คั่นด้วย comma, default "admin,system_admin")
+func MFARequiredForRole(role models.Role) bool {
+	for _, r := range config.Current().MFA.RequiredRoles {
+		if models.Role(strings.TrimSpace(r)) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// role ใน MFA_REQUIRED_ROLES ต้องเป็น role ที่ระบบรู้จัก ไม่งั้นพิมพ์ผิดแล้วจะไม่มีใครถูกบังคับใช้ MFA
+// (ตรวจที่นี่แทน config.Validate เพราะ package config ไม่รู้จัก role)
+func CheckMFARoles() error {
+	for _, r := range config.Current().MFA.RequiredRoles {
+		if !models.Role(strings.TrimSpace(r)).Valid() {
+			return fmt.Errorf("config: MFA_REQUIRED_ROLES: unknown role %q", r)
+		}
+	}
+	return nil
+}
+
+// ชื่อผู้ออกที่แสดงในแอป Authenticator (MFA_ISSUER, default "Agnos-HIS")
+func MFAIssuer() string {
+	return config.Current().MFA.Issuer
+}
+
+// รหัสกู้คืนเก็บเป็น SHA-256 ไม่สนตัวพิมพ์และขีดคั่น
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// สุ่มรหัสกู้คืนรูปแบบ xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, v := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(v)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// สร้างรหัสกู้คืนชุดใหม่ คืนรหัสจริง (แสดงให้ Staff เพียงครั้งเดียว) และ hash ที่บันทึกแทนชุดเดิม
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// เริ่มลงทะเบียน TOTP: ตั้ง secret ใหม่ให้ staff (แทนของเดิมที่ยังไม่ได้ยืนยัน) คืน secret และ provisioning URI
+// ฟังก์ชันในไฟล์นี้แก้ staff อย่างเดียว บันทึกด้วย repository.StaffRepository.UpdateMFA
+func BeginMFAEnrollment(staff *models.Staff) (string, string, error) {
+	if staff.MFAEnabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	staff.MFASecret, staff.MFALastUsedStep = &secret, 0
+
+	account := staff.Username + "@" + staff.Hospital
+	return secret, TOTPProvisioningURI(MFAIssuer(), account, secret), nil
+}
+
+// ยืนยันการลงทะเบียนด้วยรหัสจากแอป แล้วเปิดใช้ MFA (ผู้เรียกต้องออกรหัสกู้คืนชุดใหม่ด้วย NewRecoveryCodes)
+func ActivateMFA(staff *models.Staff, code string, now time.Time) error {
+	if staff.MFAEnabled {
+		return ErrMFAAlreadyEnabled
+	}
+	if staff.MFASecret == nil {
+		return ErrMFANotEnrolled
+	}
+
+	step, ok := VerifyTOTP(*staff.MFASecret, code, now, staff.MFALastUsedStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	staff.MFAEnabled, staff.MFALastUsedStep = true, step
+	return nil
+}
+
+// ตรวจรหัส TOTP ตอนเข้าสู่ระบบ และจำ step ที่ใช้แล้วไม่ให้ใช้ซ้ำ
+// (รหัสกู้คืนตรวจด้วย repository.StaffRepository.UseRecoveryCode)
+func VerifyMFACode(staff *models.Staff, code string, now time.Time) error {
+	if !staff.MFAEnabled || staff.MFASecret == nil {
+		return ErrMFANotEnrolled
+	}
+
+	step, ok := VerifyTOTP(*staff.MFASecret, code, now, staff.MFALastUsedStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	staff.MFALastUsedStep = step
+	return nil
+}
+
+// ล้าง MFA ของ staff (เช่น ทำโทรศัพท์หาย) Staff ต้องลงทะเบียนใหม่ ผู้เรียกต้องลบรหัสกู้คืนด้วย
+func ResetMFA(staff *models.Staff) {
+	staff.MFAEnabled, staff.MFASecret, staff.MFALastUsedStep = false, nil, 0
+}
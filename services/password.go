@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"HIS-api/config"
+	"HIS-api/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt ใช้แค่ 72 byte แรก ยาวกว่านี้จะ hash ไม่ได้
+const maxPasswordBytes = 72
+
+var (
+	ErrPasswordReused = errors.New("password was used recently")
+	ErrWrongPassword  = errors.New("current password is incorrect")
+)
+
+// นโยบายรหัสผ่าน
+//   - ยาวอย่างน้อย MinLength ตัวอักษร และมีตัวอักษรแต่ละประเภทตามที่กำหนด
+//   - ห้ามมี username อยู่ในรหัสผ่าน และห้ามอยู่ในรายการรหัสผ่านที่รั่วไหล (Breached)
+//   - ห้ามซ้ำกับรหัสผ่าน History ครั้งล่าสุด (รวมรหัสปัจจุบัน)
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	History       int
+	Breached      map[string]struct{}
+}
+
+// รหัสผ่านไม่ผ่านนโยบาย Reasons บอกทุกข้อที่ไม่ผ่าน
+type PasswordPolicyError struct {
+	Reasons []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// โหลดนโยบายจากการตั้งค่า (PASSWORD_* หรือ password: ใน YAML) พร้อมรายการรหัสผ่านที่รั่วไหล
+func LoadPasswordPolicy() (PasswordPolicy, error) {
+	cfg := config.Current().Password
+	breached, err := loadBreachedPasswords(cfg.BreachedList)
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	return PasswordPolicy{
+		MinLength:     cfg.MinLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		History:       cfg.History,
+		Breached:      breached,
+	}, nil
+}
+
+// รายการรหัสผ่านที่รั่วไหล โหลดใหม่เมื่อไฟล์ถูกแก้ไข
+var breachedCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	set     map[string]struct{}
+}
+
+func loadBreachedPasswords(path string) (map[string]struct{}, error) {
+	if path == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	breachedCache.Lock()
+	defer breachedCache.Unlock()
+	if breachedCache.path == path && breachedCache.modTime.Equal(info.ModTime()) {
+		return breachedCache.set, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	breachedCache.path, breachedCache.modTime, breachedCache.set = path, info.ModTime(), set
+	return set, nil
+}
+
+// ตรวจรหัสผ่านใหม่ตามนโยบาย (ไม่รวมการตรวจรหัสซ้ำ ซึ่งต้องใช้ประวัติรหัสผ่าน ดู HashNewPassword)
+func (p PasswordPolicy) Validate(password, username string) error {
+	var reasons []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		reasons = append(reasons, "must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	}
+	if len(password) > maxPasswordBytes {
+		reasons = append(reasons, "must be at most "+strconv.Itoa(maxPasswordBytes)+" bytes")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		reasons = append(reasons, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		reasons = append(reasons, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		reasons = append(reasons, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		reasons = append(reasons, "must contain a symbol")
+	}
+
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		reasons = append(reasons, "must not contain the username")
+	}
+	if _, ok := p.Breached[strings.ToLower(password)]; ok {
+		reasons = append(reasons, "is too common or has appeared in a data breach")
+	}
+
+	if reasons != nil {
+		return &PasswordPolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+// ตรวจว่ารหัสผ่านใหม่ซ้ำกับรหัสปัจจุบันหรือรหัสที่เคยใช้ล่าสุด (history เป็น hash ใหม่สุดก่อน) หรือไม่
+func (p PasswordPolicy) checkReuse(staff models.Staff, history []string, password string) error {
+	if bcrypt.CompareHashAndPassword([]byte(staff.Password), []byte(password)) == nil {
+		return ErrPasswordReused
+	}
+	if len(history) > p.History {
+		history = history[:max(p.History, 0)]
+	}
+	for _, h := range history {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// ตรวจรหัสผ่านใหม่ของ staff ตามนโยบายและการใช้ซ้ำ แล้วคืน hash ที่จะบันทึก
+// ใช้ใน fn ของ repository.StaffRepository.SetPassword และ ResetPassword
+func (p PasswordPolicy) HashNewPassword(staff models.Staff, history []string, password string) (string, error) {
+	if err := p.Validate(password, staff.Username); err != nil {
+		return "", err
+	}
+	if err := p.checkReuse(staff, history, password); err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+// Staff เปลี่ยนรหัสผ่านของตัวเอง ต้องยืนยันรหัสผ่านปัจจุบันก่อน แล้วคืน hash ของรหัสใหม่
+func (p PasswordPolicy) ChangePassword(staff models.Staff, history []string, current, next string) (string, error) {
+	if bcrypt.CompareHashAndPassword([]byte(staff.Password), []byte(current)) != nil {
+		return "", ErrWrongPassword
+	}
+	return p.HashNewPassword(staff, history, next)
+}
+
+// อายุของ token รีเซ็ตรหัสผ่าน (ตั้งได้ด้วย PASSWORD_RESET_TTL ค่า default 24 ชั่วโมง)
+func PasswordResetTTL() time.Duration {
+	return config.Current().Tokens.PasswordResetTTL
+}
+
+// token รีเซ็ตถูกเก็บเป็น SHA-256 ใช้ค้นหาตอน Staff ส่ง token กลับมา
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// การรีเซ็ตรหัสผ่านโดย admin บันทึกด้วย repository.StaffRepository.IssuePasswordReset
+//   - Token : ส่งให้ Staff ทางช่องทางอื่น (แสดงครั้งเดียว ไม่ถูกเก็บ)
+//   - Record : token ที่เก็บ (เฉพาะ hash) StaffID ตั้งโดย repository
+//   - UnusableHash : hash ของรหัสผ่านสุ่มที่ไม่มีใครรู้ ใช้แทนรหัสเดิมทันที
+type PasswordReset struct {
+	Token        string
+	Record       models.PasswordResetToken
+	UnusableHash string
+}
+
+// ออก token รีเซ็ตรหัสผ่านใช้ครั้งเดียว หมดอายุหลัง PasswordResetTTL
+func NewPasswordReset(actorID uint, now time.Time) (PasswordReset, error) {
+	token, err := randomToken()
+	if err != nil {
+		return PasswordReset{}, err
+	}
+	unusable, err := randomToken()
+	if err != nil {
+		return PasswordReset{}, err
+	}
+	unusableHash, err := bcrypt.GenerateFromPassword([]byte(unusable[:maxPasswordBytes/2]), bcrypt.DefaultCost)
+	if err != nil {
+		return PasswordReset{}, err
+	}
+
+	return PasswordReset{
+		Token: token,
+		Record: models.PasswordResetToken{
+			TokenHash: HashResetToken(token),
+			ExpiresAt: now.Add(PasswordResetTTL()),
+			CreatedBy: actorID,
+		},
+		UnusableHash: string(unusableHash),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"HIS-api/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// เตรียมบัญชี Staff ใหม่ (Username, Hospital, Role, MustChangePassword จาก staff) พร้อม hash รหัสผ่าน
+// รหัสผ่านต้องผ่านนโยบาย ใช้ร่วมกันทั้ง API และคำสั่ง CLI แล้วบันทึกด้วย repository.StaffRepository.Create
+func (p PasswordPolicy) NewStaff(staff models.Staff, password string) (models.Staff, error) {
+	if !staff.Role.Valid() {
+		return staff, ErrInvalidRole
+	}
+	if err := p.Validate(password, staff.Username); err != nil {
+		return staff, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return staff, err
+	}
+	staff.Password = string(hashedPassword)
+	return staff, nil
+}
+
+// admin ปิดบัญชีหรือเปลี่ยน role ของตัวเองไม่ได้ จึงมี admin เหลืออย่างน้อยหนึ่งคนเสมอ
+var ErrCannotModifySelf = errors.New("admins cannot deactivate or change the role of their own account")
+
+// การแก้ไขข้อมูล Staff โดย admin (nil = ไม่แก้)
+type StaffUpdate struct {
+	Username *string
+	Role     *models.Role
+}
+
+// ใช้การแก้ไขของ admin กับ staff (ยังไม่บันทึก ใช้ใน repository.StaffRepository.Update)
+func (u StaffUpdate) Apply(staff *models.Staff, actorID uint) error {
+	if u.Username != nil {
+		staff.Username = *u.Username
+	}
+	if u.Role != nil && *u.Role != staff.Role {
+		// admin ของโรงพยาบาลตั้งหรือถอด system_admin ไม่ได้
+		if !u.Role.Assignable() || !staff.Role.Assignable() {
+			return ErrInvalidRole
+		}
+		if staff.ID == actorID {
+			return ErrCannotModifySelf
+		}
+		staff.Role = *u.Role
+	}
+	return nil
+}
+
+// ปิดการใช้งานบัญชี Staff (ทำซ้ำได้ ไม่ error)
+func DeactivateStaff(staff *models.Staff, actorID uint, now time.Time) error {
+	if !staff.Active() {
+		return nil
+	}
+	if staff.ID == actorID {
+		return ErrCannotModifySelf
+	}
+	staff.DeactivatedAt, staff.DeactivatedBy = &now, &actorID
+	return nil
+}
+
+// เปิดการใช้งานบัญชีที่ถูกปิดไว้อีกครั้ง
+func ReactivateStaff(staff *models.Staff) {
+	staff.DeactivatedAt, staff.DeactivatedBy = nil, nil
+}
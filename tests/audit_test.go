@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"HIS-api/controllers"
+	"HIS-api/encryption"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/routes"
+	"HIS-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupAuditRouter(db *gorm.DB) *gin.Engine {
+	r := setupTestRouter(db)
+	routes.AuditRoutes(r, controllers.NewAuditHandler(repository.NewPostgresAuditLog(db)), repository.NewPostgresStaff(db))
+	return r
+}
+
+type auditListResponse struct {
+	Entries []struct {
+		Seq        uint64            `json:"seq"`
+		ActorID    uint              `json:"actor_id"`
+		Action     string            `json:"action"`
+		PatientIDs []uint            `json:"patient_ids"`
+		Query      map[string]string `json:"query"`
+		RequestID  string            `json:"request_id"`
+	} `json:"entries"`
+}
+
+// ตัวระบุถูก HMAC ด้วยกุญแจ ค่าเดิมได้ผลเดิม แต่กุญแจต่างกันได้ผลต่างกัน
+func TestHashIdentifier(t *testing.T) {
+	t.Setenv("AUDIT_HMAC_KEY", "key-one")
+	a, err := services.HashIdentifier("1234567890121")
+	require.NoError(t, err)
+	b, _ := services.HashIdentifier("1234567890121")
+	require.Equal(t, a, b)
+	require.NotContains(t, a, "1234567890121")
+
+	t.Setenv("AUDIT_HMAC_KEY", "key-two")
+	c, _ := services.HashIdentifier("1234567890121")
+	require.NotEqual(t, a, c)
+
+	t.Setenv("AUDIT_HMAC_KEY", "")
+	_, err = services.HashIdentifier("1234567890121")
+	require.ErrorIs(t, err, services.ErrAuditKeyMissing)
+}
+
+// chain ที่ต่อด้วย LinkAuditEntry ตรวจผ่าน ส่วนแถวที่ถูกแก้ ลบ หรือสลับลำดับตรวจพบที่แถวนั้น
+func TestAuditChainCheck(t *testing.T) {
+	t.Parallel()
+	var chain []models.AuditEntry
+	last := models.AuditEntry{}
+	for i := uint(1); i <= 3; i++ {
+		entry, err := services.NewAuditEntry(services.AuditRecord{Hospital: "HOSPITAL", ActorID: i, ActorRole: models.RoleDoctor, Action: models.AuditPatientView, PatientIDs: []uint{i}}, time.Now())
+		require.NoError(t, err)
+		last = services.LinkAuditEntry(entry, last)
+		chain = append(chain, last)
+	}
+
+	verify := func(entries ...models.AuditEntry) services.AuditVerification {
+		check := services.NewAuditChainCheck()
+		for _, e := range entries {
+			if !check.Check(e) {
+				break
+			}
+		}
+		return check.Result()
+	}
+
+	result := verify(chain...)
+	require.True(t, result.Valid)
+	require.Equal(t, int64(3), result.Checked)
+	require.Equal(t, chain[2].Hash, result.HeadHash)
+
+	tampered := chain[1]
+	tampered.PatientIDs = "[99]"
+	result = verify(chain[0], tampered, chain[2])
+	require.False(t, result.Valid)
+	require.Equal(t, uint64(2), *result.BrokenAt)
+
+	result = verify(chain[0], chain[2])
+	require.False(t, result.Valid)
+	require.Equal(t, uint64(3), *result.BrokenAt)
+}
+
+// การค้นหาผู้ป่วยถูกบันทึกพร้อมผู้ป่วยที่เห็น และ auditor ค้นด้วยเลขบัตรประชาชนได้
+func TestAudit_SearchRecorded(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAuditRouter(db)
+	token := getValidToken(db, "admin", "HOSPITAL")
+
+	requestID := fmt.Sprintf("audit-search-%d", time.Now().UnixNano())
+	w := performRequestWithHeader(router, "GET", "/patient/search?national_id=1234567890121", token, "X-Request-ID", requestID)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var patient models.Patient
+	require.NoError(t, db.Where("national_id_index = ? AND hospital = ?", encryption.BlindIndex("national_id", "1234567890121"), "HOSPITAL").First(&patient).Error)
+
+	auditorToken := getValidToken(db, "auditor", "HOSPITAL")
+	w = performRequest(router, "GET", "/audit?request_id="+requestID, nil, auditorToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response auditListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Entries, 1)
+	entry := response.Entries[0]
+	require.Equal(t, string(models.AuditPatientSearch), entry.Action)
+	require.Equal(t, []uint{patient.ID}, entry.PatientIDs)
+	require.NotContains(t, w.Body.String(), "1234567890121")
+
+	hashed, _ := services.HashIdentifier("1234567890121")
+	require.Equal(t, hashed, entry.Query["national_id"])
+
+	// auditor ส่งค่าจริงมา ระบบ HMAC ให้แล้วค้นหา
+	w = performRequest(router, "GET", "/audit?identifier="+url.QueryEscape("1234567890121")+"&request_id="+requestID, nil, auditorToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.Len(t, response.Entries, 1)
+
+	w = performRequest(router, "GET", fmt.Sprintf("/audit?patient_id=%d&request_id=%s", patient.ID, requestID), nil, auditorToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.Len(t, response.Entries, 1)
+}
+
+// การดู สร้าง และลบผู้ป่วยถูกบันทึก
+func TestAudit_PatientActionsRecorded(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAuditRouter(db)
+	token := getValidToken(db, "admin", "HOSPITAL")
+
+	var patient models.Patient
+	db.Where("hospital = ?", "HOSPITAL").First(&patient)
+
+	var before int64
+	db.Model(&models.AuditEntry{}).Where("hospital = ?", "HOSPITAL").Count(&before)
+
+	w := performRequest(router, "GET", fmt.Sprintf("/patient/%d", patient.ID), nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "DELETE", fmt.Sprintf("/patient/%d", patient.ID), nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entries []models.AuditEntry
+	db.Where("hospital = ?", "HOSPITAL").Order("seq DESC").Limit(2).Find(&entries)
+	require.Len(t, entries, 2)
+	require.Equal(t, models.AuditPatientDelete, entries[0].Action)
+	require.Equal(t, models.AuditPatientView, entries[1].Action)
+	require.Equal(t, fmt.Sprintf("[%d]", patient.ID), entries[0].PatientIDs)
+
+	// request ที่ไม่สำเร็จไม่ถูกบันทึก (transaction ถูก rollback)
+	w = performRequest(router, "GET", "/patient/999999999", nil, token)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	var after int64
+	db.Model(&models.AuditEntry{}).Where("hospital = ?", "HOSPITAL").Count(&after)
+	require.Equal(t, before+2, after)
+}
+
+// เฉพาะ auditor เท่านั้นที่ดู audit log ได้
+func TestAudit_AuditorOnly(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupAuditRouter(db)
+
+	w := performRequest(router, "GET", "/audit", nil, getValidToken(db, "admin", "HOSPITAL"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "GET", "/audit/verify", nil, getValidToken(db, "auditor", "HOSPITAL"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Verification services.AuditVerification `json:"verification"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.True(t, response.Verification.Valid, response.Verification.Reason)
+}
+
+// แก้ไขหรือลบแถวใน audit log ไม่ได้
+func TestAudit_AppendOnly(t *testing.T) {
+	db := setupTestDB(t)
+	hospital := fmt.Sprintf("AUDIT_%d", time.Now().UnixNano())
+	audit := repository.NewPostgresAuditLog(db)
+	err := audit.Record(context.Background(), services.AuditRecord{Hospital: hospital, ActorID: 1, ActorRole: models.RoleAdmin, Action: models.AuditPatientView})
+	require.NoError(t, err)
+
+	require.Error(t, db.Exec("UPDATE audit_entries SET actor_id = 2 WHERE hospital = ?", hospital).Error)
+	require.Error(t, db.Exec("DELETE FROM audit_entries WHERE hospital = ?", hospital).Error)
+}
+
+// ถ้าแถวใน chain ถูกแก้ (ข้าม trigger ด้วยสิทธิ์ owner) การตรวจ chain ต้องพบ
+func TestAudit_TamperDetected(t *testing.T) {
+	db := setupTestDB(t)
+	hospital := fmt.Sprintf("AUDIT_%d", time.Now().UnixNano())
+	audit := repository.NewPostgresAuditLog(db)
+	for i := uint(1); i <= 3; i++ {
+		err := audit.Record(context.Background(), services.AuditRecord{
+			Hospital:   hospital,
+			ActorID:    i,
+			ActorRole:  models.RoleDoctor,
+			Action:     models.AuditPatientView,
+			PatientIDs: []uint{i},
+		})
+		require.NoError(t, err)
+	}
+
+	result, err := audit.Verify(context.Background(), hospital)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.Equal(t, int64(3), result.Checked)
+	require.Equal(t, uint64(3), result.HeadSeq)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE audit_entries DISABLE TRIGGER audit_entries_no_modify").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE audit_entries SET patient_ids = '[99]' WHERE hospital = ? AND seq = 2", hospital).Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE audit_entries ENABLE TRIGGER audit_entries_no_modify").Error
+	})
+	require.NoError(t, err)
+
+	result, err = audit.Verify(context.Background(), hospital)
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, uint64(2), *result.BrokenAt)
+}
+
+// ทำ Request พร้อม header เพิ่มเติม
+func performRequestWithHeader(r http.Handler, method, path, token, key, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(key, value)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
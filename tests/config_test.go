@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"HIS-api/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ตั้งค่าที่จำเป็นให้ครบ (ล้างค่าที่อาจตั้งไว้จากเทสต์อื่นด้วย)
+func setRequiredConfigEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_USER", "his_app")
+	t.Setenv("DB_PASSWORD", "app_password")
+	t.Setenv("DB_NAME", "his_db")
+	t.Setenv("DB_PORT", "")
+	t.Setenv("DB_SSLMODE", "")
+	t.Setenv("ACCESS_TOKEN_TTL", "")
+	t.Setenv("ENCRYPTION_KEYRING", "/tmp/keyring.json")
+	t.Setenv("AUDIT_HMAC_KEY", "0123456789abcdef0123")
+}
+
+// ค่าที่ไม่ได้ตั้งต้องได้ค่า default
+func TestConfig_Defaults(t *testing.T) {
+	setRequiredConfigEnv(t)
+
+	cfg, err := config.Read()
+	require.NoError(t, err)
+	assert.Equal(t, 5432, cfg.Database.Port)
+	assert.Equal(t, "disable", cfg.Database.SSLMode)
+	assert.Equal(t, ":8080", cfg.Server.ListenAddr)
+	assert.Equal(t, 15*time.Minute, cfg.Tokens.AccessTTL)
+	assert.True(t, cfg.Server.MigrateOnStart)
+}
+
+// ค่าที่ขาดหรือผิดต้องถูกรายงานพร้อมกันทุกข้อ
+func TestConfig_ValidationFailsFast(t *testing.T) {
+	setRequiredConfigEnv(t)
+	t.Setenv("DB_HOST", "")
+	t.Setenv("DB_SSLMODE", "sometimes")
+	t.Setenv("AUDIT_HMAC_KEY", "short")
+
+	_, err := config.Read()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DB_HOST is required")
+	assert.Contains(t, err.Error(), "DB_SSLMODE")
+	assert.Contains(t, err.Error(), "AUDIT_HMAC_KEY must be at least")
+
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_SSLMODE", "")
+	t.Setenv("AUDIT_HMAC_KEY", "0123456789abcdef0123")
+	t.Setenv("DB_PORT", "five")
+	_, err = config.Read()
+	require.ErrorContains(t, err, "DB_PORT")
+}
+
+// YAML ทับค่า default และ environment variable ทับ YAML ชื่อฟิลด์ที่ไม่รู้จักถือว่าผิด
+func TestConfig_YAMLAndEnvPrecedence(t *testing.T) {
+	setRequiredConfigEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+database:
+  port: 6543
+  sslmode: require
+tokens:
+  access_ttl: 10m
+`), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_SSLMODE", "verify-full")
+
+	cfg, err := config.Read()
+	require.NoError(t, err)
+	assert.Equal(t, 6543, cfg.Database.Port)
+	assert.Equal(t, "verify-full", cfg.Database.SSLMode)
+	assert.Equal(t, 10*time.Minute, cfg.Tokens.AccessTTL)
+
+	require.NoError(t, os.WriteFile(path, []byte("database:\n  prot: 6543\n"), 0o600))
+	_, err = config.Read()
+	require.Error(t, err)
+}
+
+// นโยบาย login รหัสผ่าน MFA และจำนวนต่อหน้าผ่านการตรวจเหมือนค่าอื่น ค่าผิดต้องไม่ถูกแทนด้วย default เงียบๆ
+func TestConfig_PolicySettings(t *testing.T) {
+	setRequiredConfigEnv(t)
+	t.Setenv("PASSWORD_MIN_LENGTH", "abc")
+	t.Setenv("LOGIN_MAX_FAILURES", "0")
+	t.Setenv("AUDIT_LIST_MAX_LIMIT", "10")
+	t.Setenv("PASSWORD_BREACHED_LIST", filepath.Join(t.TempDir(), "missing.txt"))
+
+	_, err := config.Read()
+	require.ErrorContains(t, err, "PASSWORD_MIN_LENGTH")
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "4")
+	_, err = config.Read()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PASSWORD_MIN_LENGTH must be between")
+	assert.Contains(t, err.Error(), "LOGIN_MAX_FAILURES must be at least 1")
+	assert.Contains(t, err.Error(), "AUDIT_LIST_MAX_LIMIT")
+	assert.Contains(t, err.Error(), "PASSWORD_BREACHED_LIST")
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("LOGIN_MAX_FAILURES", "")
+	t.Setenv("AUDIT_LIST_MAX_LIMIT", "")
+	t.Setenv("PASSWORD_BREACHED_LIST", "")
+	cfg, err := config.Read()
+	require.NoError(t, err)
+	assert.Equal(t, 12, cfg.Password.MinLength)
+	assert.Equal(t, []string{"admin", "system_admin"}, cfg.MFA.RequiredRoles)
+
+	// ตั้งเป็นค่าว่างหมายถึงไม่บังคับ MFA กับ role ใดเลย
+	t.Setenv("MFA_REQUIRED_ROLES", "")
+	cfg, err = config.Read()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.MFA.RequiredRoles)
+}
+
+// ค่าลับต้องไม่ปรากฏใน log ตอนเริ่มระบบ
+func TestConfig_RedactedHidesSecrets(t *testing.T) {
+	setRequiredConfigEnv(t)
+
+	cfg, err := config.Read()
+	require.NoError(t, err)
+	dump := cfg.Redacted()
+	assert.Contains(t, dump, "DB_HOST=localhost")
+	assert.Contains(t, dump, "DB_PASSWORD=[redacted]")
+	assert.NotContains(t, dump, "app_password")
+	assert.NotContains(t, dump, "0123456789abcdef0123")
+}
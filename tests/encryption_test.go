@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"HIS-api/database"
+	"HIS-api/encryption"
+	"HIS-api/models"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestKeyring(t *testing.T) *encryption.Keyring {
+	keyring, created, err := encryption.LoadOrCreate(filepath.Join(t.TempDir(), "keyring.json"))
+	require.NoError(t, err)
+	require.True(t, created)
+	return keyring
+}
+
+// เข้ารหัสแล้วถอดกลับได้ และค่าเดิมเข้ารหัสสองครั้งได้ผลต่างกัน
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	keyring := newTestKeyring(t)
+
+	a, err := keyring.Encrypt("national_id", "1234567890121")
+	require.NoError(t, err)
+	b, _ := keyring.Encrypt("national_id", "1234567890121")
+	require.True(t, strings.HasPrefix(a, encryption.Prefix))
+	require.NotEqual(t, a, b)
+	require.NotContains(t, a, "1234567890121")
+
+	plaintext, err := keyring.Decrypt("national_id", a)
+	require.NoError(t, err)
+	require.Equal(t, "1234567890121", plaintext)
+
+	// ย้ายค่าไปคอลัมน์อื่นแล้วถอดไม่ได้
+	_, err = keyring.Decrypt("passport_id", a)
+	require.ErrorIs(t, err, encryption.ErrInvalidCiphertext)
+
+	// ข้อมูลเดิมที่ยังไม่เข้ารหัสคืนตามเดิม
+	plaintext, err = keyring.Decrypt("national_id", "1234567890121")
+	require.NoError(t, err)
+	require.Equal(t, "1234567890121", plaintext)
+}
+
+// หมุนกุญแจแล้วค่าเก่ายังถอดได้ และ rewrap ย้ายมาใช้กุญแจใหม่โดยข้อมูลไม่เปลี่ยน
+func TestKeyring_RotateAndRewrap(t *testing.T) {
+	keyring := newTestKeyring(t)
+	oldKID := keyring.Primary()
+	old, _ := keyring.Encrypt("email", "somchai@example.com")
+
+	newKID, err := keyring.Rotate()
+	require.NoError(t, err)
+	require.NotEqual(t, oldKID, newKID)
+
+	plaintext, err := keyring.Decrypt("email", old)
+	require.NoError(t, err)
+	require.Equal(t, "somchai@example.com", plaintext)
+
+	rewrapped, changed, err := keyring.Rewrap(old)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.True(t, strings.HasPrefix(rewrapped, encryption.Prefix+newKID+":"))
+	plaintext, _ = keyring.Decrypt("email", rewrapped)
+	require.Equal(t, "somchai@example.com", plaintext)
+
+	_, changed, _ = keyring.Rewrap(rewrapped)
+	require.False(t, changed)
+
+	// keyring ที่โหลดจากไฟล์เดียวกันต้องได้กุญแจใหม่ด้วย
+	reloaded, created, err := encryption.LoadOrCreate(keyring.Path)
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, newKID, reloaded.Primary())
+	plaintext, err = reloaded.Decrypt("email", old)
+	require.NoError(t, err)
+	require.Equal(t, "somchai@example.com", plaintext)
+}
+
+// server ที่รันอยู่ต้องเปลี่ยนไปเข้ารหัสด้วยกุญแจใหม่เมื่อคำสั่งหมุนกุญแจ (อีก process) เขียนไฟล์ keyring
+func TestKeyring_WatchPicksUpRotation(t *testing.T) {
+	rotator := newTestKeyring(t)
+	server, _, err := encryption.LoadOrCreate(rotator.Path)
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go server.Watch(10*time.Millisecond, stop)
+
+	newKID, err := rotator.Rotate()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return server.Primary() == newKID }, 5*time.Second, 10*time.Millisecond)
+
+	ciphertext, err := server.Encrypt("email", "somchai@example.com")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(ciphertext, encryption.Prefix+newKID+":"))
+}
+
+// blind index เท่ากันเมื่อค่าเท่ากัน และแยกตามคอลัมน์
+func TestKeyring_BlindIndex(t *testing.T) {
+	keyring := newTestKeyring(t)
+
+	require.Equal(t, keyring.BlindIndex("phone_number", "0812345678"), keyring.BlindIndex("phone_number", "0812345678"))
+	require.NotEqual(t, keyring.BlindIndex("phone_number", "0812345678"), keyring.BlindIndex("phone_number", "0812345679"))
+	require.NotEqual(t, keyring.BlindIndex("phone_number", "0812345678"), keyring.BlindIndex("national_id", "0812345678"))
+}
+
+// ค่าในฐานข้อมูลต้องเป็นข้อความเข้ารหัส แต่ gorm อ่านกลับมาเป็นค่าจริง
+func TestPatient_StoredEncrypted(t *testing.T) {
+	db := setupTestDB(t)
+
+	var raw struct {
+		NationalID  string
+		PhoneNumber string
+	}
+	err := database.WithoutRLS(db, func(tx *gorm.DB) error {
+		return tx.Table("patients").Select("national_id", "phone_number").
+			Where("national_id_index = ?", encryption.BlindIndex("national_id", "1234567890121")).
+			Take(&raw).Error
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(raw.NationalID, encryption.Prefix))
+	require.True(t, strings.HasPrefix(raw.PhoneNumber, encryption.Prefix))
+
+	patient := models.Patient{}
+	require.NoError(t, db.First(&patient, findPatientID(db, "1234567890121")).Error)
+	require.Equal(t, "1234567890121", *patient.NationalID)
+	require.Equal(t, "0812345678", patient.PhoneNumber)
+}
+
+// ข้อมูลเดิมที่เป็นข้อความปกติถูกเข้ารหัสตอน migrate และหมุนกุญแจแล้ว rewrap ได้
+func TestPatient_EncryptExistingAndRewrap(t *testing.T) {
+	db := setupTestDB(t)
+
+	dob, _ := time.Parse("2006-01-02", "1970-01-01")
+	err := database.WithoutRLS(db, func(tx *gorm.DB) error {
+		return tx.Exec(`INSERT INTO patients (created_at, updated_at, first_name_th, last_name_th, date_of_birth, national_id, phone_number, gender, hospital)
+			VALUES (NOW(), NOW(), 'ข้อมูล', 'เดิม', ?, '3100500123458', '0890000000', 'M', 'HOSPITAL')`, dob).Error
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, database.EncryptPatientIdentifiers(db, 1))
+
+	id := findPatientID(db, "3100500123458")
+	require.NotZero(t, id)
+	var patient models.Patient
+	require.NoError(t, db.First(&patient, id).Error)
+	require.Equal(t, "0890000000", patient.PhoneNumber)
+
+	keyring := encryption.Default()
+	_, err = keyring.Rotate()
+	require.NoError(t, err)
+	count, err := database.RewrapPatientIdentifiers(db, keyring, 2)
+	require.NoError(t, err)
+	require.NotZero(t, count)
+
+	var stale int64
+	db.Table("patients").Where("national_id NOT LIKE ?", encryption.Prefix+keyring.Primary()+":%").Count(&stale)
+	require.Zero(t, stale)
+
+	require.NoError(t, db.First(&patient, id).Error)
+	require.Equal(t, "3100500123458", *patient.NationalID)
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"HIS-api/database"
+	"HIS-api/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// รหัสผ่านของ Staff ที่สร้างจาก fixture ถ้าไม่ได้กำหนดเอง (ใช้กับ getValidToken)
+const fixturePassword = "password"
+
+// ลงทะเบียนโรงพยาบาล (ข้ามถ้ามีอยู่แล้ว) ชื่อไทยใช้รหัสแทนถ้าไม่ได้ระบุ
+func createHospital(t *testing.T, db *gorm.DB, code, name string) models.Hospital {
+	t.Helper()
+	if name == "" {
+		name = code
+	}
+	hospital := models.Hospital{Code: code, NameTH: name, NameEN: name}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&hospital).Error; err != nil {
+		t.Fatal("create hospital fixture:", err)
+	}
+	return hospital
+}
+
+// สร้าง Staff สำหรับเทสต์ ค่า default คือ admin ของ HOSPITAL รหัสผ่าน fixturePassword
+//
+//	aStaff("clerk").WithRole(models.RoleRegistrationClerk).Create(t, db)
+type staffFixture struct {
+	staff    models.Staff
+	password string
+}
+
+func aStaff(username string) *staffFixture {
+	return &staffFixture{
+		staff:    models.Staff{Username: username, Hospital: "HOSPITAL", Role: models.RoleAdmin},
+		password: fixturePassword,
+	}
+}
+
+func (f *staffFixture) InHospital(code string) *staffFixture {
+	f.staff.Hospital = code
+	return f
+}
+
+func (f *staffFixture) WithRole(role models.Role) *staffFixture {
+	f.staff.Role = role
+	return f
+}
+
+func (f *staffFixture) WithPassword(password string) *staffFixture {
+	f.password = password
+	return f
+}
+
+func (f *staffFixture) MustChangePassword() *staffFixture {
+	f.staff.MustChangePassword = true
+	return f
+}
+
+func (f *staffFixture) Deactivated() *staffFixture {
+	now := time.Now()
+	f.staff.DeactivatedAt = &now
+	return f
+}
+
+// บันทึกลงฐานข้อมูล (ลงทะเบียนโรงพยาบาลให้ถ้ายังไม่มี)
+func (f *staffFixture) Create(t *testing.T, db *gorm.DB) models.Staff {
+	t.Helper()
+	createHospital(t, db, f.staff.Hospital, "")
+
+	// ใช้ cost ต่ำสุดให้เทสต์เร็ว การตรวจรหัสผ่านอ่าน cost จาก hash เองจึงไม่ต่างกัน
+	hashed, err := bcrypt.GenerateFromPassword([]byte(f.password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("hash fixture password:", err)
+	}
+	staff := f.staff
+	staff.Password = string(hashed)
+	if err := db.Create(&staff).Error; err != nil {
+		t.Fatal("create staff fixture:", err)
+	}
+	return staff
+}
+
+// สร้างผู้ป่วยสำหรับเทสต์ ค่า default คือ "สมชาย สุขดี" ของ HOSPITAL ที่ไม่มีเลขประจำตัว
+//
+//	aPatient().WithNationalID("1234567890121").WithHN("HN001").Create(t, db)
+type patientFixture struct {
+	patient models.Patient
+}
+
+func aPatient() *patientFixture {
+	return &patientFixture{patient: models.Patient{
+		FirstNameTH: "สมชาย",
+		LastNameTH:  "สุขดี",
+		DateOfBirth: time.Date(1990, 5, 12, 0, 0, 0, 0, time.UTC),
+		PhoneNumber: "0812345678",
+		Gender:      "M",
+		Hospital:    "HOSPITAL",
+	}}
+}
+
+func (f *patientFixture) InHospital(code string) *patientFixture {
+	f.patient.Hospital = code
+	return f
+}
+
+func (f *patientFixture) Named(first, last string) *patientFixture {
+	f.patient.FirstNameTH, f.patient.LastNameTH = first, last
+	return f
+}
+
+func (f *patientFixture) WithHN(hn string) *patientFixture {
+	f.patient.PatientHN = &hn
+	return f
+}
+
+func (f *patientFixture) WithNationalID(id string) *patientFixture {
+	f.patient.NationalID = &id
+	return f
+}
+
+func (f *patientFixture) WithPassportID(id string) *patientFixture {
+	f.patient.PassportID = &id
+	return f
+}
+
+func (f *patientFixture) WithPhone(phone string) *patientFixture {
+	f.patient.PhoneNumber = phone
+	return f
+}
+
+func (f *patientFixture) WithEmail(email string) *patientFixture {
+	f.patient.Email = &email
+	return f
+}
+
+// บันทึกลงฐานข้อมูลโดยข้าม row-level security (ลงทะเบียนโรงพยาบาลให้ถ้ายังไม่มี)
+func (f *patientFixture) Create(t *testing.T, db *gorm.DB) models.Patient {
+	t.Helper()
+	createHospital(t, db, f.patient.Hospital, "")
+
+	patient := f.patient
+	err := database.WithoutRLS(db, func(tx *gorm.DB) error {
+		return tx.Create(&patient).Error
+	})
+	if err != nil {
+		t.Fatal("create patient fixture:", err)
+	}
+	return patient
+}
@@ -0,0 +1,626 @@
+package tests
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"HIS-api/controllers"
+	"HIS-api/middlewares"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/routes"
+	"HIS-api/services"
+	"HIS-api/tokens"
+	"HIS-api/validators"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// การทดสอบในไฟล์นี้ใช้ repository แบบ in-memory ไม่ต้องมีฐานข้อมูล และรันขนานกันได้
+
+var ginTestMode sync.Once
+
+// ออก access token จริงให้ Staff (ต้องอยู่ใน MemoryStaff ที่ router ใช้ เพื่อให้ผ่าน AuthMiddleware)
+// ไม่ผ่าน login เพราะ role อย่าง admin ต้องใช้ MFA ตอน login
+func memoryIssuedToken(t *testing.T, staff models.Staff) string {
+	token, _, err := tokens.IssueAccessToken(staff)
+	require.NoError(t, err)
+	return token
+}
+
+// เพิ่ม Staff ที่ใช้เรียก API ลงใน staff แล้วคืน access token ของ Staff นั้น
+func memoryActor(t *testing.T, staff *repository.MemoryStaff, hospital string, role models.Role) string {
+	actor := staff.Add(models.Staff{Username: strings.ToLower(hospital) + "_" + string(role), Hospital: hospital, Role: role})
+	return memoryIssuedToken(t, actor)
+}
+
+func newHermeticEngine() *gin.Engine {
+	ginTestMode.Do(func() { gin.SetMode(gin.TestMode) })
+	validators.Register()
+	return gin.New()
+}
+
+// router ของผู้ป่วยเหมือน routes.PatientRoutes (ยกเว้น transaction ของโรงพยาบาลซึ่งต้องใช้ Postgres)
+// แต่ใช้ repository ที่ส่งมา คืน access token ของ Staff ตาม hospital และ role ที่กำหนด
+func newMemoryPatientRouter(t *testing.T, patients *repository.MemoryPatients, audit *repository.MemoryAuditLog, hospital string, role models.Role) (*gin.Engine, string) {
+	staff := repository.NewMemoryStaff()
+	token := memoryActor(t, staff, hospital, role)
+	h := controllers.NewPatientHandler(patients, audit)
+	r := newHermeticEngine()
+	patient := r.Group("/patient", middlewares.AuthMiddleware(staff))
+	{
+		patient.POST("/create", middlewares.RequirePermission(models.PermPatientWrite), h.CreatePatient)
+		patient.GET("/search", middlewares.RequirePermission(models.PermPatientRead), h.SearchPatient)
+		patient.GET("/:id", middlewares.RequirePermission(models.PermPatientRead), h.GetPatient)
+		patient.PATCH("/:id", middlewares.RequirePermission(models.PermPatientWrite), h.PatchPatient)
+		patient.DELETE("/:id", middlewares.RequirePermission(models.PermPatientDelete), h.DeletePatient)
+	}
+	return r, token
+}
+
+func memoryPatient(hospital, firstName, lastName, nationalID string) models.Patient {
+	dob, _ := time.Parse("2006-01-02", "1990-05-20")
+	return models.Patient{
+		FirstNameTH: firstName,
+		LastNameTH:  lastName,
+		DateOfBirth: dob,
+		NationalID:  ptr(nationalID),
+		PhoneNumber: "0812345678",
+		Gender:      "M",
+		Hospital:    hospital,
+	}
+}
+
+// ลงทะเบียนผู้ป่วยแล้วได้ HN ดูข้อมูลได้แบบปิดบางส่วน และทุกการเข้าถึงถูกบันทึก
+func TestPatientHandler_CreateAndGet(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients()
+	audit := repository.NewMemoryAuditLog()
+	router, token := newMemoryPatientRouter(t, patients, audit, "HOSPITAL", models.RoleRegistrationClerk)
+
+	body, _ := json.Marshal(map[string]string{
+		"first_name_th": "สมศรี",
+		"last_name_th":  "ใจงาม",
+		"date_of_birth": "1985-01-15",
+		"national_id":   "1234567890121",
+		"phone_number":  "0898765432",
+		"gender":        "F",
+	})
+	w := performRequest(router, "POST", "/patient/create", body, token)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created struct {
+		Patient struct {
+			ID         uint
+			PatientHN  string
+			NationalID string
+		} `json:"patient"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Regexp(t, `^HN\d{2}-000001$`, created.Patient.PatientHN)
+	require.Equal(t, "1-2345-xxxxx-12-1", created.Patient.NationalID)
+
+	w = performRequest(router, "GET", fmt.Sprintf("/patient/%d", created.Patient.ID), nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "1234567890121")
+
+	records := audit.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, models.AuditPatientCreate, records[0].Action)
+	require.Equal(t, models.AuditPatientView, records[1].Action)
+	require.Equal(t, []uint{created.Patient.ID}, records[1].PatientIDs)
+	require.Equal(t, "HOSPITAL", records[1].Hospital)
+}
+
+// ค้นหาเห็นเฉพาะโรงพยาบาลของตัวเอง และแบ่งหน้าด้วย cursor ได้
+func TestPatientHandler_SearchScopedAndPaginated(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients(
+		memoryPatient("HOSPITAL", "ก", "สุขดี", "1234567890121"),
+		memoryPatient("HOSPITAL", "ข", "สุขดี", "3100500123458"),
+		memoryPatient("OTHER", "ค", "สุขดี", "1234567890121"),
+	)
+	router, token := newMemoryPatientRouter(t, patients, repository.NewMemoryAuditLog(), "HOSPITAL", models.RoleDoctor)
+
+	type searchResponse struct {
+		Patients []struct{ FirstNameTH, Hospital string } `json:"patients"`
+		Total    int64                                    `json:"total"`
+		HasMore  bool                                     `json:"has_more"`
+		Next     string                                   `json:"next"`
+	}
+
+	w := performRequest(router, "GET", "/patient/search?last_name=สุขดี&sort=name&limit=1", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var first searchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	require.Equal(t, int64(2), first.Total)
+	require.True(t, first.HasMore)
+	require.Equal(t, "ก", first.Patients[0].FirstNameTH)
+
+	w = performRequest(router, "GET", "/patient/search?last_name=สุขดี&limit=1&cursor="+first.Next, nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var second searchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	require.False(t, second.HasMore)
+	require.Len(t, second.Patients, 1)
+	require.Equal(t, "ข", second.Patients[0].FirstNameTH)
+	require.Equal(t, "HOSPITAL", second.Patients[0].Hospital)
+
+	w = performRequest(router, "GET", "/patient/search?last_name=สุขดี&cursor=broken", nil, token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "GET", "/patient/search?last_name=สุขดี", nil, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// cursor ถูกเข้ารหัส แกะ base64 แล้วไม่เห็นข้อมูลผู้ป่วย และแก้ไขแล้วใช้ไม่ได้
+func TestPatientHandler_CursorIsOpaque(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients(
+		memoryPatient("HOSPITAL", "สมหญิง", "ใจงาม", "1234567890121"),
+		memoryPatient("HOSPITAL", "สมศรี", "ใจงาม", "3100500123458"),
+	)
+	router, token := newMemoryPatientRouter(t, patients, repository.NewMemoryAuditLog(), "HOSPITAL", models.RoleDoctor)
+
+	w := performRequest(router, "GET", "/patient/search?last_name=ใจงาม&sort=name&limit=1", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Next string `json:"next"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.NotEmpty(t, page.Next)
+
+	decoded, err := base64.RawURLEncoding.DecodeString(page.Next)
+	require.NoError(t, err)
+	for _, value := range []string{"ใจงาม", "สมหญิง", "สมศรี", "name"} {
+		require.NotContains(t, string(decoded), value)
+	}
+	require.NotContains(t, string(decoded), `"v"`)
+
+	// cursor แบบเดิม (base64 ของ JSON) และ cursor ที่ถูกแก้ใช้ไม่ได้
+	plain := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","v":["ใจงาม","สมหญิง"],"id":1}`))
+	tampered := []byte(page.Next)
+	tampered[len(tampered)-2] ^= 1
+	for _, cursor := range []string{plain, string(tampered)} {
+		w = performRequest(router, "GET", "/patient/search?last_name=ใจงาม&sort=name&limit=1&cursor="+cursor, nil, token)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+// เลขบัตรประชาชนซ้ำในโรงพยาบาลเดียวกันบันทึกไม่ได้ แต่ซ้ำกับโรงพยาบาลอื่นได้
+func TestPatientHandler_DuplicateNationalID(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients(
+		memoryPatient("HOSPITAL", "ก", "สุขดี", "1234567890121"),
+		memoryPatient("HOSPITAL", "ข", "สุขดี", "3100500123458"),
+	)
+	router, token := newMemoryPatientRouter(t, patients, repository.NewMemoryAuditLog(), "HOSPITAL", models.RoleRegistrationClerk)
+
+	w := performRequest(router, "PATCH", "/patient/2", []byte(`{"national_id":"1234567890121"}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "national_id already exists")
+
+	other, otherToken := newMemoryPatientRouter(t, patients, repository.NewMemoryAuditLog(), "OTHER", models.RoleRegistrationClerk)
+	body, _ := json.Marshal(map[string]string{
+		"first_name_th": "ค",
+		"last_name_th":  "สุขดี",
+		"date_of_birth": "1990-05-20",
+		"national_id":   "1234567890121",
+		"phone_number":  "0812345678",
+		"gender":        "M",
+	})
+	w = performRequest(other, "POST", "/patient/create", body, otherToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+}
+
+// บันทึก audit log ไม่ได้ต้องไม่ส่งข้อมูลผู้ป่วยออกไป
+func TestPatientHandler_AuditFailure(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients(memoryPatient("HOSPITAL", "ก", "สุขดี", "1234567890121"))
+	audit := repository.NewMemoryAuditLog()
+	audit.Err = errors.New("audit log unavailable")
+	router, token := newMemoryPatientRouter(t, patients, audit, "HOSPITAL", models.RoleDoctor)
+
+	w := performRequest(router, "GET", "/patient/1", nil, token)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.NotContains(t, w.Body.String(), "สุขดี")
+}
+
+// ลบแล้วดูไม่ได้อีก และผู้ป่วยของโรงพยาบาลอื่นลบไม่ได้
+func TestPatientHandler_Delete(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients(
+		memoryPatient("HOSPITAL", "ก", "สุขดี", "1234567890121"),
+		memoryPatient("OTHER", "ข", "สุขดี", "3100500123458"),
+	)
+	router, token := newMemoryPatientRouter(t, patients, repository.NewMemoryAuditLog(), "HOSPITAL", models.RoleAdmin)
+
+	w := performRequest(router, "DELETE", "/patient/2", nil, token)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performRequest(router, "DELETE", "/patient/1", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "GET", "/patient/1", nil, token)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// admin แก้ role และปิดบัญชีคนอื่นได้ แต่ทำกับบัญชีตัวเองไม่ได้
+func TestStaffHandler_UpdateAndDeactivate(t *testing.T) {
+	t.Parallel()
+	admin := models.Staff{Model: gorm.Model{ID: 1}, Username: "admin", Hospital: "HOSPITAL", Role: models.RoleAdmin}
+	staff := repository.NewMemoryStaff(
+		admin,
+		models.Staff{Username: "clerk", Hospital: "HOSPITAL", Role: models.RoleRegistrationClerk},
+		models.Staff{Username: "other", Hospital: "OTHER", Role: models.RoleRegistrationClerk},
+	)
+	router := newMemoryAuthRouter(staff)
+	token := memoryIssuedToken(t, admin)
+
+	w := performRequest(router, "PATCH", "/staff/2", []byte(`{"role":"nurse"}`), token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"role":"nurse"`)
+
+	w = performRequest(router, "PATCH", "/staff/2", []byte(`{"username":"admin"}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	// system_admin มีสิทธิ์ข้ามโรงพยาบาล admin ของโรงพยาบาลตั้งให้ใครไม่ได้
+	w = performRequest(router, "PATCH", "/staff/2", []byte(`{"role":"system_admin"}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", "/staff/create", []byte(`{"username":"root","password":"Password1234","role":"system_admin"}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "PATCH", "/staff/1", []byte(`{"role":"nurse"}`), token)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "POST", "/staff/1/deactivate", nil, token)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "GET", "/staff/3", nil, token)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performRequest(router, "POST", "/staff/2/deactivate", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, staff.RevokedSessions(2))
+
+	w = performRequest(router, "GET", "/staff?status=inactive", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Staff []struct {
+			Username string `json:"username"`
+			Active   bool   `json:"active"`
+		} `json:"staff"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Staff, 1)
+	require.Equal(t, "clerk", list.Staff[0].Username)
+	require.False(t, list.Staff[0].Active)
+
+	w = performRequest(router, "POST", "/staff/2/reactivate", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"active":true`)
+}
+
+// router ของ Staff ทั้งหมดจาก routes.StaffRoutes (รวม middleware ตรวจ token จริง) บน repository ที่ส่งมา
+func newMemoryAuthRouter(staff *repository.MemoryStaff) *gin.Engine {
+	r := newHermeticEngine()
+	routes.StaffRoutes(r, controllers.NewStaffHandler(staff), controllers.NewAuthHandler(staff), staff)
+	return r
+}
+
+func memoryLoginStaff(t *testing.T, username, hospital, password string) models.Staff {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return models.Staff{Username: username, Hospital: hospital, Role: models.RoleNurse, Password: string(hashed)}
+}
+
+func loginBody(username, hospital, password string) []byte {
+	body, _ := json.Marshal(map[string]string{"username": username, "hospital": hospital, "password": password})
+	return body
+}
+
+// login สำเร็จได้ token และ refresh token ส่วนรหัสผ่านผิดตอบเหมือน username ที่ไม่มีอยู่ทุกประการ
+func TestAuthHandler_Login(t *testing.T) {
+	t.Parallel()
+	staff := repository.NewMemoryStaff(memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234"))
+	router := newMemoryAuthRouter(staff)
+
+	w := performRequest(router, "POST", "/staff/login", loginBody("nurse", "Hospital", "Password1234"), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var session struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	require.NotEmpty(t, session.Token)
+	require.NotEmpty(t, session.RefreshToken)
+	require.NotContains(t, w.Body.String(), "$2a$")
+
+	wrong := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Wrong1234567"), "")
+	unknown := performRequest(router, "POST", "/staff/login", loginBody("ghost", "HOSPITAL", "Wrong1234567"), "")
+	require.Equal(t, http.StatusUnauthorized, wrong.Code)
+	require.Equal(t, wrong.Code, unknown.Code)
+	require.Equal(t, wrong.Body.String(), unknown.Body.String())
+
+	attempts := staff.LoginAttempts()
+	require.Len(t, attempts, 3)
+	require.True(t, attempts[0].Success)
+	require.False(t, attempts[1].Success)
+}
+
+// ใส่รหัสผ่านผิดครบ LOGIN_MAX_FAILURES แล้วบัญชีถูกล็อก รหัสผ่านที่ถูกก็เข้าไม่ได้จนกว่าจะหมดเวลา
+func TestAuthHandler_LockoutAfterMaxFailures(t *testing.T) {
+	t.Setenv("LOGIN_FREE_FAILURES", "3")
+	t.Setenv("LOGIN_MAX_FAILURES", "3")
+	staff := repository.NewMemoryStaff(memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234"))
+	router := newMemoryAuthRouter(staff)
+
+	for i := 0; i < 3; i++ {
+		w := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Wrong1234567"), "")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	w := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Password1234"), "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	events, err := staff.LockoutEvents(context.Background(), "HOSPITAL", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	locked, err := staff.FindByID(context.Background(), 1)
+	require.NoError(t, err)
+	require.NotNil(t, locked.LockedUntil)
+}
+
+// บัญชีที่ถูกปิดใช้งานตอบเหมือนรหัสผ่านผิดทุกประการ ไม่บอกว่าบัญชีมีอยู่และถูกปิด
+func TestAuthHandler_DeactivatedAccount(t *testing.T) {
+	t.Parallel()
+	nurse := memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234")
+	now := time.Now()
+	nurse.DeactivatedAt = &now
+	router := newMemoryAuthRouter(repository.NewMemoryStaff(nurse))
+
+	deactivated := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Password1234"), "")
+	unknown := performRequest(router, "POST", "/staff/login", loginBody("ghost", "HOSPITAL", "Password1234"), "")
+	require.Equal(t, http.StatusUnauthorized, deactivated.Code)
+	require.Equal(t, unknown.Body.String(), deactivated.Body.String())
+}
+
+// Staff ของโรงพยาบาลที่ถูกระงับ login ไม่ได้ แม้รหัสผ่านจะถูก
+func TestAuthHandler_SuspendedHospital(t *testing.T) {
+	t.Parallel()
+	staff := repository.NewMemoryStaff(memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234"))
+	staff.SuspendHospital("HOSPITAL")
+	router := newMemoryAuthRouter(staff)
+
+	w := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Password1234"), "")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "Hospital is not active")
+}
+
+// refresh token ใช้ได้ครั้งเดียว ถ้าใช้ซ้ำทั้ง family ถูก revoke รวมถึงตัวที่ออกใหม่ด้วย
+func TestAuthHandler_RefreshRotationAndReuse(t *testing.T) {
+	t.Parallel()
+	staff := repository.NewMemoryStaff(memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234"))
+	router := newMemoryAuthRouter(staff)
+
+	refresh := func(token string) (int, string) {
+		body, _ := json.Marshal(map[string]string{"refresh_token": token})
+		w := performRequest(router, "POST", "/staff/refresh", body, "")
+		var response struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.RefreshToken
+	}
+
+	w := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Password1234"), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var session struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+
+	code, rotated := refresh(session.RefreshToken)
+	require.Equal(t, http.StatusOK, code)
+	require.NotEqual(t, session.RefreshToken, rotated)
+
+	code, _ = refresh(session.RefreshToken)
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh(rotated)
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh("not-a-token")
+	require.Equal(t, http.StatusUnauthorized, code)
+}
+
+// login ด้วยรหัสผ่านแล้วคืน access token
+func memoryAccessToken(t *testing.T, router *gin.Engine, username, hospital, password string) string {
+	w := performRequest(router, "POST", "/staff/login", loginBody(username, hospital, password), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	token, _ := decodeBody(t, w.Body.Bytes())["token"].(string)
+	require.NotEmpty(t, token)
+	return token
+}
+
+// เปลี่ยนรหัสผ่านแล้ว token เดิมใช้ไม่ได้ รหัสที่เคยใช้ตั้งซ้ำไม่ได้ และ admin รีเซ็ตรหัสผ่านด้วย token ใช้ครั้งเดียว
+func TestAuthHandler_PasswordChangeAndReset(t *testing.T) {
+	t.Parallel()
+	admin := models.Staff{Model: gorm.Model{ID: 1}, Username: "admin", Hospital: "HOSPITAL", Role: models.RoleAdmin}
+	other := models.Staff{Model: gorm.Model{ID: 3}, Username: "other", Hospital: "OTHER", Role: models.RoleAdmin}
+	staff := repository.NewMemoryStaff(admin, memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234"), other)
+	router := newMemoryAuthRouter(staff)
+	adminToken, otherToken := memoryIssuedToken(t, admin), memoryIssuedToken(t, other)
+
+	change := func(token, current, next string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"current_password": current, "new_password": next})
+		return performRequest(router, "POST", "/staff/password", body, token)
+	}
+	token := memoryAccessToken(t, router, "nurse", "HOSPITAL", "Password1234")
+	require.Equal(t, http.StatusUnauthorized, change(token, "wrong", "New-Passw0rd-1").Code)
+	require.Equal(t, http.StatusBadRequest, change(token, "Password1234", "weak").Code)
+
+	w := change(token, "Password1234", "New-Passw0rd-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	next, _ := decodeBody(t, w.Body.Bytes())["token"].(string)
+	require.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", "/staff/logout", nil, token).Code)
+
+	w = change(next, "New-Passw0rd-1", "Password1234")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "used recently")
+
+	require.Equal(t, http.StatusNotFound, performRequest(router, "POST", "/staff/2/password/reset", nil, otherToken).Code)
+
+	w = performRequest(router, "POST", "/staff/2/password/reset", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	resetToken, _ := decodeBody(t, w.Body.Bytes())["reset_token"].(string)
+	require.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "New-Passw0rd-1"), "").Code)
+	require.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", "/staff/logout", nil, next).Code)
+
+	reset, _ := json.Marshal(map[string]string{"reset_token": resetToken, "new_password": "Reset-Passw0rd"})
+	require.Equal(t, http.StatusOK, performRequest(router, "POST", "/staff/password/reset", reset, "").Code)
+	require.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", "/staff/password/reset", reset, "").Code)
+	memoryAccessToken(t, router, "nurse", "HOSPITAL", "Reset-Passw0rd")
+}
+
+// ลงทะเบียน MFA แล้ว login ต้องยืนยันรหัส รหัสกู้คืนใช้ได้ครั้งเดียว และ admin ล้าง MFA ได้เฉพาะ Staff ในโรงพยาบาลตัวเอง
+func TestAuthHandler_MFAEnrollLoginAndReset(t *testing.T) {
+	t.Parallel()
+	admin := models.Staff{Model: gorm.Model{ID: 1}, Username: "admin", Hospital: "HOSPITAL", Role: models.RoleAdmin}
+	other := models.Staff{Model: gorm.Model{ID: 3}, Username: "other", Hospital: "OTHER", Role: models.RoleAdmin}
+	staff := repository.NewMemoryStaff(admin, memoryLoginStaff(t, "nurse", "HOSPITAL", "Password1234"), other)
+	router := newMemoryAuthRouter(staff)
+	adminToken, otherToken := memoryIssuedToken(t, admin), memoryIssuedToken(t, other)
+
+	token := memoryAccessToken(t, router, "nurse", "HOSPITAL", "Password1234")
+	w := performRequest(router, "POST", "/staff/mfa/enroll", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	secret, _ := decodeBody(t, w.Body.Bytes())["secret"].(string)
+
+	require.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", "/staff/mfa/activate", []byte(`{"code":"000000"}`), token).Code)
+	code, err := services.TOTPCode(secret, services.TOTPStep(time.Now()))
+	require.NoError(t, err)
+	activate, _ := json.Marshal(map[string]string{"code": code})
+	w = performRequest(router, "POST", "/staff/mfa/activate", activate, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	codes, _ := decodeBody(t, w.Body.Bytes())["recovery_codes"].([]interface{})
+	require.Len(t, codes, 10)
+	require.Equal(t, http.StatusConflict, performRequest(router, "POST", "/staff/mfa/enroll", nil, token).Code)
+
+	mfaToken := func() string {
+		w := performRequest(router, "POST", "/staff/login", loginBody("nurse", "HOSPITAL", "Password1234"), "")
+		require.Equal(t, http.StatusOK, w.Code)
+		response := decodeBody(t, w.Body.Bytes())
+		require.Equal(t, true, response["mfa_required"])
+		return response["mfa_token"].(string)
+	}
+	recovery, _ := json.Marshal(map[string]string{"mfa_token": mfaToken(), "recovery_code": codes[0].(string)})
+	w = performRequest(router, "POST", "/staff/login/mfa", recovery, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEmpty(t, decodeBody(t, w.Body.Bytes())["token"])
+	recovery, _ = json.Marshal(map[string]string{"mfa_token": mfaToken(), "recovery_code": codes[0].(string)})
+	require.Equal(t, http.StatusUnauthorized, performRequest(router, "POST", "/staff/login/mfa", recovery, "").Code)
+
+	require.Equal(t, http.StatusNotFound, performRequest(router, "POST", "/staff/2/mfa/reset", nil, otherToken).Code)
+	require.Equal(t, http.StatusOK, performRequest(router, "POST", "/staff/2/mfa/reset", nil, adminToken).Code)
+	memoryAccessToken(t, router, "nurse", "HOSPITAL", "Password1234")
+}
+
+// router ของโรงพยาบาลเหมือน routes.HospitalRoutes (ยกเว้น transaction ของโรงพยาบาล) คืน access token ของ admin
+func newMemoryHospitalRouter(t *testing.T, hospitals *repository.MemoryHospitals) (*gin.Engine, string) {
+	staff := repository.NewMemoryStaff()
+	token := memoryActor(t, staff, "HOSPITAL", models.RoleAdmin)
+	h := controllers.NewHospitalHandler(hospitals)
+	r := newHermeticEngine()
+	hospital := r.Group("/hospital", middlewares.AuthMiddleware(staff), middlewares.RequirePermission(models.PermStaffManage))
+	{
+		hospital.GET("", h.GetHospital)
+		hospital.PATCH("", h.UpdateHospital)
+		hospital.GET("/hn-format", h.GetHNFormat)
+		hospital.PUT("/hn-format", h.UpdateHNFormat)
+	}
+	return r, token
+}
+
+// admin แก้ข้อมูลโรงพยาบาลตัวเองได้ แต่ใช้ hcode ซ้ำกับแห่งอื่นไม่ได้ และรูปแบบ HN ที่ไม่ผ่านการตรวจไม่ถูกบันทึก
+func TestHospitalHandler_UpdateAndHNFormat(t *testing.T) {
+	t.Parallel()
+	hospitals := repository.NewMemoryHospitals(
+		models.Hospital{Code: "HOSPITAL", NameTH: "โรงพยาบาลทดสอบ"},
+		models.Hospital{Code: "OTHER", NameTH: "โรงพยาบาลอื่น", HCode: ptr("10661")},
+	)
+	router, token := newMemoryHospitalRouter(t, hospitals)
+
+	w := performRequest(router, "PATCH", "/hospital", []byte(`{"name_en":"Test Hospital","hcode":"10662"}`), token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"hcode":"10662"`)
+	w = performRequest(router, "PATCH", "/hospital", []byte(`{"hcode":"10661"}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "GET", "/hospital", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"hcode":"10662"`)
+
+	w = performRequest(router, "GET", "/hospital/hn-format", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"prefix":"HN"`)
+	w = performRequest(router, "PUT", "/hospital/hn-format", []byte(`{"prefix":"hn","year_digits":3,"number_digits":6}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "PUT", "/hospital/hn-format", []byte(`{"prefix":"P","year_digits":0,"separator":"","number_digits":7}`), token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"example":"P0000001"`)
+	w = performRequest(router, "GET", "/hospital/hn-format", nil, token)
+	require.Contains(t, w.Body.String(), `"prefix":"P"`)
+}
+
+// auditor ค้น audit log ด้วยเลขบัตรประชาชนได้ (เก็บเป็น HMAC) และ chain ของโรงพยาบาลตรวจผ่าน
+func TestAuditHandler_ListAndVerify(t *testing.T) {
+	t.Parallel()
+	audit := repository.NewMemoryAuditLog()
+	ctx := context.Background()
+	require.NoError(t, audit.Record(ctx, services.AuditRecord{Hospital: "HOSPITAL", ActorID: 1, ActorRole: models.RoleDoctor, Action: models.AuditPatientSearch, PatientIDs: []uint{7}, Query: map[string]string{"national_id": "1234567890121"}}))
+	require.NoError(t, audit.Record(ctx, services.AuditRecord{Hospital: "HOSPITAL", ActorID: 2, ActorRole: models.RoleNurse, Action: models.AuditPatientView, PatientIDs: []uint{8}}))
+	require.NoError(t, audit.Record(ctx, services.AuditRecord{Hospital: "OTHER", ActorID: 3, ActorRole: models.RoleNurse, Action: models.AuditPatientView, PatientIDs: []uint{7}}))
+
+	h := controllers.NewAuditHandler(audit)
+	staff := repository.NewMemoryStaff()
+	token := memoryActor(t, staff, "HOSPITAL", models.RoleAuditor)
+	router := newHermeticEngine()
+	routes.AuditRoutes(router, h, staff)
+
+	var list struct {
+		Entries []struct {
+			Seq     uint64 `json:"seq"`
+			ActorID uint   `json:"actor_id"`
+		} `json:"entries"`
+		Total int64 `json:"total"`
+	}
+	w := performRequest(router, "GET", "/audit", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Entries, 2)
+	require.Equal(t, uint64(2), list.Entries[0].Seq)
+	require.NotContains(t, w.Body.String(), "1234567890121")
+
+	w = performRequest(router, "GET", "/audit?identifier=1234567890121", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Entries, 1)
+	require.Equal(t, uint(1), list.Entries[0].ActorID)
+
+	w = performRequest(router, "GET", "/audit?patient_id=7", nil, token)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Entries, 1)
+
+	w = performRequest(router, "GET", "/audit/verify", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var verify struct {
+		Verification services.AuditVerification `json:"verification"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &verify))
+	require.True(t, verify.Verification.Valid)
+	require.Equal(t, int64(2), verify.Verification.Checked)
+}
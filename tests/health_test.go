@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"HIS-api/controllers"
+	"HIS-api/routes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newHealthRouter(db *gorm.DB) (*gin.Engine, *controllers.HealthHandler) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := controllers.NewHealthHandler(db)
+	routes.HealthRoutes(r, h)
+	return r, h
+}
+
+// liveness ไม่ขึ้นกับฐานข้อมูล ส่วน readiness ตอบ 503 ทันทีเมื่อเริ่มปิดระบบ
+func TestHealth_LivenessAndDrain(t *testing.T) {
+	t.Parallel()
+	r, h := newHealthRouter(nil)
+
+	w := performRequest(r, "GET", "/healthz", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(r, "GET", "/readyz", nil, "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	h.Drain()
+	w = performRequest(r, "GET", "/readyz", nil, "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "draining")
+	w = performRequest(r, "GET", "/healthz", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// readiness พร้อมเมื่อ migration ครบ และไม่พร้อมเมื่อยังมี migration ค้าง
+func TestHealth_ReadinessChecksSchemaVersion(t *testing.T) {
+	t.Parallel()
+	db := newTestDB(t)
+	r, _ := newHealthRouter(db)
+
+	w := performRequest(r, "GET", "/readyz", nil, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.NoError(t, db.Exec("DELETE FROM schema_migrations WHERE version = (SELECT MAX(version) FROM schema_migrations)").Error)
+	w = performRequest(r, "GET", "/readyz", nil, "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "pending")
+}
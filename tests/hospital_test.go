@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"HIS-api/controllers"
+	"HIS-api/database"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/routes"
+	"HIS-api/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ทดสอบการแปลงชื่อโรงพยาบาลเป็นรหัสมาตรฐาน
+func TestNormalizeHospitalCode(t *testing.T) {
+	assert.Equal(t, "HOSPITAL_A", models.NormalizeHospitalCode("Hospital A"))
+	assert.Equal(t, "HOSPITAL_A", models.NormalizeHospitalCode("  hospital   a "))
+	assert.Equal(t, "HOSPITAL_A", models.NormalizeHospitalCode("HOSPITAL_A"))
+	assert.Equal(t, "โรงพยาบาลศิริราช", models.NormalizeHospitalCode("โรงพยาบาลศิริราช"))
+	assert.Equal(t, "", models.NormalizeHospitalCode(" - "))
+}
+
+// ทดสอบ migration แปลงชื่อโรงพยาบาลแบบข้อความเดิมที่พิมพ์ต่างกันให้เป็นโรงพยาบาลเดียว
+func TestMigrateHospitalStrings(t *testing.T) {
+	db := setupTestDB(t)
+
+	// จำลองข้อมูลเก่าก่อนมี foreign key
+	db.Exec("ALTER TABLE staffs DROP CONSTRAINT IF EXISTS fk_staffs_hospital_ref")
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	for _, s := range []models.Staff{
+		{Username: "legacy1", Hospital: "Hospital A"},
+		{Username: "legacy2", Hospital: "hospital a"},
+	} {
+		s.Password = string(hashed)
+		require.NoError(t, db.Create(&s).Error)
+	}
+
+	require.NoError(t, database.MigrateHospitalStrings(db))
+	// สร้าง foreign key คืนแบบเดียวกับ migrations/0003_hospital_foreign_keys.up.sql
+	require.NoError(t, db.Exec(`ALTER TABLE staffs ADD CONSTRAINT fk_staffs_hospital_ref
+		FOREIGN KEY (hospital) REFERENCES hospitals (code) ON UPDATE CASCADE ON DELETE RESTRICT`).Error)
+
+	var hospitals []string
+	db.Model(&models.Staff{}).Where("username LIKE ?", "legacy%").Distinct("hospital").Pluck("hospital", &hospitals)
+	assert.Equal(t, []string{"HOSPITAL_A"}, hospitals)
+
+	var hospital models.Hospital
+	require.NoError(t, db.First(&hospital, "code = ?", "HOSPITAL_A").Error)
+	assert.True(t, hospital.Active())
+}
+
+// ทดสอบดูและแก้ข้อมูลโรงพยาบาลของตัวเอง และการระงับโรงพยาบาลมีผลกับ token ทันที
+func TestHospitalEndpoints(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	routes.HospitalRoutes(router, controllers.NewHospitalHandler(repository.NewPostgresHospitals(db)), repository.NewPostgresStaff(db), db)
+	adminToken := getValidToken(db, "admin", "hospital")
+	clerkToken := getValidToken(db, "clerk", "Hospital")
+
+	w := performRequest(router, "GET", "/hospital", nil, clerkToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"HOSPITAL"`)
+
+	payload, _ := json.Marshal(map[string]string{"hcode": "12345"})
+	w = performRequest(router, "PATCH", "/hospital", payload, clerkToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "PATCH", "/hospital", payload, adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	payload, _ = json.Marshal(map[string]string{"hcode": "12AB"})
+	w = performRequest(router, "PATCH", "/hospital", payload, adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	db.Model(&models.Hospital{}).Where("code = ?", "HOSPITAL").Update("status", models.HospitalSuspended)
+	w = performRequest(router, "GET", "/hospital", nil, clerkToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, http.StatusForbidden, loginStatus(router, "clerk", "password"))
+	db.Model(&models.Hospital{}).Where("code = ?", "HOSPITAL").Updates(map[string]interface{}{"status": models.HospitalActive, "h_code": nil})
+}
+
+// ทดสอบ migration หยุดพร้อมรายงานเมื่อรวมชื่อโรงพยาบาลแล้วข้อมูลผู้ป่วยชนกัน และไม่แปลงข้อมูลใดเลย
+func TestMigrateHospitalStrings_Clash(t *testing.T) {
+	db := setupTestDB(t)
+	first := aPatient().InHospital("Hospital B").WithHN("HN001").WithNationalID("1234567890121").Create(t, db)
+	second := aPatient().InHospital("hospital b").WithHN("HN001").Create(t, db)
+	third := aPatient().InHospital("hospital b").WithHN("HN002").WithNationalID("1234567890121").Create(t, db)
+
+	err := database.MigrateHospitalStrings(db)
+	var clash *database.HospitalClashError
+	require.ErrorAs(t, err, &clash)
+	require.Len(t, clash.Clashes, 2)
+	assert.Contains(t, clash.Clashes[0], fmt.Sprintf("patients %d, %d share the same patient_hn", first.ID, second.ID))
+	assert.Contains(t, clash.Clashes[1], fmt.Sprintf("patients %d, %d share the same national_id", first.ID, third.ID))
+	assert.NotContains(t, err.Error(), "1234567890121")
+
+	var converted int64
+	require.NoError(t, database.WithoutRLS(db, func(tx *gorm.DB) error {
+		return tx.Model(&models.Patient{}).Where("hospital = ?", "HOSPITAL_B").Count(&converted).Error
+	}))
+	assert.Zero(t, converted)
+}
+
+// ทดสอบ system_admin ลงทะเบียน ดู และระงับโรงพยาบาล ส่วน admin ของโรงพยาบาลใช้ไม่ได้
+func TestHospitalRegistryEndpoints(t *testing.T) {
+	db := setupTestDB(t)
+	aStaff("root").InHospital("PLATFORM").WithRole(models.RoleSystemAdmin).Create(t, db)
+	router := setupStaffRouter(db)
+	routes.HospitalRoutes(router, controllers.NewHospitalHandler(repository.NewPostgresHospitals(db)), repository.NewPostgresStaff(db), db)
+	rootToken := getValidToken(db, "root", "platform")
+	adminToken := getValidToken(db, "admin", "Hospital")
+
+	w := performRequest(router, "GET", "/hospitals", nil, adminToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	payload := []byte(`{"code":"Hospital C","name_th":"โรงพยาบาลซี","hcode":"54321"}`)
+	w = performRequest(router, "POST", "/hospitals", payload, adminToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "POST", "/hospitals", payload, rootToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"HOSPITAL_C"`)
+	w = performRequest(router, "POST", "/hospitals", payload, rootToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performRequest(router, "PATCH", "/hospitals/hospital_c/status", []byte(`{"status":"suspended"}`), rootToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = performRequest(router, "PATCH", "/hospitals/PLATFORM/status", []byte(`{"status":"suspended"}`), rootToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "PATCH", "/hospitals/NOWHERE/status", []byte(`{"status":"active"}`), rootToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performRequest(router, "GET", "/hospitals?status=suspended", nil, rootToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Hospitals []models.Hospital `json:"hospitals"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Hospitals, 1)
+	assert.Equal(t, "HOSPITAL_C", list.Hospitals[0].Code)
+}
+
+// ทดสอบ admin ดูและตั้งรูปแบบ HN ของโรงพยาบาลตัวเอง ผู้ป่วยที่ลงทะเบียนหลังจากนั้นได้ HN ตามรูปแบบใหม่
+func TestHNFormatEndpoints(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTestRouter(db)
+	routes.HospitalRoutes(router, controllers.NewHospitalHandler(repository.NewPostgresHospitals(db)), repository.NewPostgresStaff(db), db)
+	adminToken := getValidToken(db, "admin", "Hospital")
+	clerkToken := getValidToken(db, "clerk", "Hospital")
+
+	w := performRequest(router, "GET", "/hospital/hn-format", nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"prefix":"HN"`)
+	w = performRequest(router, "GET", "/hospital/hn-format", nil, clerkToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	payload := []byte(`{"prefix":"HN68","year_digits":2,"separator":"","number_digits":6}`)
+	w = performRequest(router, "PUT", "/hospital/hn-format", payload, adminToken)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "reasons")
+	w = performRequest(router, "PUT", "/hospital/hn-format", []byte(`{"prefix":"A"}`), adminToken)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	payload = []byte(`{"prefix":"A","year_digits":4,"separator":"/","number_digits":5}`)
+	w = performRequest(router, "PUT", "/hospital/hn-format", payload, clerkToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = performRequest(router, "PUT", "/hospital/hn-format", payload, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	patient, _ := json.Marshal(map[string]string{
+		"first_name_th": "สมหญิง",
+		"last_name_th":  "ใจดี",
+		"date_of_birth": "1985-01-20",
+		"phone_number":  "0898765432",
+		"gender":        "F",
+	})
+	w = performRequest(router, "POST", "/patient/create", patient, adminToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	expectedHN := fmt.Sprintf("A%d/00001", services.BuddhistYear(time.Now()))
+	assert.Contains(t, w.Body.String(), expectedHN)
+
+	// รูปแบบของโรงพยาบาลอื่นไม่เปลี่ยน
+	var other models.HNFormat
+	err := database.WithoutRLS(db, func(tx *gorm.DB) error {
+		return tx.First(&other, "hospital = ?", "OTHERHOSPITAL").Error
+	})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
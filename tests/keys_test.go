@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"HIS-api/keys"
+	"HIS-api/models"
+	"HIS-api/routes"
+	"HIS-api/tokens"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ทดสอบเซ็นและตรวจ token ด้วยกุญแจจากไดเรกทอรี ทั้ง RS256 และ ES256
+func TestKeyManager_SignAndVerify(t *testing.T) {
+	for _, alg := range []string{keys.AlgRS256, keys.AlgES256} {
+		dir := t.TempDir()
+		manager, err := keys.NewFromDir(dir, alg, 0, time.Hour)
+		require.NoError(t, err)
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+		require.Len(t, files, 1, "a key should be generated when the directory is empty")
+
+		signed, err := manager.Sign(jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Minute).Unix()})
+		require.NoError(t, err)
+
+		token, err := jwt.Parse(signed, manager.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+		require.NoError(t, err)
+		require.True(t, token.Valid)
+		require.Equal(t, alg, token.Method.Alg())
+	}
+}
+
+// ทดสอบหมุนกุญแจ: token ที่เซ็นด้วยกุญแจเก่ายังตรวจผ่าน แต่ token ใหม่ใช้กุญแจใหม่
+func TestKeyManager_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := keys.NewFromDir(dir, keys.AlgES256, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+
+	oldToken, err := manager.Sign(jwt.MapClaims{"sub": "1"})
+	require.NoError(t, err)
+	oldKid := manager.Keys()[0].ID
+
+	// กุญแจที่วางเองไม่มีไฟล์ข้อมูลประกอบ ต้องไม่ถูกลบแม้จะเก่ามาก
+	placed, err := keys.NewEphemeral(keys.AlgES256)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(placed.Keys()[0].Signer)
+	require.NoError(t, err)
+	placedPath := filepath.Join(dir, "manual.pem")
+	require.NoError(t, os.WriteFile(placedPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	ancient := time.Now().Add(-100 * time.Hour)
+	require.NoError(t, os.Chtimes(placedPath, ancient, ancient))
+
+	// กุญแจเดิมเก่ากว่ารอบการหมุน: สร้างกุญแจใหม่และเผยแพร่ แต่ยังเซ็นด้วยกุญแจเดิม
+	backdateKey(t, dir, oldKid, 2*time.Hour)
+	require.NoError(t, manager.Reload())
+	require.Len(t, manager.Keys(), 3)
+	newKid := manager.Keys()[0].ID
+	require.NotEqual(t, oldKid, newKid)
+	assert.Equal(t, oldKid, signingKid(t, manager))
+
+	// อีก replica ที่โหลดไดเรกทอรีเดียวกันต้องเลือกกุญแจเดียวกัน
+	other, err := keys.NewFromDir(dir, keys.AlgES256, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, oldKid, signingKid(t, other))
+
+	// เผยแพร่ครบรอบโหลดและอายุ cache ของ JWKS แล้วจึงเริ่มเซ็นด้วยกุญแจใหม่
+	backdateKey(t, dir, newKid, keys.ReloadInterval+keys.JWKSMaxAge)
+	require.NoError(t, manager.Reload())
+	newToken, err := manager.Sign(jwt.MapClaims{"sub": "1"})
+	require.NoError(t, err)
+	assert.Equal(t, newKid, signingKid(t, manager))
+
+	for _, signed := range []string{oldToken, newToken} {
+		_, err := jwt.Parse(signed, manager.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+		require.NoError(t, err)
+	}
+
+	// เลยระยะเก็บรักษาแล้ว กุญแจเก่าที่ระบบสร้างต้องถูกลบ แต่กุญแจที่วางเองยังอยู่
+	backdateKey(t, dir, oldKid, 4*time.Hour+keys.ReloadInterval+keys.JWKSMaxAge)
+	require.NoError(t, manager.Reload())
+	require.Len(t, manager.Keys(), 2)
+	assert.NoFileExists(t, filepath.Join(dir, oldKid+".pem"))
+	assert.NoFileExists(t, filepath.Join(dir, oldKid+".json"))
+	assert.FileExists(t, placedPath)
+}
+
+// kid ของ token ที่ manager เซ็นตอนนี้
+func signingKid(t *testing.T, manager *keys.Manager) string {
+	t.Helper()
+	signed, err := manager.Sign(jwt.MapClaims{"sub": "1"})
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(t, err)
+	return parsed.Header["kid"].(string)
+}
+
+// แก้เวลาสร้างในไฟล์ข้อมูลประกอบของกุญแจให้เก่าลง age
+func backdateKey(t *testing.T, dir, kid string, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, kid+".json")
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	meta := map[string]any{}
+	require.NoError(t, json.Unmarshal(raw, &meta))
+	meta["created_at"] = time.Now().Add(-age).UTC().Format(time.RFC3339Nano)
+	raw, err = json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+}
+
+// ทดสอบ token ที่เซ็นด้วย HS256 หรือกุญแจที่ไม่รู้จักต้องตรวจไม่ผ่าน
+func TestKeyManager_RejectsUnknownKeys(t *testing.T) {
+	manager, err := keys.NewEphemeral(keys.AlgES256)
+	require.NoError(t, err)
+	other, err := keys.NewEphemeral(keys.AlgES256)
+	require.NoError(t, err)
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+	hs.Header["kid"] = manager.Keys()[0].ID
+	hsSigned, _ := hs.SignedString([]byte(""))
+	_, err = jwt.Parse(hsSigned, manager.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+	require.Error(t, err)
+
+	foreign, _ := other.Sign(jwt.MapClaims{"sub": "1"})
+	_, err = jwt.Parse(foreign, manager.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+	require.Error(t, err)
+}
+
+// ทดสอบ endpoint JWKS คืน public key ของระบบ
+func TestJWKSEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	routes.WellKnownRoutes(r)
+
+	w := performRequest(r, "GET", "/.well-known/jwks.json", nil, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var set keys.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	require.NotEmpty(t, set.Keys)
+	for _, k := range set.Keys {
+		require.NotEmpty(t, k.Kid)
+		require.Equal(t, "sig", k.Use)
+	}
+}
+
+// iat ละเอียดถึงมิลลิวินาที token ที่ออกก่อนเปลี่ยนรหัสผ่านในวินาทีเดียวกันก็ยังแยกได้
+func TestIssuedBefore_MillisecondPrecision(t *testing.T) {
+	changedAt := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	signed, _, err := tokens.IssueAccessToken(models.Staff{Username: "clerk", Hospital: "HOSPITAL"})
+	require.NoError(t, err)
+	claims, err := tokens.ParseAccessToken(signed)
+	require.NoError(t, err)
+
+	require.False(t, tokens.IssuedBefore(claims, changedAt))
+	require.True(t, tokens.IssuedBefore(claims, time.Now().Add(2*time.Millisecond)))
+
+	delete(claims, "iat")
+	require.True(t, tokens.IssuedBefore(claims, changedAt.Add(-time.Hour)))
+}
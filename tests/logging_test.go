@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"HIS-api/logging"
+	"HIS-api/middlewares"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// เลขบัตรประชาชน หนังสือเดินทาง เบอร์โทร และอีเมลต้องไม่หลุดลง log ไม่ว่าจะอยู่ในข้อความ attribute หรือ error
+func TestRedactor_HidesPatientIdentifiers(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := slog.New(logging.NewRedactor(slog.NewJSONHandler(&buf, nil)))
+
+	logger.Info("search for 1-2345-67890-12-1 failed",
+		"national_id", "1234567890121",
+		"query", "passport=A12345678",
+		"error", errors.New(`duplicate key: somchai@example.com / 081-234-5678`),
+		slog.Group("patient", "phone_number", "0812345678", "hn", "HN001"),
+	)
+	logger.With("email", "somchai@example.com").Warn("+66812345678 called")
+
+	out := buf.String()
+	for _, secret := range []string{"1-2345-67890-12-1", "1234567890121", "A12345678", "somchai@example.com", "081-234-5678", "0812345678", "+66812345678"} {
+		assert.NotContains(t, out, secret)
+	}
+	assert.Contains(t, out, logging.Redacted)
+	assert.Contains(t, out, "HN001")
+}
+
+// ใช้ X-Request-ID ที่ส่งมาถ้ารูปแบบถูกต้อง ไม่งั้นสร้างใหม่ และส่งกลับใน response เสมอ
+func TestRequestID_HonoursAndPropagates(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.RequestID())
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, logging.RequestID(c.Request.Context()))
+	})
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set("X-Request-ID", "nginx-abc123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "nginx-abc123", w.Body.String())
+	assert.Equal(t, "nginx-abc123", w.Header().Get("X-Request-ID"))
+
+	req = httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set("X-Request-ID", "bad id\nwith newline")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	generated := w.Header().Get("X-Request-ID")
+	require.Len(t, generated, 32)
+	assert.Equal(t, generated, w.Body.String())
+}
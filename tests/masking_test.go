@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"HIS-api/masking"
+	"HIS-api/models"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMaskingFormats(t *testing.T) {
+	require.Equal(t, "1-2345-xxxxx-12-1", masking.NationalID("1234567890121"))
+	require.Equal(t, "Axxxxxx78", masking.Passport("A12345678"))
+	require.Equal(t, "081xxxxx78", masking.Phone("0812345678"))
+	require.Equal(t, "sxxxxxx@example.com", masking.Email("somchai@example.com"))
+	// ค่าที่สั้นหรือผิดรูปแบบต้องไม่หลุดออกไปทั้งหมด
+	require.Equal(t, "xx", masking.Phone("08"))
+	require.Equal(t, "xxx12", masking.NationalID("12312"))
+}
+
+type patientResponse struct {
+	Patient struct {
+		NationalID   *string
+		PassportID   *string
+		PhoneNumber  string
+		MaskedFields []string
+	} `json:"patient"`
+}
+
+// clerk เห็นเลขบัตรประชาชนแบบปิดบางส่วนในผลค้นหาและการดูผู้ป่วย
+func TestPatientView_MaskedForClerk(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTestRouter(db)
+	token := getValidToken(db, "clerk", "HOSPITAL")
+
+	w := performRequest(router, "GET", "/patient/search?national_id=1234567890121", nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), "1234567890121")
+	require.Contains(t, w.Body.String(), "1-2345-xxxxx-12-1")
+
+	id := findPatientID(db, "1234567890121")
+	w = performRequest(router, "GET", fmt.Sprintf("/patient/%d", id), nil, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response patientResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "1-2345-xxxxx-12-1", *response.Patient.NationalID)
+	require.Equal(t, "081xxxxx78", response.Patient.PhoneNumber)
+	require.Contains(t, response.Patient.MaskedFields, "national_id")
+	require.NotContains(t, w.Body.String(), "NationalIDIndex")
+
+	// ข้อมูลในฐานข้อมูลไม่ถูกแก้
+	var patient models.Patient
+	db.First(&patient, id)
+	require.Equal(t, "1234567890121", *patient.NationalID)
+}
+
+// แพทย์เห็นเบอร์โทรเต็ม แต่เลขประจำตัวยังถูกปิด
+func TestPatientView_RoleUnmaskedFields(t *testing.T) {
+	db := setupTestDB(t)
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	db.Create(&models.Staff{Username: "doctor", Password: string(hashedPassword), Hospital: "HOSPITAL", Role: models.RoleDoctor})
+	router := setupTestRouter(db)
+
+	w := performRequest(router, "GET", fmt.Sprintf("/patient/%d", findPatientID(db, "1234567890121")), nil, getValidToken(db, "doctor", "HOSPITAL"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response patientResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.Equal(t, "0812345678", response.Patient.PhoneNumber)
+	require.Equal(t, "1-2345-xxxxx-12-1", *response.Patient.NationalID)
+}
+
+// reveal ต้องระบุวัตถุประสงค์ เปิดเฉพาะฟิลด์ที่ขอ และถูกบันทึกใน audit log
+func TestRevealPatient(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTestRouter(db)
+	token := getValidToken(db, "clerk", "HOSPITAL")
+	id := findPatientID(db, "1234567890121")
+	path := fmt.Sprintf("/patient/%d/reveal", id)
+
+	w := performRequest(router, "POST", path, []byte(`{}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", path, []byte(`{"purpose":"curiosity"}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = performRequest(router, "POST", path, []byte(`{"purpose":"registration","fields":["first_name_th"]}`), token)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var before int64
+	db.Model(&models.AuditEntry{}).Where("hospital = ? AND action = ?", "HOSPITAL", models.AuditPatientReveal).Count(&before)
+
+	body, _ := json.Marshal(map[string]interface{}{"purpose": "identity_verification", "fields": []string{"national_id"}})
+	w = performRequest(router, "POST", path, body, token)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response patientResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.Equal(t, "1234567890121", *response.Patient.NationalID)
+	require.Equal(t, "Axxxxxx78", *response.Patient.PassportID)
+	require.NotContains(t, response.Patient.MaskedFields, "national_id")
+
+	var entry models.AuditEntry
+	require.NoError(t, db.Where("hospital = ? AND action = ?", "HOSPITAL", models.AuditPatientReveal).Order("seq DESC").First(&entry).Error)
+	require.Equal(t, fmt.Sprintf("[%d]", id), entry.PatientIDs)
+	require.JSONEq(t, `{"fields":"national_id","purpose":"identity_verification"}`, entry.Query)
+
+	var after int64
+	db.Model(&models.AuditEntry{}).Where("hospital = ? AND action = ?", "HOSPITAL", models.AuditPatientReveal).Count(&after)
+	require.Equal(t, before+1, after)
+}
+
+// auditor ไม่มีสิทธิ์ reveal
+func TestRevealPatient_AuditorForbidden(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTestRouter(db)
+
+	path := fmt.Sprintf("/patient/%d/reveal", findPatientID(db, "1234567890121"))
+	w := performRequest(router, "POST", path, []byte(`{"purpose":"treatment"}`), getValidToken(db, "auditor", "HOSPITAL"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
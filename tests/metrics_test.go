@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"HIS-api/controllers"
+	"HIS-api/middlewares"
+	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/routes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// /metrics ใช้ route template เป็น label และไม่มีเลขประจำตัวหรือ id ของผู้ป่วยหลุดออกไป
+func TestMetrics_NoPatientIdentifiersInLabels(t *testing.T) {
+	t.Parallel()
+	patients := repository.NewMemoryPatients(memoryPatient("HOSPITAL", "สมชาย", "สุขดี", "1234567890121"))
+	h := controllers.NewPatientHandler(patients, &repository.MemoryAuditLog{})
+
+	r := newHermeticEngine()
+	r.Use(middlewares.Metrics())
+	staff := repository.NewMemoryStaff()
+	token := memoryActor(t, staff, "HOSPITAL", models.RoleAdmin)
+	auth := middlewares.AuthMiddleware(staff)
+	r.GET("/patient/search", auth, h.SearchPatient)
+	r.GET("/patient/:id", auth, h.GetPatient)
+	routes.MetricsRoutes(r)
+
+	w := performRequest(r, "GET", "/patient/search?national_id=1234567890121", nil, token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = performRequest(r, "GET", "/patient/987654", nil, token)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = performRequest(r, "GET", "/metrics", nil, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+
+	assert.Contains(t, body, `route="/patient/search"`)
+	assert.Contains(t, body, fmt.Sprintf(`route="/patient/:id",status="%d"`, http.StatusNotFound))
+	assert.Contains(t, body, "his_patient_search_results_count")
+	assert.NotContains(t, body, "1234567890121")
+	assert.NotContains(t, body, "987654")
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"HIS-api/models"
+	"HIS-api/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ทดสอบรหัส TOTP ตาม test vector ของ RFC 6238 (SHA1, T = 59)
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	step := services.TOTPStep(time.Unix(59, 0))
+	code, err := services.TOTPCode(secret, step)
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	// ใช้รหัสเดิมซ้ำใน step เดียวกันไม่ได้
+	used, ok := services.VerifyTOTP(secret, code, time.Unix(59, 0), 0)
+	assert.True(t, ok)
+	_, ok = services.VerifyTOTP(secret, code, time.Unix(59, 0), used)
+	assert.False(t, ok)
+}
+
+func decodeBody(t *testing.T, body []byte) map[string]interface{} {
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &response))
+	return response
+}
+
+// ทดสอบ role ที่บังคับ MFA: ลงทะเบียนตอน login แล้วเข้าสู่ระบบสองขั้นด้วย TOTP และรหัสกู้คืน
+func TestMFA_EnrollAndLogin(t *testing.T) {
+	db := setupTestDB(t)
+	t.Setenv("MFA_REQUIRED_ROLES", "admin")
+	router := setupStaffRouter(db)
+
+	payload, _ := json.Marshal(map[string]string{"username": "admin", "password": "password", "hospital": "Hospital"})
+	w := performRequest(router, "POST", "/staff/login", payload, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	response := decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, true, response["mfa_enrollment_required"])
+	assert.Nil(t, response["token"])
+	enrollToken := response["mfa_token"].(string)
+
+	// token ลงทะเบียนใช้กับ API อื่นไม่ได้
+	w = performRequest(router, "POST", "/staff/logout", nil, enrollToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "POST", "/staff/mfa/enroll", nil, enrollToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	response = decodeBody(t, w.Body.Bytes())
+	secret := response["secret"].(string)
+	assert.Contains(t, response["otpauth_uri"], "otpauth://totp/")
+
+	code, _ := services.TOTPCode(secret, services.TOTPStep(time.Now()))
+	activate, _ := json.Marshal(map[string]string{"code": code})
+	w = performRequest(router, "POST", "/staff/mfa/activate", activate, enrollToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	response = decodeBody(t, w.Body.Bytes())
+	assert.NotEmpty(t, response["token"])
+	codes := response["recovery_codes"].([]interface{})
+	assert.Len(t, codes, 10)
+
+	// login ครั้งต่อไปต้องยืนยันรหัส MFA
+	w = performRequest(router, "POST", "/staff/login", payload, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	response = decodeBody(t, w.Body.Bytes())
+	assert.Equal(t, true, response["mfa_required"])
+	mfaToken := response["mfa_token"].(string)
+
+	wrong, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": "000000"})
+	w = performRequest(router, "POST", "/staff/login/mfa", wrong, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	recovery, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "recovery_code": codes[0].(string)})
+	w = performRequest(router, "POST", "/staff/login/mfa", recovery, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, decodeBody(t, w.Body.Bytes())["token"])
+
+	// mfa_token และรหัสกู้คืนใช้ได้ครั้งเดียว
+	w = performRequest(router, "POST", "/staff/login/mfa", recovery, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// ทดสอบ admin ล้าง MFA ของ Staff แล้ว Staff login ได้โดยไม่ต้องใช้รหัส MFA
+func TestMFA_AdminReset(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	db.Model(&clerk).Updates(map[string]interface{}{"mfa_enabled": true, "mfa_secret": secret})
+
+	payload, _ := json.Marshal(map[string]string{"username": "clerk", "password": "password", "hospital": "Hospital"})
+	w := performRequest(router, "POST", "/staff/login", payload, "")
+	assert.Equal(t, true, decodeBody(t, w.Body.Bytes())["mfa_required"])
+
+	w = performRequest(router, "POST", fmt.Sprintf("/staff/%d/mfa/reset", clerk.ID), nil, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "POST", "/staff/login", payload, "")
+	assert.NotEmpty(t, decodeBody(t, w.Body.Bytes())["token"])
+}
+
+// ทดสอบใส่รหัส MFA ผิดจนบัญชีถูกล็อก แล้วรหัสถูกก็ได้คำตอบเดียวกับรหัสผิดทุกประการ
+func TestMFA_LockoutIsIndistinguishable(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES", "2")
+	t.Setenv("LOGIN_FREE_FAILURES", "5")
+	db := setupTestDB(t)
+	t.Setenv("MFA_REQUIRED_ROLES", "admin")
+	router := setupStaffRouter(db)
+
+	payload, _ := json.Marshal(map[string]string{"username": "admin", "password": "password", "hospital": "Hospital"})
+	w := performRequest(router, "POST", "/staff/login", payload, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	enrollToken := decodeBody(t, w.Body.Bytes())["mfa_token"].(string)
+
+	w = performRequest(router, "POST", "/staff/mfa/enroll", nil, enrollToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	secret := decodeBody(t, w.Body.Bytes())["secret"].(string)
+	code, _ := services.TOTPCode(secret, services.TOTPStep(time.Now()))
+	activate, _ := json.Marshal(map[string]string{"code": code})
+	require.Equal(t, http.StatusOK, performRequest(router, "POST", "/staff/mfa/activate", activate, enrollToken).Code)
+
+	w = performRequest(router, "POST", "/staff/login", payload, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	mfaToken := decodeBody(t, w.Body.Bytes())["mfa_token"].(string)
+
+	wrong, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": "000000"})
+	var invalid string
+	for i := 0; i < 2; i++ {
+		w = performRequest(router, "POST", "/staff/login/mfa", wrong, "")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		invalid = w.Body.String()
+	}
+
+	next, _ := services.TOTPCode(secret, services.TOTPStep(time.Now().Add(30*time.Second)))
+	right, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": next})
+	w = performRequest(router, "POST", "/staff/login/mfa", right, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, invalid, w.Body.String())
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"HIS-api/database"
+	"HIS-api/encryption"
+	"HIS-api/models"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// migration ที่ฝังไว้ต้องโหลดได้ version เรียงต่อกันไม่ซ้ำ
+func TestMigrations_Ordered(t *testing.T) {
+	migrations, err := database.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		require.Equal(t, i+1, m.Version, m.String())
+		require.NotEmpty(t, m.Name)
+	}
+
+	latest, err := database.LatestSchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, migrations[len(migrations)-1].Version, latest)
+}
+
+// รันซ้ำแล้วไม่มีอะไรเปลี่ยน และทุกขั้นถูกบันทึกใน schema_migrations
+func TestMigrateUp_Idempotent(t *testing.T) {
+	db := setupTestDB(t)
+
+	ran, err := database.MigrateUp(db)
+	require.NoError(t, err)
+	require.Empty(t, ran)
+
+	version, err := database.SchemaVersion(db)
+	require.NoError(t, err)
+	latest, _ := database.LatestSchemaVersion()
+	require.Equal(t, latest, version)
+
+	statuses, err := database.MigrationStatuses(db)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		require.NotNil(t, s.AppliedAt, s.Name)
+		require.True(t, s.Known, s.Name)
+	}
+}
+
+// ขั้นที่ย้อนกลับไม่ได้ (เข้ารหัสข้อมูลผู้ป่วย) ต้องหยุด down ไว้โดยไม่แก้อะไร
+func TestMigrateDown_StopsAtIrreversible(t *testing.T) {
+	db := setupTestDB(t)
+
+	migrations, _ := database.Migrations()
+	latest := migrations[len(migrations)-1]
+	require.False(t, latest.Reversible())
+
+	reverted, err := database.MigrateDown(db, 1)
+	require.ErrorIs(t, err, database.ErrIrreversibleMigration)
+	require.Empty(t, reverted)
+
+	version, _ := database.SchemaVersion(db)
+	require.Equal(t, latest.Version, version)
+}
+
+// โครงสร้างของเวอร์ชันแรกที่สร้างด้วย AutoMigrate (unique บนค่าจริงทั้งระบบ และอีเมลว่างเก็บเป็น ”)
+type legacyPatient struct {
+	gorm.Model
+	FirstNameTH  string `gorm:"not null"`
+	MiddleNameTH string
+	LastNameTH   string `gorm:"not null"`
+	FirstNameEN  string
+	MiddleNameEN string
+	LastNameEN   string
+	DateOfBirth  time.Time `gorm:"not null"`
+	PatientHN    *string   `gorm:"unique"`
+	NationalID   *string   `gorm:"unique"`
+	PassportID   *string   `gorm:"unique"`
+	PhoneNumber  string    `gorm:"not null"`
+	Email        string    `gorm:"unique"`
+	Gender       string    `gorm:"not null;check:gender IN ('M', 'F')"`
+	Hospital     string    `gorm:"not null"`
+}
+
+func (legacyPatient) TableName() string { return "patients" }
+
+type legacyStaff struct {
+	gorm.Model
+	Username string `gorm:"unique;not null"`
+	Password string `gorm:"not null"`
+	Hospital string `gorm:"not null"`
+}
+
+func (legacyStaff) TableName() string { return "staffs" }
+
+// ฐานข้อมูลเดิมที่สร้างด้วย AutoMigrate พร้อมข้อมูล migrate ขึ้นได้ครบ โครงสร้างและข้อมูลใช้กับโค้ดปัจจุบันได้
+func TestMigrateUp_UpgradesLegacyAutoMigrateSchema(t *testing.T) {
+	t.Parallel()
+	db := newEmptyTestDB(t)
+	require.NoError(t, db.AutoMigrate(&legacyPatient{}, &legacyStaff{}))
+
+	hn, nationalID := "HN001", "1234567890121"
+	dob := time.Date(1990, 5, 12, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.Create(&legacyStaff{Username: "admin", Password: "$2a$04$legacyhash", Hospital: "Hospital A"}).Error)
+	require.NoError(t, db.Create(&legacyPatient{
+		FirstNameTH: "สมชาย", LastNameTH: "สุขดี", DateOfBirth: dob, PatientHN: &hn, NationalID: &nationalID,
+		PhoneNumber: "0812345678", Gender: "M", Hospital: "Hospital A",
+	}).Error)
+	require.NoError(t, db.Create(&legacyPatient{
+		FirstNameTH: "สมหญิง", LastNameTH: "ใจดี", DateOfBirth: dob,
+		PhoneNumber: "0899999999", Email: "somying@example.com", Gender: "F", Hospital: "Hospital B",
+	}).Error)
+
+	_, err := database.MigrateUp(db)
+	require.NoError(t, err)
+
+	var uniques int64
+	require.NoError(t, db.Raw(`SELECT count(*) FROM pg_constraint
+		WHERE conrelid = 'patients'::regclass AND conname LIKE 'uni_patients_%'`).Scan(&uniques).Error)
+	require.Zero(t, uniques)
+
+	var staff models.Staff
+	require.NoError(t, db.Where("username = ?", "admin").First(&staff).Error)
+	require.Equal(t, "HOSPITAL_A", staff.Hospital)
+	require.Equal(t, models.RoleRegistrationClerk, staff.Role)
+	require.True(t, staff.Active())
+	require.Zero(t, staff.FailedLoginAttempts)
+
+	err = database.WithoutRLS(db, func(tx *gorm.DB) error {
+		var patients []models.Patient
+		require.NoError(t, tx.Order("id").Find(&patients).Error)
+		require.Len(t, patients, 2)
+
+		require.Equal(t, "HOSPITAL_A", patients[0].Hospital)
+		require.Equal(t, nationalID, *patients[0].NationalID)
+		require.Nil(t, patients[0].Email)
+		require.Equal(t, encryption.BlindIndex("national_id", nationalID), *patients[0].NationalIDIndex)
+		require.Equal(t, "somying@example.com", *patients[1].Email)
+
+		var stored string
+		require.NoError(t, tx.Raw("SELECT phone_number FROM patients WHERE id = ?", patients[0].ID).Scan(&stored).Error)
+		require.True(t, strings.HasPrefix(stored, encryption.Prefix))
+		return nil
+	})
+	require.NoError(t, err)
+
+	// HN และเลขบัตรเดิมซ้ำได้ในโรงพยาบาลอื่นแล้ว
+	aPatient().InHospital("HOSPITAL_B").WithHN(hn).WithNationalID(nationalID).Create(t, db)
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"HIS-api/models"
+	"HIS-api/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// ทดสอบนโยบายรหัสผ่าน: ความยาว ประเภทตัวอักษร username และรายการรหัสผ่านที่รั่วไหล
+func TestPasswordPolicy_Validate(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(list, []byte("# common\nPassword1234\n"), 0o600))
+	t.Setenv("PASSWORD_BREACHED_LIST", list)
+
+	policy, err := services.LoadPasswordPolicy()
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.Validate("Correct-Horse-9", "nurse01"))
+
+	var policyErr *services.PasswordPolicyError
+	err = policy.Validate("short1A", "nurse01")
+	require.True(t, errors.As(err, &policyErr))
+	assert.Len(t, policyErr.Reasons, 1)
+
+	err = policy.Validate("alllowercase", "nurse01")
+	require.True(t, errors.As(err, &policyErr))
+	assert.Len(t, policyErr.Reasons, 2)
+
+	assert.Error(t, policy.Validate("Nurse01-Secret", "nurse01"))
+	assert.Error(t, policy.Validate("password1234", "nurse01"))
+
+	t.Setenv("PASSWORD_BREACHED_LIST", filepath.Join(t.TempDir(), "missing.txt"))
+	_, err = services.LoadPasswordPolicy()
+	assert.Error(t, err)
+}
+
+func changePassword(db *gorm.DB, token, current, next string) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(map[string]string{"current_password": current, "new_password": next})
+	return performRequest(setupStaffRouter(db), "POST", "/staff/password", payload, token)
+}
+
+// ทดสอบเปลี่ยนรหัสผ่านเอง: ต้องรู้รหัสเดิม ผ่านนโยบาย และห้ามซ้ำกับรหัสที่เคยใช้
+func TestChangePassword(t *testing.T) {
+	db := setupTestDB(t)
+	token := getValidToken(db, "clerk", "Hospital")
+
+	assert.Equal(t, http.StatusUnauthorized, changePassword(db, token, "wrong", "New-Passw0rd-1").Code)
+	assert.Equal(t, http.StatusBadRequest, changePassword(db, token, "password", "weak").Code)
+
+	w := changePassword(db, token, "password", "New-Passw0rd-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	next := response["token"].(string)
+
+	// token เดิมถูก revoke แล้ว
+	assert.Equal(t, http.StatusUnauthorized, changePassword(db, token, "New-Passw0rd-1", "New-Passw0rd-2").Code)
+
+	w = changePassword(db, next, "New-Passw0rd-1", "New-Passw0rd-2")
+	require.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	next = response["token"].(string)
+	assert.Equal(t, http.StatusOK, loginStatus(setupStaffRouter(db), "clerk", "New-Passw0rd-2"))
+
+	// รหัสที่เคยใช้ไปแล้วตั้งซ้ำไม่ได้
+	w = changePassword(db, next, "New-Passw0rd-2", "New-Passw0rd-1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "used recently")
+}
+
+// เปลี่ยนรหัสผ่านจากเครื่องหนึ่ง access token ของเครื่องอื่นที่ออกก่อนหน้านั้นต้องใช้ไม่ได้ทันที
+func TestChangePassword_EndsOtherSessions(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	current := getValidToken(db, "clerk", "Hospital")
+	otherDevice := getValidToken(db, "clerk", "Hospital")
+
+	w := changePassword(db, current, "password", "New-Passw0rd-1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	next := response["token"].(string)
+
+	w = performRequest(router, "POST", "/staff/logout", nil, otherDevice)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = performRequest(router, "POST", "/staff/logout", nil, next)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// ทดสอบ admin รีเซ็ตรหัสผ่าน: รหัสเดิมใช้ไม่ได้ ตั้งรหัสใหม่ด้วย token ได้ครั้งเดียว
+func TestResetStaffPassword(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	adminToken := getValidToken(db, "admin", "Hospital")
+
+	clerkToken := getValidToken(db, "clerk", "Hospital")
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	w := performRequest(router, "POST", fmt.Sprintf("/staff/%d/password/reset", clerk.ID), nil, adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	resetToken := response["reset_token"].(string)
+
+	assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "password"))
+	// session เดิมของ Staff ที่ถูกรีเซ็ตใช้ไม่ได้ทันที
+	w = performRequest(router, "POST", "/staff/logout", nil, clerkToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	payload, _ := json.Marshal(map[string]string{"reset_token": resetToken, "new_password": "Reset-Passw0rd"})
+	w = performRequest(router, "POST", "/staff/password/reset", payload, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "POST", "/staff/password/reset", payload, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusOK, loginStatus(router, "clerk", "Reset-Passw0rd"))
+
+	// admin โรงพยาบาลอื่นรีเซ็ตไม่ได้
+	otherToken := getValidToken(db, "admin_other", "OtherHospital")
+	w = performRequest(router, "POST", fmt.Sprintf("/staff/%d/password/reset", clerk.ID), nil, otherToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// ทดสอบ Staff ที่ถูกบังคับเปลี่ยนรหัสผ่าน: login ได้ token password_change ที่ใช้ได้แค่เปลี่ยนรหัสผ่าน
+func TestLogin_ForcedPasswordChange(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	db.Model(&models.Staff{}).Where("username = ?", "clerk").Update("must_change_password", true)
+
+	payload, _ := json.Marshal(map[string]string{"username": "clerk", "password": "password", "hospital": "Hospital"})
+	w := performRequest(router, "POST", "/staff/login", payload, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, true, response["password_change_required"])
+	assert.Nil(t, response["token"])
+	passwordToken := response["password_token"].(string)
+
+	w = performRequest(router, "POST", "/staff/logout", nil, passwordToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = changePassword(db, passwordToken, "password", "Changed-Passw0rd")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "refresh_token")
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	assert.False(t, clerk.MustChangePassword)
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"testing"
+
+	"HIS-api/database"
+	"HIS-api/models"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// role ที่ไม่ใช่ superuser สำหรับทดสอบ policy (role ที่ใช้รันเทสต์อาจเป็น superuser ซึ่งข้าม RLS เสมอ)
+const rlsTestRole = "his_rls_test"
+
+func setupRLSRole(t *testing.T, db *gorm.DB) {
+	err := db.Exec(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = '` + rlsTestRole + `') THEN
+			CREATE ROLE ` + rlsTestRole + ` NOLOGIN NOSUPERUSER NOBYPASSRLS;
+		END IF;
+	END $$`).Error
+	if err != nil {
+		t.Skip("cannot create test role:", err)
+	}
+	// แต่ละเทสต์ใช้ schema ของตัวเอง จึงต้องให้สิทธิ์ใช้ schema ด้วย
+	var schema string
+	require.NoError(t, db.Raw("SELECT current_schema()").Scan(&schema).Error)
+	require.NoError(t, db.Exec("GRANT USAGE ON SCHEMA "+schema+" TO "+rlsTestRole).Error)
+	require.NoError(t, db.Exec("GRANT SELECT ON patients TO "+rlsTestRole).Error)
+}
+
+// นับผู้ป่วยโดยไม่กรองโรงพยาบาลในฐานะ role ของแอป
+func countPatientsAs(t *testing.T, db *gorm.DB, hospital string) int64 {
+	var count int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL ROLE " + rlsTestRole).Error; err != nil {
+			return err
+		}
+		if hospital != "" {
+			if err := database.SetCurrentHospital(tx, hospital); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Patient{}).Count(&count).Error
+	})
+	require.NoError(t, err)
+	return count
+}
+
+// query ที่ลืมกรองโรงพยาบาลต้องเห็นเฉพาะข้อมูลของโรงพยาบาลปัจจุบัน
+func TestRowLevelSecurity_ScopesUnfilteredQuery(t *testing.T) {
+	db := setupTestDB(t)
+	setupRLSRole(t, db)
+
+	db.Create(&models.Patient{
+		FirstNameTH: "สมชาย",
+		LastNameTH:  "สุขดี",
+		PhoneNumber: "0812345678",
+		Gender:      "M",
+		Hospital:    "OTHERHOSPITAL",
+	})
+
+	var own int64
+	db.Model(&models.Patient{}).Where("hospital = ?", "HOSPITAL").Count(&own)
+	require.NotZero(t, own)
+
+	require.Equal(t, own, countPatientsAs(t, db, "HOSPITAL"))
+	require.Equal(t, int64(1), countPatientsAs(t, db, "OTHERHOSPITAL"))
+	require.Zero(t, countPatientsAs(t, db, ""))
+}
+
+// WithoutRLS ใช้กับงานบำรุงรักษาที่ต้องเห็นทุกโรงพยาบาล
+func TestRowLevelSecurity_WithoutRLS(t *testing.T) {
+	db := setupTestDB(t)
+	setupRLSRole(t, db)
+
+	var total int64
+	db.Model(&models.Patient{}).Count(&total)
+
+	var count int64
+	err := database.WithoutRLS(db, func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL ROLE " + rlsTestRole).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Patient{}).Count(&count).Error
+	})
+	require.NoError(t, err)
+	require.Equal(t, total, count)
+}
@@ -1,94 +1,166 @@
 package tests
 
 import (
-	"HIS-api/config"
 	"HIS-api/controllers"
 	"HIS-api/models"
+	"HIS-api/repository"
+	"HIS-api/routes"
+	"HIS-api/tokens"
+	"HIS-api/validators"
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-func setupStaffTestDB() {
-	config.ConnectDB()
-	config.DB.Exec("DELETE FROM staffs")
-
-	// เข้ารหัสรหัสผ่านก่อนบันทึก
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+// มีเฉพาะ admin ของ HOSPITAL
+func setupStaffTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	t.Setenv("MFA_REQUIRED_ROLES", "")
+	db := newTestDB(t)
+	createTestHospitals(t, db)
+	aStaff("admin").Create(t, db)
+	return db
+}
 
-	staff := models.Staff{
-		Username: "admin",
-		Password: string(hashedPassword),
-		Hospital: "Hospital",
-	}
-	config.DB.Create(&staff)
+// ตั้งค่า Router ของ Staff (มี AuthMiddleware ตาม routes จริง)
+func setupStaffRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	validators.Register()
+	r := gin.Default()
+	staffRepo := repository.NewPostgresStaff(db)
+	routes.StaffRoutes(r, controllers.NewStaffHandler(staffRepo), controllers.NewAuthHandler(staffRepo), staffRepo)
+	return r
 }
 
-func teardownTestDB() {
-	config.DB.Exec("DELETE FROM staffs") // ล้างข้อมูลทดสอบออก
+// handler ของ login และ session ที่ใช้ Postgres เหมือนใน main
+func newAuthHandler(db *gorm.DB) *controllers.AuthHandler {
+	return controllers.NewAuthHandler(repository.NewPostgresStaff(db))
 }
 
 // ทดสอบสร้างบัญชี Staff สำเร็จ
 func TestRegisterStaff_Success(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupStaffTestDB()
-	defer teardownTestDB()
+	db := setupStaffTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
 
 	registerPayload := map[string]string{
 		"username": "newuser",
-		"password": "password123",
+		"password": "Password1234",
 		"hospital": "Hospital",
+		"role":     "nurse",
 	}
 	payloadBytes, _ := json.Marshal(registerPayload)
 
-	req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBuffer(payloadBytes))
-	req.Header.Set("Content-Type", "application/json")
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
 
-	w := httptest.NewRecorder()
-	router := gin.Default()
-	router.POST("/staff/create", controllers.RegisterStaff)
+	assert.Equal(t, http.StatusCreated, w.Code)
 
-	router.ServeHTTP(w, req)
+	var created models.Staff
+	db.Where("username = ?", "newuser").First(&created)
+	assert.Equal(t, models.RoleNurse, created.Role)
+}
 
-	assert.Equal(t, http.StatusCreated, w.Code)
+// ทดสอบสร้างบัญชี Staff โดยไม่ได้ login (ควรได้ 401)
+func TestRegisterStaff_Unauthenticated(t *testing.T) {
+	db := setupStaffTestDB(t)
+	router := setupStaffRouter(db)
+
+	registerPayload := map[string]string{
+		"username": "newuser",
+		"password": "Password1234",
+		"hospital": "Hospital",
+	}
+	payloadBytes, _ := json.Marshal(registerPayload)
+
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, "")
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// ทดสอบ Staff ที่ไม่ใช่ admin สร้างบัญชีไม่ได้ (ควรได้ 403)
+func TestRegisterStaff_NotAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "clerk", "Hospital")
+
+	registerPayload := map[string]string{
+		"username": "newuser",
+		"password": "Password1234",
+	}
+	payloadBytes, _ := json.Marshal(registerPayload)
+
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// ทดสอบ admin สร้างบัญชีให้โรงพยาบาลอื่นไม่ได้ (ควรได้ 403)
+func TestRegisterStaff_OtherHospital(t *testing.T) {
+	db := setupStaffTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
+
+	registerPayload := map[string]string{
+		"username": "newuser",
+		"password": "Password1234",
+		"hospital": "OtherHospital",
+	}
+	payloadBytes, _ := json.Marshal(registerPayload)
+
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// ทดสอบสร้างบัญชีด้วย role ที่ไม่มีอยู่จริง (ควรได้ 400)
+func TestRegisterStaff_InvalidRole(t *testing.T) {
+	db := setupStaffTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
+
+	registerPayload := map[string]string{
+		"username": "newuser",
+		"password": "Password1234",
+		"role":     "superuser",
+	}
+	payloadBytes, _ := json.Marshal(registerPayload)
+
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 // ทดสอบสร้างบัญชี Staff ที่ username ซ้ำกัน (ควรได้ 400)
 func TestRegisterStaff_DuplicateUsername(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
 
 	registerPayload := map[string]string{
 		"username": "admin",
-		"password": "password123",
+		"password": "Password1234",
 		"hospital": "Hospital",
 	}
 	payloadBytes, _ := json.Marshal(registerPayload)
 
-	req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBuffer(payloadBytes))
-	req.Header.Set("Content-Type", "application/json")
-
-	w := httptest.NewRecorder()
-	router := gin.Default()
-	router.POST("/staff/create", controllers.RegisterStaff)
-
-	router.ServeHTTP(w, req)
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 // ทดสอบกรณีไม่ส่ง password (ควรได้ 400)
 func TestRegisterStaff_MissingPassword(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
 
 	registerPayload := map[string]string{
 		"username": "newuser",
@@ -96,80 +168,57 @@ func TestRegisterStaff_MissingPassword(t *testing.T) {
 	}
 	payloadBytes, _ := json.Marshal(registerPayload)
 
-	req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBuffer(payloadBytes))
-	req.Header.Set("Content-Type", "application/json")
-
-	w := httptest.NewRecorder()
-	router := gin.Default()
-	router.POST("/staff/create", controllers.RegisterStaff)
-
-	router.ServeHTTP(w, req)
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
-// ทดสอบกรณีไม่ส่ง hospital (ควรได้ 400)
+// ทดสอบกรณีไม่ส่ง hospital จะใช้โรงพยาบาลของ admin (ควรได้ 201)
 func TestRegisterStaff_MissingHospital(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
 
 	registerPayload := map[string]string{
 		"username": "newuser",
-		"password": "password123",
+		"password": "Password1234",
 	}
 	payloadBytes, _ := json.Marshal(registerPayload)
 
-	req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBuffer(payloadBytes))
-	req.Header.Set("Content-Type", "application/json")
-
-	w := httptest.NewRecorder()
-	router := gin.Default()
-	router.POST("/staff/create", controllers.RegisterStaff)
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
 
-	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
 
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var created models.Staff
+	db.Where("username = ?", "newuser").First(&created)
+	assert.Equal(t, "HOSPITAL", created.Hospital)
+	assert.Equal(t, models.RoleRegistrationClerk, created.Role)
 }
 
 // ทดสอบกรณีไม่ส่ง username (ควรได้ 400)
 func TestRegisterStaff_MissingUsername(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
 
 	registerPayload := map[string]string{
-		"password": "password123",
+		"password": "Password1234",
 		"hospital": "Hospital",
 	}
 	payloadBytes, _ := json.Marshal(registerPayload)
 
-	req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBuffer(payloadBytes))
-	req.Header.Set("Content-Type", "application/json")
-
-	w := httptest.NewRecorder()
-	router := gin.Default()
-	router.POST("/staff/create", controllers.RegisterStaff)
-
-	router.ServeHTTP(w, req)
+	w := performRequest(router, "POST", "/staff/create", payloadBytes, token)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 // ทดสอบกรณีส่ง Request Body ไม่ใช่ JSON (ควรได้ 400)
 func TestRegisterStaff_InvalidJSON(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
-
-	req, _ := http.NewRequest("POST", "/staff/create", bytes.NewBuffer([]byte("Invalid Body")))
-	req.Header.Set("Content-Type", "application/json")
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
 
-	w := httptest.NewRecorder()
-	router := gin.Default()
-	router.POST("/staff/create", controllers.RegisterStaff)
-
-	router.ServeHTTP(w, req)
+	w := performRequest(router, "POST", "/staff/create", []byte("Invalid Body"), token)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
@@ -177,8 +226,7 @@ func TestRegisterStaff_InvalidJSON(t *testing.T) {
 // ทดสอบเข้าสู่ระบบสำเร็จ
 func TestLoginStaff_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
 
 	loginPayload := map[string]string{
 		"username": "admin",
@@ -192,7 +240,7 @@ func TestLoginStaff_Success(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	router := gin.Default()
-	router.POST("/staff/login", controllers.LoginStaff)
+	router.POST("/staff/login", newAuthHandler(db).LoginStaff)
 
 	router.ServeHTTP(w, req)
 
@@ -203,13 +251,15 @@ func TestLoginStaff_Success(t *testing.T) {
 
 	_, exists := response["token"]
 	assert.True(t, exists, "Token should be returned")
+
+	staff := response["staff"].(map[string]interface{})
+	assert.Equal(t, "admin", staff["Role"])
 }
 
 // ทดสอบเข้าสู่ระบบด้วยรหัสผ่านผิด (ควรได้ 401)
 func TestLoginStaff_InvalidPassword(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
 
 	loginPayload := map[string]string{
 		"username": "admin",
@@ -223,7 +273,7 @@ func TestLoginStaff_InvalidPassword(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	router := gin.Default()
-	router.POST("/staff/login", controllers.LoginStaff)
+	router.POST("/staff/login", newAuthHandler(db).LoginStaff)
 
 	router.ServeHTTP(w, req)
 
@@ -233,8 +283,7 @@ func TestLoginStaff_InvalidPassword(t *testing.T) {
 // ทดสอบเข้าสู่ระบบโดยไม่มี `hospital` (ควรได้ 400)
 func TestLoginStaff_MissingHospital(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
 
 	loginPayload := map[string]string{
 		"username": "admin",
@@ -247,7 +296,7 @@ func TestLoginStaff_MissingHospital(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	router := gin.Default()
-	router.POST("/staff/login", controllers.LoginStaff)
+	router.POST("/staff/login", newAuthHandler(db).LoginStaff)
 
 	router.ServeHTTP(w, req)
 
@@ -257,8 +306,7 @@ func TestLoginStaff_MissingHospital(t *testing.T) {
 // ทดสอบเข้าสู่ระบบโดยใช้ username ที่ไม่มีอยู่จริง (ควรได้ 401)
 func TestLoginStaff_NonExistentUser(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
 
 	loginPayload := map[string]string{
 		"username": "unknown_user",
@@ -272,7 +320,7 @@ func TestLoginStaff_NonExistentUser(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	router := gin.Default()
-	router.POST("/staff/login", controllers.LoginStaff)
+	router.POST("/staff/login", newAuthHandler(db).LoginStaff)
 
 	router.ServeHTTP(w, req)
 
@@ -282,17 +330,288 @@ func TestLoginStaff_NonExistentUser(t *testing.T) {
 // ทดสอบเข้าสู่ระบบโดยไม่ได้ส่งข้อมูลใดๆ (ควรได้ 400)
 func TestLoginStaff_EmptyRequest(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	setupTestDB()
-	defer teardownTestDB()
+	db := setupTestDB(t)
 
 	req, _ := http.NewRequest("POST", "/staff/login", bytes.NewBuffer([]byte("{}")))
 	req.Header.Set("Content-Type", "application/json")
 
 	w := httptest.NewRecorder()
 	router := gin.Default()
-	router.POST("/staff/login", controllers.LoginStaff)
+	router.POST("/staff/login", newAuthHandler(db).LoginStaff)
 
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+// ล็อกอินแล้วคืน access token และ refresh token
+func loginSession(t *testing.T, router *gin.Engine, username string) (string, string) {
+	payload, _ := json.Marshal(map[string]string{
+		"username": username,
+		"password": "password",
+		"hospital": "Hospital",
+	})
+	w := performRequest(router, "POST", "/staff/login", payload, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response["token"].(string), response["refresh_token"].(string)
+}
+
+// ทดสอบแลก refresh token และ token เดิมใช้ซ้ำไม่ได้
+func TestRefreshSession_Rotation(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	_, refreshToken := loginSession(t, router, "clerk")
+
+	payload, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	w := performRequest(router, "POST", "/staff/refresh", payload, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	rotated := response["refresh_token"].(string)
+	assert.NotEqual(t, refreshToken, rotated)
+
+	// ใช้ token เดิมซ้ำ ต้องถูกปฏิเสธ และ token ใหม่ใน family เดียวกันต้องถูก revoke ด้วย
+	w = performRequest(router, "POST", "/staff/refresh", payload, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	payload, _ = json.Marshal(map[string]string{"refresh_token": rotated})
+	w = performRequest(router, "POST", "/staff/refresh", payload, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// ใช้ refresh token ซ้ำต้องรู้ว่าเป็นของ Staff คนไหน เพื่อบันทึกเหตุการณ์ให้ตามรอยได้
+func TestRotateRefreshToken_ReuseReturnsOwner(t *testing.T) {
+	t.Parallel()
+	db := newTestDB(t)
+	owner := aStaff("clerk").WithRole(models.RoleRegistrationClerk).Create(t, db)
+
+	token, err := tokens.IssueRefreshToken(db, owner.ID, "")
+	assert.NoError(t, err)
+	_, _, err = tokens.RotateRefreshToken(db, token)
+	assert.NoError(t, err)
+
+	staff, _, err := tokens.RotateRefreshToken(db, token)
+	assert.ErrorIs(t, err, tokens.ErrRefreshTokenReused)
+	assert.Equal(t, owner.ID, staff.ID)
+	assert.Equal(t, "HOSPITAL", staff.Hospital)
+}
+
+// ทดสอบ logout แล้ว access token และ refresh token ใช้ไม่ได้ทันที
+func TestLogoutStaff_RevokesTokens(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	routes.PatientRoutes(router, newPatientHandler(db), repository.NewPostgresStaff(db), db)
+	accessToken, refreshToken := loginSession(t, router, "clerk")
+
+	w := performRequest(router, "GET", "/patient/search?last_name=สุขดี", nil, accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	payload, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	w = performRequest(router, "POST", "/staff/logout", payload, accessToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", "/patient/search?last_name=สุขดี", nil, accessToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = performRequest(router, "POST", "/staff/refresh", payload, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func loginStatus(router *gin.Engine, username, password string) int {
+	payload, _ := json.Marshal(map[string]string{
+		"username": username,
+		"password": password,
+		"hospital": "Hospital",
+	})
+	return performRequest(router, "POST", "/staff/login", payload, "").Code
+}
+
+// ทดสอบใส่รหัสผ่านผิดครบจำนวนแล้วบัญชีถูกล็อก แม้รหัสผ่านถูกก็เข้าไม่ได้
+// และตอบเหมือน username ที่ไม่มีอยู่ทุกประการ (ไม่บอกว่าบัญชีมีอยู่และถูกล็อก)
+func TestLoginStaff_Lockout(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES", "3")
+	t.Setenv("LOGIN_FREE_FAILURES", "5")
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "wrongpassword"))
+	}
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(map[string]string{"username": username, "password": password, "hospital": "Hospital"})
+		return performRequest(router, "POST", "/staff/login", payload, "")
+	}
+	locked := login("clerk", "password")
+	unknown := login("nobody", "password")
+	assert.Equal(t, http.StatusUnauthorized, locked.Code)
+	assert.Equal(t, unknown.Code, locked.Code)
+	assert.Equal(t, unknown.Body.String(), locked.Body.String())
+	assert.Empty(t, locked.Header().Get("Retry-After"))
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	assert.NotNil(t, clerk.LockedUntil)
+
+	var events []models.LockoutEvent
+	db.Where("username = ?", "clerk").Find(&events)
+	assert.Len(t, events, 1)
+	assert.Equal(t, models.LockoutEventLocked, events[0].Event)
+}
+
+// ทดสอบหน่วงเวลาหลังใส่ผิดเกินจำนวนที่อนุญาต ระหว่างนั้นรหัสผ่านถูกก็เข้าไม่ได้
+func TestLoginStaff_ProgressiveDelay(t *testing.T) {
+	t.Setenv("LOGIN_FREE_FAILURES", "1")
+	t.Setenv("LOGIN_BASE_DELAY", "1m")
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+
+	assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "wrongpassword"))
+	assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "wrongpassword"))
+	assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "password"))
+}
+
+// ทดสอบ request ที่ยิงพร้อมกันถูกนับทีละครั้ง: หลังใส่ผิดเกินจำนวนที่ไม่ต้องรอ request ที่เหลือต้องไม่ได้ตรวจรหัสผ่าน
+func TestLoginStaff_ConcurrentGuessesAreThrottled(t *testing.T) {
+	t.Setenv("LOGIN_FREE_FAILURES", "1")
+	t.Setenv("LOGIN_BASE_DELAY", "1m")
+	t.Setenv("LOGIN_IP_FREE_FAILURES", "100")
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loginStatus(router, "clerk", "wrongpassword")
+		}()
+	}
+	wg.Wait()
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	assert.Equal(t, 2, clerk.FailedLoginAttempts)
+}
+
+// ทดสอบ admin ปลดล็อกบัญชีแล้วเข้าสู่ระบบได้
+func TestUnlockStaff_Success(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES", "2")
+	t.Setenv("LOGIN_FREE_FAILURES", "5")
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
+
+	loginStatus(router, "clerk", "wrongpassword")
+	loginStatus(router, "clerk", "wrongpassword")
+	assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "password"))
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	w := performRequest(router, "POST", fmt.Sprintf("/staff/%d/unlock", clerk.ID), nil, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusOK, loginStatus(router, "clerk", "password"))
+
+	w = performRequest(router, "GET", fmt.Sprintf("/staff/lockout-events?staff_id=%d", clerk.ID), nil, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Events []models.LockoutEvent `json:"events"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response.Events, 2)
+	assert.Equal(t, models.LockoutEventUnlocked, response.Events[0].Event)
+}
+
+// ทดสอบรายชื่อ Staff: เห็นเฉพาะโรงพยาบาลตัวเอง กรองตาม role และแบ่งหน้าได้
+func TestListStaff(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	token := getValidToken(db, "admin", "Hospital")
+
+	w := performRequest(router, "GET", "/staff?limit=2", nil, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Staff []struct {
+			Username string `json:"username"`
+			Hospital string `json:"hospital"`
+		} `json:"staff"`
+		Total   int    `json:"total"`
+		HasMore bool   `json:"has_more"`
+		Next    string `json:"next"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 3, response.Total)
+	assert.Len(t, response.Staff, 2)
+	assert.True(t, response.HasMore)
+	assert.NotContains(t, w.Body.String(), "admin_other")
+	assert.NotContains(t, w.Body.String(), `"Password"`)
+
+	w = performRequest(router, "GET", "/staff?limit=2&cursor="+response.Next, nil, token)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Len(t, response.Staff, 1)
+
+	w = performRequest(router, "GET", "/staff?role=auditor", nil, token)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 1, response.Total)
+	assert.Equal(t, "auditor", response.Staff[0].Username)
+}
+
+// ทดสอบปิดการใช้งานบัญชี: token ที่ออกไปแล้วถูกปฏิเสธทันที login ไม่ได้ และเปิดกลับได้
+func TestDeactivateStaff(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	routes.PatientRoutes(router, newPatientHandler(db), repository.NewPostgresStaff(db), db)
+	adminToken := getValidToken(db, "admin", "Hospital")
+	clerkToken := getValidToken(db, "clerk", "Hospital")
+
+	var clerk models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+
+	w := performRequest(router, "POST", fmt.Sprintf("/staff/%d/deactivate", clerk.ID), nil, adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performRequest(router, "GET", "/patient/search?last_name=สุขดี", nil, clerkToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, loginStatus(router, "clerk", "password"))
+
+	w = performRequest(router, "GET", "/staff?status=inactive", nil, adminToken)
+	assert.Contains(t, w.Body.String(), `"username":"clerk"`)
+
+	w = performRequest(router, "POST", fmt.Sprintf("/staff/%d/reactivate", clerk.ID), nil, adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, loginStatus(router, "clerk", "password"))
+}
+
+// ทดสอบแก้ role และกันไม่ให้ admin แก้บัญชีตัวเอง
+func TestUpdateStaff(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupStaffRouter(db)
+	adminToken := getValidToken(db, "admin", "Hospital")
+
+	var clerk, admin models.Staff
+	db.Where("username = ?", "clerk").First(&clerk)
+	db.Where("username = ?", "admin").First(&admin)
+
+	payload, _ := json.Marshal(map[string]string{"role": "admin"})
+	w := performRequest(router, "PATCH", fmt.Sprintf("/staff/%d", clerk.ID), payload, adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"admin"`)
+
+	// admin แก้ role ตัวเองไม่ได้
+	payload, _ = json.Marshal(map[string]string{"role": "nurse"})
+	w = performRequest(router, "PATCH", fmt.Sprintf("/staff/%d", admin.ID), payload, adminToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performRequest(router, "POST", fmt.Sprintf("/staff/%d/deactivate", admin.ID), nil, adminToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// admin โรงพยาบาลอื่นไม่เห็น Staff คนนี้
+	otherToken := getValidToken(db, "admin_other", "OtherHospital")
+	w = performRequest(router, "GET", fmt.Sprintf("/staff/%d", clerk.ID), nil, otherToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,161 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/keys"
+	"HIS-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// ชนิดของ token (claim "typ") token ชนิดอื่นใช้แทน access token ไม่ได้
+const (
+	TypeAccess         = "access"
+	TypeMFA            = "mfa"             // ผ่านรหัสผ่านแล้ว รอยืนยันรหัส MFA
+	TypeMFAEnroll      = "mfa_enroll"      // ผ่านรหัสผ่านแล้ว แต่ role บังคับ MFA และยังไม่ได้ลงทะเบียน
+	TypePasswordChange = "password_change" // ยืนยันตัวตนครบแล้ว แต่ถูกบังคับให้เปลี่ยนรหัสผ่านก่อน
+)
+
+// อายุของ access token (ตั้งได้ด้วย ACCESS_TOKEN_TTL ค่า default 15 นาที)
+func AccessTokenTTL() time.Duration {
+	return config.Current().Tokens.AccessTTL
+}
+
+// สุ่มค่า hex ความยาว n ไบต์ ใช้เป็น jti และ refresh token
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// อายุของ token ขั้นตอน MFA (ตั้งได้ด้วย MFA_CHALLENGE_TTL ค่า default 5 นาที)
+func ChallengeTokenTTL() time.Duration {
+	return config.Current().Tokens.MFAChallengeTTL
+}
+
+func issue(staff models.Staff, typ string, ttl time.Duration) (string, time.Time, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := jwt.MapClaims{
+		"sub":      strconv.FormatUint(uint64(staff.ID), 10),
+		"jti":      jti,
+		"typ":      typ,
+		"username": staff.Username,
+		"hospital": staff.Hospital,
+		"role":     string(staff.Role),
+		"iat":      issuedAt(now),
+		"exp":      expiresAt.Unix(),
+	}
+	signed, err := keys.Default().Sign(claims)
+	return signed, expiresAt, err
+}
+
+// iat ละเอียดถึงมิลลิวินาที (NumericDate เป็นทศนิยมได้) เพื่อให้เทียบกับเวลาเปลี่ยนรหัสผ่านได้
+// แม้ token จะออกในวินาทีเดียวกัน ดู IssuedBefore
+func issuedAt(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// token ออกก่อนเวลา t หรือไม่ (เทียบที่ความละเอียดมิลลิวินาที) token ที่ไม่มี iat ถือว่าออกก่อน
+// อ่าน iat เองเพราะ GetIssuedAt ตัดเศษวินาทีทิ้งตาม jwt.TimePrecision
+func IssuedBefore(claims jwt.MapClaims, t time.Time) bool {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return true
+	}
+	return int64(math.Round(iat*1000)) < t.UnixMilli()
+}
+
+// ออก access token อายุสั้นให้ Staff โดยมี jti ไว้สำหรับ revoke ตอน logout
+func IssueAccessToken(staff models.Staff) (string, time.Time, error) {
+	return issue(staff, TypeAccess, AccessTokenTTL())
+}
+
+// ออก token สำหรับขั้นตอนถัดไปของการเข้าสู่ระบบ (TypeMFA, TypeMFAEnroll หรือ TypePasswordChange)
+func IssueChallengeToken(staff models.Staff, typ string) (string, error) {
+	signed, _, err := issue(staff, typ, ChallengeTokenTTL())
+	return signed, err
+}
+
+// ตรวจลายเซ็น (ตาม kid) อัลกอริทึม และวันหมดอายุของ token แล้วคืน claims
+// token ต้องเป็นชนิดใดชนิดหนึ่งใน types
+func ParseToken(tokenString string, types ...string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, keys.Default().Keyfunc,
+		jwt.WithValidMethods(keys.ValidMethods()), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, ErrInvalidToken
+	}
+
+	typ, _ := claims["typ"].(string)
+	for _, t := range types {
+		if typ == t {
+			return claims, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// ตรวจ access token แล้วคืน claims
+func ParseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	return ParseToken(tokenString, TypeAccess)
+}
+
+// ตรวจว่า access token (jti) ถูก revoke ไปแล้วหรือยัง
+func IsRevoked(db *gorm.DB, jti string) (bool, error) {
+	var count int64
+	err := db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// ใส่ token (jti) ลง denylist จนกว่าจะหมดอายุ และล้างรายการที่หมดอายุไปแล้วทิ้ง
+// ใช้ทั้งตอน logout และทำให้ token ขั้นตอน MFA ใช้ได้ครั้งเดียว
+func RevokeToken(db *gorm.DB, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	exp, err := claims.GetExpirationTime()
+	if jti == "" || err != nil || exp == nil {
+		return ErrInvalidToken
+	}
+	staffID, _ := StaffID(claims)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(&models.RevokedToken{JTI: jti, StaffID: staffID, ExpiresAt: exp.Time}).Error
+	})
+}
+
+// ดึง ID ของ Staff จาก claim "sub"
+func StaffID(claims jwt.MapClaims) (uint, bool) {
+	sub, _ := claims["sub"].(string)
+	id, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,137 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"HIS-api/config"
+	"HIS-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// อายุของ refresh token (ตั้งได้ด้วย REFRESH_TOKEN_TTL ค่า default 7 วัน)
+func RefreshTokenTTL() time.Duration {
+	return config.Current().Tokens.RefreshTTL
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ออก refresh token ใหม่ ถ้า familyID ว่างจะเริ่ม family ใหม่ (login ครั้งใหม่)
+func IssueRefreshToken(db *gorm.DB, staffID uint, familyID string) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	if familyID == "" {
+		if familyID, err = randomHex(16); err != nil {
+			return "", err
+		}
+	}
+
+	record := models.RefreshToken{
+		StaffID:   staffID,
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// แลก refresh token เดิมเป็น token ใหม่ (rotate) token เดิมจะใช้ไม่ได้อีก
+// ถ้า token เดิมถูกใช้ไปแล้ว ถือว่าอาจถูกขโมย จะ revoke ทั้ง family และคืน ErrRefreshTokenReused พร้อม Staff เจ้าของ token
+func RotateRefreshToken(db *gorm.DB, token string) (models.Staff, string, error) {
+	var staff models.Staff
+	var next string
+	reusedFamily := ""
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var record models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(token)).
+			First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		if record.RevokedAt != nil {
+			// โหลด Staff เจ้าของ token ไว้ให้ผู้เรียกบันทึกว่าบัญชีไหนถูกใช้ token ซ้ำ
+			// ถ้าหาไม่เจอ (เช่นบัญชีถูกลบ) ยังคืน ID ไว้ให้ตามรอยได้
+			reusedFamily = record.FamilyID
+			if err := tx.First(&staff, record.StaffID).Error; err != nil {
+				staff = models.Staff{}
+				staff.ID = record.StaffID
+			}
+			return nil
+		}
+		if time.Now().After(record.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if err := tx.First(&staff, record.StaffID).Error; err != nil {
+			return ErrRefreshTokenInvalid
+		}
+
+		now := time.Now()
+		if err := tx.Model(&record).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		next, err = IssueRefreshToken(tx, staff.ID, record.FamilyID)
+		return err
+	})
+	if err != nil {
+		return staff, "", err
+	}
+
+	if reusedFamily != "" {
+		if err := revokeFamilyID(db, reusedFamily); err != nil {
+			return staff, "", err
+		}
+		return staff, "", ErrRefreshTokenReused
+	}
+	return staff, next, nil
+}
+
+// revoke refresh token ทุกตัวใน family เดียวกับ token ที่ระบุ (ใช้ตอน logout)
+// token ต้องเป็นของ Staff คนที่ระบุเท่านั้น
+func RevokeFamily(db *gorm.DB, token string, staffID uint) error {
+	var record models.RefreshToken
+	err := db.Where("token_hash = ? AND staff_id = ?", hashToken(token), staffID).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	return revokeFamilyID(db, record.FamilyID)
+}
+
+func revokeFamilyID(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revoke refresh token ทั้งหมดของ Staff (ออกจากระบบทุกเครื่อง)
+func RevokeAllForStaff(db *gorm.DB, staffID uint) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("staff_id = ? AND revoked_at IS NULL", staffID).
+		Update("revoked_at", time.Now()).Error
+}
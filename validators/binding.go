@@ -0,0 +1,83 @@
+package validators
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var registerOnce sync.Once
+
+// ลงทะเบียน custom validator กับ gin binding
+//   - thai_national_id : เลขประจำตัวประชาชนไทยพร้อม check digit
+//   - passport         : เลขหนังสือเดินทางตาม ICAO 9303
+//
+// ค่าว่างถือว่าผ่าน ถ้าต้องการบังคับกรอกให้ใช้ required คู่กัน
+// เรียกซ้ำได้ จะลงทะเบียนแค่ครั้งเดียว
+func Register() {
+	registerOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			panic("validators: gin binding engine is not go-playground/validator")
+		}
+
+		// ให้ error อ้างชื่อฟิลด์ตาม json/form tag แทนชื่อ struct field
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return f.Name
+		})
+
+		v.RegisterValidation("thai_national_id", func(fl validator.FieldLevel) bool {
+			s := fl.Field().String()
+			return s == "" || ValidThaiNationalID(s)
+		})
+		v.RegisterValidation("passport", func(fl validator.FieldLevel) bool {
+			s := fl.Field().String()
+			return s == "" || ValidPassportNumber(s)
+		})
+	})
+}
+
+var messages = map[string]string{
+	"required":         "is required",
+	"email":            "must be a valid email address",
+	"oneof":            "must be one of: %s",
+	"datetime":         "must be a date in format %s",
+	"min":              "must not be empty",
+	"thai_national_id": "must be a valid 13-digit Thai national ID",
+	"passport":         "must be a valid passport number (ICAO 9303)",
+}
+
+// แปลง error จาก binding ให้เป็น map ชื่อฟิลด์ -> ข้อความ สำหรับตอบ 400
+// คืนค่า nil ถ้า err ไม่ใช่ validation error (เช่น JSON ผิดรูปแบบ)
+func FieldErrors(err error) map[string]string {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	fields := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		msg, ok := messages[fe.Tag()]
+		if !ok {
+			msg = "is invalid"
+		}
+		if strings.Contains(msg, "%s") {
+			msg = strings.Replace(msg, "%s", fe.Param(), 1)
+		}
+		fields[fe.Field()] = msg
+	}
+	return fields
+}
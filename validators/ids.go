@@ -0,0 +1,41 @@
+package validators
+
+import "strings"
+
+// ตรวจสอบเลขประจำตัวประชาชนไทย 13 หลัก
+// หลักที่ 13 คือ check digit คำนวณจาก mod 11 ของผลรวม 12 หลักแรกคูณน้ำหนัก 13 ถึง 2
+func ValidThaiNationalID(id string) bool {
+	if len(id) != 13 {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 13; i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+		if i < 12 {
+			sum += int(id[i]-'0') * (13 - i)
+		}
+	}
+
+	check := (11 - sum%11) % 10
+	return int(id[12]-'0') == check
+}
+
+// ตรวจสอบเลขหนังสือเดินทางตาม ICAO 9303 (ช่อง document number ใน MRZ)
+// ยาวไม่เกิน 9 ตัว ใช้ได้เฉพาะ A-Z และ 0-9 และอนุญาตตัวเติม '<' เฉพาะท้ายเลข
+func ValidPassportNumber(number string) bool {
+	trimmed := strings.TrimRight(number, "<")
+	if len(number) > 9 || trimmed == "" {
+		return false
+	}
+
+	for i := 0; i < len(trimmed); i++ {
+		ch := trimmed[i]
+		if !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}